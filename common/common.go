@@ -6,6 +6,7 @@ import (
 	"log"
 	"path/filepath"
 	"runtime"
+	"sync/atomic"
 )
 
 const (
@@ -22,6 +23,52 @@ type RequestIDKey struct{}
 // LogLevel
 type LogLevelKey struct{}
 
+// ProgressKey is used together with context for setting/getting Progress
+type ProgressKey struct{}
+
+// Progress counts migrations applied by long running operations (like asynchronous jobs)
+// all methods are safe for concurrent use and are no-op when called on nil Progress
+type Progress struct {
+	total   int32
+	applied int32
+}
+
+// GetProgress returns Progress stored in context or nil if context doesn't have one
+func GetProgress(ctx context.Context) *Progress {
+	progress, _ := ctx.Value(ProgressKey{}).(*Progress)
+	return progress
+}
+
+// SetTotal sets the number of migrations (for all tenants) which are going to be applied
+func (p *Progress) SetTotal(total int32) {
+	if p != nil {
+		atomic.StoreInt32(&p.total, total)
+	}
+}
+
+// AddApplied adds delta to the number of applied migrations
+func (p *Progress) AddApplied(delta int32) {
+	if p != nil {
+		atomic.AddInt32(&p.applied, delta)
+	}
+}
+
+// Total returns the number of migrations which are going to be applied
+func (p *Progress) Total() int32 {
+	if p == nil {
+		return 0
+	}
+	return atomic.LoadInt32(&p.total)
+}
+
+// Applied returns the number of migrations applied so far
+func (p *Progress) Applied() int32 {
+	if p == nil {
+		return 0
+	}
+	return atomic.LoadInt32(&p.applied)
+}
+
 // LogError logs error message
 func LogError(ctx context.Context, format string, a ...interface{}) string {
 	return logLevel(ctx, errorLevel, format, a...)
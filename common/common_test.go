@@ -94,3 +94,21 @@ func TestShouldLogMessage(t *testing.T) {
 	assert.False(t, shouldLogMessage(panicLevel, errorLevel))
 	assert.True(t, shouldLogMessage(panicLevel, panicLevel))
 }
+
+func TestProgress(t *testing.T) {
+	// context without progress, methods are no-op
+	progress := GetProgress(newTestContext())
+	assert.Nil(t, progress)
+	progress.SetTotal(10)
+	progress.AddApplied(1)
+	assert.Equal(t, int32(0), progress.Total())
+	assert.Equal(t, int32(0), progress.Applied())
+
+	ctx := context.WithValue(newTestContext(), ProgressKey{}, &Progress{})
+	progress = GetProgress(ctx)
+	progress.SetTotal(10)
+	progress.AddApplied(3)
+	progress.AddApplied(2)
+	assert.Equal(t, int32(10), progress.Total())
+	assert.Equal(t, int32(5), progress.Applied())
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"gopkg.in/go-playground/validator.v9"
 	"gopkg.in/yaml.v3"
@@ -11,24 +13,166 @@ import (
 
 // Config represents Migrator's yaml configuration file
 type Config struct {
-	BaseLocation      string   `yaml:"baseLocation" validate:"required"`
-	Driver            string   `yaml:"driver" validate:"required"`
-	DataSource        string   `yaml:"dataSource" validate:"required"`
-	TenantSelect      string   `yaml:"tenantSelect,omitempty"`
-	TenantInsert      string   `yaml:"tenantInsert,omitempty"`
-	TenantSelectSQL   string   `yaml:"tenantSelectSQL,omitempty"` // Deprecated: use TenantSelect instead
-	TenantInsertSQL   string   `yaml:"tenantInsertSQL,omitempty"` // Deprecated: use TenantInsert instead
-	SchemaPlaceHolder string   `yaml:"schemaPlaceHolder,omitempty"`
-	SingleMigrations  []string `yaml:"singleMigrations" validate:"min=1"`
-	TenantMigrations  []string `yaml:"tenantMigrations,omitempty"`
-	SingleScripts     []string `yaml:"singleScripts,omitempty"`
-	TenantScripts     []string `yaml:"tenantScripts,omitempty"`
-	Port              string   `yaml:"port,omitempty"`
-	PathPrefix        string   `yaml:"pathPrefix,omitempty"`
-	WebHookURL        string   `yaml:"webHookURL,omitempty"`
-	WebHookHeaders    []string `yaml:"webHookHeaders,omitempty"`
-	WebHookTemplate   string   `yaml:"webHookTemplate,omitempty"`
-	LogLevel          string   `yaml:"logLevel,omitempty" validate:"logLevel"`
+	BaseLocation                       string   `yaml:"baseLocation" validate:"required"`
+	Driver                             string   `yaml:"driver" validate:"required"`
+	DataSource                         string   `yaml:"dataSource" validate:"required"`
+	TenantSelect                       string   `yaml:"tenantSelect,omitempty"`
+	TenantInsert                       string   `yaml:"tenantInsert,omitempty"`
+	TenantDelete                       string   `yaml:"tenantDelete,omitempty"`
+	TenantSelectSQL                    string   `yaml:"tenantSelectSQL,omitempty"` // Deprecated: use TenantSelect instead
+	TenantInsertSQL                    string   `yaml:"tenantInsertSQL,omitempty"` // Deprecated: use TenantInsert instead
+	SchemaPlaceHolder                  string   `yaml:"schemaPlaceHolder,omitempty"`
+	SingleMigrations                   []string `yaml:"singleMigrations" validate:"min=1"`
+	TenantMigrations                   []string `yaml:"tenantMigrations,omitempty"`
+	SingleScripts                      []string `yaml:"singleScripts,omitempty"`
+	TenantScripts                      []string `yaml:"tenantScripts,omitempty"`
+	NoTransactionMigrations            []string `yaml:"noTransactionMigrations,omitempty"`
+	Port                               string   `yaml:"port,omitempty"`
+	PathPrefix                         string   `yaml:"pathPrefix,omitempty"`
+	WebHookURL                         string   `yaml:"webHookURL,omitempty"`
+	WebHookHeaders                     []string `yaml:"webHookHeaders,omitempty"`
+	WebHookTemplate                    string   `yaml:"webHookTemplate,omitempty"`
+	LogLevel                           string   `yaml:"logLevel,omitempty" validate:"logLevel"`
+	OutOfOrder                         string   `yaml:"outOfOrder,omitempty" validate:"outOfOrder"`
+	VersionOrdering                    string   `yaml:"versionOrdering,omitempty" validate:"versionOrdering"`
+	VerifyChecksums                    bool     `yaml:"verifyChecksums,omitempty"`
+	MissingSourceMigrationsHealthCheck bool     `yaml:"missingSourceMigrationsHealthCheck,omitempty"`
+	TenantConcurrency                  int      `yaml:"tenantConcurrency,omitempty" validate:"min=0"`
+	FailurePolicy                      string   `yaml:"failurePolicy,omitempty" validate:"failurePolicy"`
+	MaxTenantFailures                  int      `yaml:"maxTenantFailures,omitempty" validate:"min=0"`
+	LockTimeout                        int      `yaml:"lockTimeout,omitempty" validate:"min=0"`
+	LockTTL                            int      `yaml:"lockTTL,omitempty" validate:"min=0"`
+	StatementTimeout                   int      `yaml:"statementTimeout,omitempty" validate:"min=0"`
+	// StatementTimeouts maps source directories to statement timeouts (in seconds) of their migrations
+	StatementTimeouts map[string]int `yaml:"statementTimeouts,omitempty" validate:"dive,min=0"`
+	RetryMaxAttempts  int            `yaml:"retryMaxAttempts,omitempty" validate:"min=0"`
+	RetryBackoff      int            `yaml:"retryBackoff,omitempty" validate:"min=0"`
+	// TenantSelectors maps tenant source directories to tenant selectors, for example: tier=enterprise
+	TenantSelectors map[string]string `yaml:"tenantSelectors,omitempty"`
+	// Labels maps source directories to labels of their migrations, Contexts are contexts in which labelled migrations are applied
+	Labels   map[string][]string `yaml:"labels,omitempty"`
+	Contexts []string            `yaml:"contexts,omitempty"`
+	// SingleRepeatables and TenantRepeatables are directories of scripts which are applied only when their checksum changed
+	SingleRepeatables []string `yaml:"singleRepeatables,omitempty"`
+	TenantRepeatables []string `yaml:"tenantRepeatables,omitempty"`
+	// Callbacks are directories of lifecycle callbacks, callback event is the prefix of callback name, for example: afterVersion.sql
+	Callbacks []string `yaml:"callbacks,omitempty"`
+	// Templates enables rendering of migrations as Go text/template, Variables are available in templates as .Vars
+	// and env variables whose names start with TemplateEnvPrefix are available as .Env (none when prefix is empty)
+	Templates         bool              `yaml:"templates,omitempty"`
+	Variables         map[string]string `yaml:"variables,omitempty"`
+	TemplateEnvPrefix string            `yaml:"templateEnvPrefix,omitempty"`
+}
+
+const (
+	// OutOfOrderAllow (the default policy) tells migrator to silently apply out-of-order migrations
+	OutOfOrderAllow = "allow"
+	// OutOfOrderWarn tells migrator to apply out-of-order migrations and report them
+	OutOfOrderWarn = "warn"
+	// OutOfOrderFail tells migrator to refuse to create version when out-of-order migrations are found
+	OutOfOrderFail = "fail"
+)
+
+const (
+	// VersionOrderingLexical (the default strategy) tells migrator to sort migrations by their names
+	VersionOrderingLexical = "lexical"
+	// VersionOrderingSemver tells migrator to sort migrations by numeric version prefix of their names, for example V1_2_3__desc.sql
+	VersionOrderingSemver = "semver"
+	// VersionOrderingTimestamp tells migrator to sort migrations by timestamp prefix of their names, for example 20160216120000_desc.sql
+	VersionOrderingTimestamp = "timestamp"
+)
+
+const (
+	// FailurePolicyAbortAll tells migrator to apply version in a single transaction, a failing tenant rolls back the whole version
+	FailurePolicyAbortAll = "abortAll"
+	// FailurePolicyContinue tells migrator to apply every tenant in its own transaction and continue when a tenant fails
+	FailurePolicyContinue = "continue"
+	// FailurePolicyStopAfterN tells migrator to apply every tenant in its own transaction and skip remaining tenants
+	// once MaxTenantFailures tenants failed
+	FailurePolicyStopAfterN = "stopAfterN"
+)
+
+// GetFailurePolicy returns tenant failure policy, defaults to FailurePolicyAbortAll
+func (c *Config) GetFailurePolicy() string {
+	if c.FailurePolicy == "" {
+		return FailurePolicyAbortAll
+	}
+	return c.FailurePolicy
+}
+
+// GetMaxTenantFailures returns number of failed tenants after which FailurePolicyStopAfterN skips remaining tenants, defaults to 1
+func (c *Config) GetMaxTenantFailures() int {
+	if c.MaxTenantFailures < 1 {
+		return 1
+	}
+	return c.MaxTenantFailures
+}
+
+const (
+	// DefaultLockTimeout is the default number of seconds migrator waits for migration lock
+	DefaultLockTimeout = 60
+	// DefaultLockTTL is the default number of seconds after which MongoDB migration lock expires unless refreshed
+	DefaultLockTTL = 300
+	// DefaultRetryMaxAttempts is the default number of attempts of a transaction which failed with transient DB error
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryBackoff is the default number of milliseconds migrator waits before first retry of a transaction
+	DefaultRetryBackoff = 100
+)
+
+// GetLockTimeout returns how long migrator waits for migration lock held by another migrator, defaults to DefaultLockTimeout seconds
+func (c *Config) GetLockTimeout() time.Duration {
+	if c.LockTimeout < 1 {
+		return DefaultLockTimeout * time.Second
+	}
+	return time.Duration(c.LockTimeout) * time.Second
+}
+
+// GetLockTTL returns time after which MongoDB migration lock expires unless refreshed, defaults to DefaultLockTTL seconds
+func (c *Config) GetLockTTL() time.Duration {
+	if c.LockTTL < 1 {
+		return DefaultLockTTL * time.Second
+	}
+	return time.Duration(c.LockTTL) * time.Second
+}
+
+// GetStatementTimeout returns how long a single statement of a migration can run before it is cancelled, 0 (the default) means no timeout
+// the timeout can be overridden for source directories using StatementTimeouts and for migrations using timeout header directive
+func (c *Config) GetStatementTimeout() time.Duration {
+	return time.Duration(c.StatementTimeout) * time.Second
+}
+
+// GetRetryMaxAttempts returns how many times migrator runs a transaction which failed with transient DB error
+// (deadlock, serialization failure, connection reset), defaults to DefaultRetryMaxAttempts, 1 disables retries
+func (c *Config) GetRetryMaxAttempts() int {
+	if c.RetryMaxAttempts < 1 {
+		return DefaultRetryMaxAttempts
+	}
+	return c.RetryMaxAttempts
+}
+
+// GetRetryBackoff returns how long migrator waits before first retry of a transaction, the wait doubles with every retry,
+// defaults to DefaultRetryBackoff milliseconds
+func (c *Config) GetRetryBackoff() time.Duration {
+	if c.RetryBackoff < 1 {
+		return DefaultRetryBackoff * time.Millisecond
+	}
+	return time.Duration(c.RetryBackoff) * time.Millisecond
+}
+
+// GetOutOfOrder returns out-of-order migrations policy, defaults to OutOfOrderAllow
+func (c *Config) GetOutOfOrder() string {
+	if c.OutOfOrder == "" {
+		return OutOfOrderAllow
+	}
+	return c.OutOfOrder
+}
+
+// GetVersionOrdering returns migrations ordering strategy, defaults to VersionOrderingLexical
+func (c *Config) GetVersionOrdering() string {
+	if c.VersionOrdering == "" {
+		return VersionOrderingLexical
+	}
+	return c.VersionOrdering
 }
 
 // GetTenantSelect returns tenant select query/statement with backward compatibility
@@ -97,10 +241,18 @@ func FromBytes(contents []byte) (*Config, error) {
 
 	validate := validator.New()
 	validate.RegisterValidation("logLevel", validateLogLevel)
+	validate.RegisterValidation("outOfOrder", validateOutOfOrder)
+	validate.RegisterValidation("failurePolicy", validateFailurePolicy)
+	validate.RegisterValidation("versionOrdering", validateVersionOrdering)
 	if err := validate.Struct(config); err != nil {
 		return nil, err
 	}
 
+	// abortAll applies the whole version in a single transaction, tenants can be migrated in parallel only in their own transactions
+	if config.TenantConcurrency > 1 && config.GetFailurePolicy() == FailurePolicyAbortAll {
+		return nil, errors.New("tenantConcurrency greater than 1 requires failurePolicy continue or stopAfterN")
+	}
+
 	substituteEnvVariables(&config)
 
 	return &config, nil
@@ -123,6 +275,12 @@ func substituteEnvVariables(config *Config) {
 					ss[i] = substituteEnvVariable(ss[i])
 				}
 				valueField.Set(reflect.ValueOf(ss))
+			case reflect.Map:
+				if ms, ok := valueField.Interface().(map[string]string); ok {
+					for k, v := range ms {
+						ms[k] = substituteEnvVariable(v)
+					}
+				}
 			}
 		}
 	}
@@ -142,3 +300,18 @@ func validateLogLevel(fl validator.FieldLevel) bool {
 	value := fl.Field().String()
 	return value == "" || value == "DEBUG" || value == "INFO" || value == "ERROR" || value == "PANIC"
 }
+
+func validateOutOfOrder(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return value == "" || value == OutOfOrderAllow || value == OutOfOrderWarn || value == OutOfOrderFail
+}
+
+func validateFailurePolicy(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return value == "" || value == FailurePolicyAbortAll || value == FailurePolicyContinue || value == FailurePolicyStopAfterN
+}
+
+func validateVersionOrdering(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	return value == "" || value == VersionOrderingLexical || value == VersionOrderingSemver || value == VersionOrderingTimestamp
+}
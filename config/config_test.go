@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/go-playground/validator.v9"
@@ -120,3 +121,177 @@ logLevel: ABC`
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), `Error:Field validation for 'LogLevel' failed on the 'logLevel' tag`)
 }
+
+func TestCustomValidatorOutOfOrderError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+outOfOrder: ignore`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'OutOfOrder' failed on the 'outOfOrder' tag`)
+}
+
+func TestGetOutOfOrder(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, OutOfOrderAllow, config.GetOutOfOrder())
+
+	config.OutOfOrder = OutOfOrderFail
+	assert.Equal(t, OutOfOrderFail, config.GetOutOfOrder())
+}
+
+func TestCustomValidatorVersionOrderingError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+versionOrdering: natural`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'VersionOrdering' failed on the 'versionOrdering' tag`)
+}
+
+func TestGetVersionOrdering(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, VersionOrderingLexical, config.GetVersionOrdering())
+
+	config.VersionOrdering = VersionOrderingSemver
+	assert.Equal(t, VersionOrderingSemver, config.GetVersionOrdering())
+}
+
+func TestCustomValidatorFailurePolicyError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+failurePolicy: ignore`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'FailurePolicy' failed on the 'failurePolicy' tag`)
+}
+
+func TestTenantConcurrencyRequiresFailurePolicy(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+tenantConcurrency: 10`
+
+	_, err := FromBytes([]byte(config))
+	assert.Equal(t, "tenantConcurrency greater than 1 requires failurePolicy continue or stopAfterN", err.Error())
+
+	_, err = FromBytes([]byte(config + "\nfailurePolicy: abortAll"))
+	assert.Equal(t, "tenantConcurrency greater than 1 requires failurePolicy continue or stopAfterN", err.Error())
+
+	c, err := FromBytes([]byte(config + "\nfailurePolicy: continue"))
+	assert.Nil(t, err)
+	assert.Equal(t, FailurePolicyContinue, c.GetFailurePolicy())
+}
+
+func TestGetFailurePolicy(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, FailurePolicyAbortAll, config.GetFailurePolicy())
+	assert.Equal(t, 1, config.GetMaxTenantFailures())
+
+	// tenantConcurrency doesn't change failure policy
+	config.TenantConcurrency = 10
+	assert.Equal(t, FailurePolicyAbortAll, config.GetFailurePolicy())
+
+	config.FailurePolicy = FailurePolicyStopAfterN
+	config.MaxTenantFailures = 5
+	assert.Equal(t, FailurePolicyStopAfterN, config.GetFailurePolicy())
+	assert.Equal(t, 5, config.GetMaxTenantFailures())
+}
+
+func TestGetLockTimeouts(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, 60*time.Second, config.GetLockTimeout())
+	assert.Equal(t, 300*time.Second, config.GetLockTTL())
+
+	config.LockTimeout = 5
+	config.LockTTL = 30
+	assert.Equal(t, 5*time.Second, config.GetLockTimeout())
+	assert.Equal(t, 30*time.Second, config.GetLockTTL())
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, 3, config.GetRetryMaxAttempts())
+	assert.Equal(t, 100*time.Millisecond, config.GetRetryBackoff())
+
+	config.RetryMaxAttempts = 1
+	config.RetryBackoff = 250
+	assert.Equal(t, 1, config.GetRetryMaxAttempts())
+	assert.Equal(t, 250*time.Millisecond, config.GetRetryBackoff())
+}
+
+func TestGetStatementTimeout(t *testing.T) {
+	config := &Config{}
+	assert.Equal(t, time.Duration(0), config.GetStatementTimeout())
+
+	config.StatementTimeout = 30
+	assert.Equal(t, 30*time.Second, config.GetStatementTimeout())
+}
+
+func TestStatementTimeoutsValidationError(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+statementTimeouts:
+    ref: 60
+    tenants: -1`
+
+	_, err := FromBytes([]byte(config))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `Error:Field validation for 'StatementTimeouts[tenants]' failed on the 'min' tag`)
+}
+
+func TestVariablesWithEnv(t *testing.T) {
+	os.Setenv("MIGRATOR_TEST_OWNER", "app_owner")
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+templates: true
+variables:
+    owner: ${MIGRATOR_TEST_OWNER}
+    region: eu-central-1
+templateEnvPrefix: MIGRATOR_TEMPLATE_`
+
+	cfg, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.True(t, cfg.Templates)
+	assert.Equal(t, map[string]string{"owner": "app_owner", "region": "eu-central-1"}, cfg.Variables)
+	assert.Equal(t, "MIGRATOR_TEMPLATE_", cfg.TemplateEnvPrefix)
+}
+
+func TestLabelsAndContexts(t *testing.T) {
+	config := `baseLocation: /opt/app/migrations
+driver: postgres
+dataSource: user=p dbname=db host=localhost
+singleMigrations:
+    - ref
+    - seeds
+labels:
+    seeds:
+        - test-data
+contexts:
+    - test
+    - test-data`
+
+	cfg, err := FromBytes([]byte(config))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"seeds": {"test-data"}}, cfg.Labels)
+	assert.Equal(t, []string{"test", "test-data"}, cfg.Contexts)
+}
@@ -2,8 +2,15 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
 
 	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
@@ -32,8 +39,22 @@ type Coordinator interface {
 	GetSourceMigrations(*SourceMigrationFilters) []types.Migration
 	GetSourceMigrationByFile(string) (*types.Migration, error)
 	VerifySourceMigrationsCheckSums() (bool, []types.Migration)
-	CreateVersion(string, types.Action, bool) *types.CreateResults
-	CreateTenant(string, types.Action, bool, string) *types.CreateResults
+	GetCheckSumMismatches() []types.CheckSumMismatch
+	GetMissingSourceMigrations() []types.DBMigration
+	CreateVersion(types.VersionInput) (*types.CreateResults, error)
+	CreateTenant(string, types.Action, bool, types.Tenant) (*types.CreateResults, error)
+	DeleteTenant(types.DeleteTenantInput) (*types.CreateResults, error)
+	RollbackVersion(int32, bool) (*types.CreateResults, error)
+	ResumeVersion(int32, bool) (*types.CreateResults, error)
+	CreateJob(types.VersionInput) (*types.Job, error)
+	RunJob(*types.Job, types.VersionInput)
+	FailJob(*types.Job, string)
+	GetJob(int32) (*types.Job, error)
+	CancelJob(int32) (*types.Job, error)
+	GetTenantStatus(string) (*types.TenantStatus, error)
+	CatchUpTenants(types.CatchUpTenantsInput) (*types.CreateResults, error)
+	Repair(types.RepairInput) (*types.RepairResults, error)
+	ImportHistory(types.ImportHistoryInput) (*types.ImportHistoryResults, error)
 	HealthCheck() types.HealthResponse
 	Dispose()
 }
@@ -41,6 +62,7 @@ type Coordinator interface {
 // coordinator struct is a struct for coordinator implementation
 type coordinator struct {
 	ctx       context.Context
+	cancel    context.CancelFunc
 	connector db.Connector
 	loader    loader.Loader
 	notifier  notifications.Notifier
@@ -48,11 +70,19 @@ type coordinator struct {
 	metrics   metrics.Metrics
 }
 
+// jobProgressInterval is how often progress of running asynchronous job is stored in DB
+var jobProgressInterval = 5 * time.Second
+
+// jobStaleTimeout is how long queued or running asynchronous job can go without storing its progress before it is considered orphaned
+var jobStaleTimeout = time.Minute
+
 // Factory is a factory method for creating Coorginator instance
 type Factory func(ctx context.Context, config *config.Config, metrics metrics.Metrics) Coordinator
 
 // New creates instance of Coordinator
 func New(ctx context.Context, config *config.Config, metrics metrics.Metrics, newConnector db.Factory, newLoader loader.Factory, newNotifier notifications.Factory) Coordinator {
+	// all DB operations are cancelled when passed context is cancelled (for example client disconnected) or when job is cancelled
+	ctx, cancel := context.WithCancel(ctx)
 	connector := newConnector(ctx, config)
 	loader := newLoader(ctx, config)
 	notifier := newNotifier(ctx, config)
@@ -62,6 +92,7 @@ func New(ctx context.Context, config *config.Config, metrics metrics.Metrics, ne
 		notifier:  notifier,
 		config:    config,
 		ctx:       ctx,
+		cancel:    cancel,
 		metrics:   metrics,
 	}
 	return coordinator
@@ -105,67 +136,590 @@ func (c *coordinator) GetDBMigrationByID(ID int32) (*types.DBMigration, error) {
 	return c.connector.GetDBMigrationByID(ID)
 }
 
+// GetAppliedMigrations returns applied DB migrations which were not rolled back
+// rollback entries and audit entries (repairs, tenant deletions, tenant failures) are not returned
 func (c *coordinator) GetAppliedMigrations() []types.DBMigration {
-	return c.connector.GetAppliedMigrations()
+	return c.excludeRolledBackMigrations(c.connector.GetAppliedMigrations())
 }
 
 // VerifySourceMigrationsCheckSums verifies if CheckSum of source and applied DB migrations match
-// VerifySourceMigrationsCheckSums allows CheckSum of scripts to be different (they are applied every time and are often updated)
+// VerifySourceMigrationsCheckSums allows CheckSum of scripts and repeatables to be different (they are applied every time or when changed)
 // returns bool indicating if offending (i.e., modified) disk migrations were found
 // if bool is false the function returns a slice of offending migrations
 // if bool is true the slice of effending migrations is empty
 func (c *coordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
-	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+	var offendingMigrations []types.Migration
+	for _, m := range c.GetCheckSumMismatches() {
+		offendingMigrations = append(offendingMigrations, m.SourceMigration)
+	}
+	return len(offendingMigrations) == 0, offendingMigrations
+}
+
+// GetCheckSumMismatches returns source migrations whose CheckSum differs from the CheckSum of applied DB migrations
+// together with the applied CheckSum, similarly to VerifySourceMigrationsCheckSums scripts and repeatables are skipped
+func (c *coordinator) GetCheckSumMismatches() []types.CheckSumMismatch {
+	return c.computeCheckSumMismatches(c.GetSourceMigrations(nil), c.connector.GetAppliedMigrations())
+}
+
+func (c *coordinator) computeCheckSumMismatches(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []types.CheckSumMismatch {
+	appliedMigrations = c.excludeRolledBackMigrations(appliedMigrations)
 
 	flattenedAppliedMigration := c.flattenAppliedMigrations(appliedMigrations)
 
 	intersect := c.intersect(sourceMigrations, flattenedAppliedMigration)
 
-	var offendingMigrations []types.Migration
-	var result = true
+	mismatches := []types.CheckSumMismatch{}
 	for _, t := range intersect {
-		if t.source.MigrationType == types.MigrationTypeSingleScript || t.source.MigrationType == types.MigrationTypeTenantScript {
+		if t.source.MigrationType == types.MigrationTypeSingleScript || t.source.MigrationType == types.MigrationTypeTenantScript || isRepeatable(t.source.MigrationType) || t.source.MigrationType == types.MigrationTypeCallback {
 			continue
 		}
 		if t.source.CheckSum != t.applied.CheckSum {
-			offendingMigrations = append(offendingMigrations, t.source)
-			result = false
+			mismatches = append(mismatches, types.CheckSumMismatch{SourceMigration: t.source, AppliedCheckSum: t.applied.CheckSum, AppliedContents: t.applied.Contents})
 		}
 	}
-	return result, offendingMigrations
+	return mismatches
+}
+
+// GetMissingSourceMigrations returns applied DB migrations (one per file) whose source migrations no longer exist
+func (c *coordinator) GetMissingSourceMigrations() []types.DBMigration {
+	return c.computeMissingSourceMigrations(c.GetSourceMigrations(nil), c.connector.GetAppliedMigrations())
+}
+
+// shouldVerifyCheckSums returns optional VersionInput override or config setting (disabled by default)
+func (c *coordinator) shouldVerifyCheckSums(verifyChecksums *bool) bool {
+	if verifyChecksums != nil {
+		return *verifyChecksums
+	}
+	return c.config != nil && c.config.VerifyChecksums
 }
 
-func (c *coordinator) CreateVersion(versionName string, action types.Action, dryRun bool) *types.CreateResults {
+func (c *coordinator) CreateVersion(input types.VersionInput) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tenants, err := c.selectTenants(input.Tenants, input.TenantPattern)
+	if err != nil {
+		return nil, err
+	}
+
 	sourceMigrations := c.GetSourceMigrations(nil)
-	appliedMigrations := c.GetAppliedMigrations()
+	appliedMigrations := c.connector.GetAppliedMigrations()
+
+	if c.shouldVerifyCheckSums(input.VerifyChecksums) {
+		mismatches := c.computeCheckSumMismatches(sourceMigrations, appliedMigrations)
+		if len(mismatches) > 0 {
+			files := []string{}
+			for _, m := range mismatches {
+				files = append(files, m.SourceMigration.File)
+			}
+			return nil, fmt.Errorf("checksum mismatch found in applied migrations: %v", strings.Join(files, ", "))
+		}
+	}
 
 	migrationsToApply := c.computeMigrationsToApply(sourceMigrations, appliedMigrations)
-	common.LogInfo(c.ctx, "Found migrations to apply: %d", len(migrationsToApply))
+	tenantMigrationsToApply := c.computeTenantMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
+	migrationsToApply = c.mergeTenantMigrationsToApply(sourceMigrations, migrationsToApply, tenantMigrationsToApply)
+
+	migrationsToApply, skippedMigrations := c.filterMigrationsByContexts(migrationsToApply, c.getContexts(input.Contexts))
+	if len(skippedMigrations) > 0 {
+		common.LogInfo(c.ctx, "Skipping migrations whose labels don't match contexts: %v", strings.Join(skippedMigrations, ", "))
+		tenantMigrationsToApply = c.filterTenantMigrationsToApply(tenantMigrationsToApply, migrationsToApply)
+	}
+
+	if input.Target != nil {
+		migrationsToApply, err = c.filterMigrationsUpToTarget(sourceMigrations, migrationsToApply, *input.Target)
+		if err != nil {
+			return nil, err
+		}
+		tenantMigrationsToApply = c.filterTenantMigrationsToApply(tenantMigrationsToApply, migrationsToApply)
+	}
+	migrationsToApply, err = c.sortMigrationsByDependencies(sourceMigrations, appliedMigrations, migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Found migrations to apply: %d, tenants: %d", len(migrationsToApply), len(tenants))
+	common.GetProgress(c.ctx).SetTotal(countMigrationsToApply(migrationsToApply, tenantMigrationsToApply))
+
+	outOfOrderMigrations := c.computeOutOfOrderMigrations(migrationsToApply, appliedMigrations)
+	if len(outOfOrderMigrations) > 0 {
+		switch c.getOutOfOrderPolicy() {
+		case config.OutOfOrderFail:
+			return nil, fmt.Errorf("out-of-order migrations found: %v", strings.Join(outOfOrderMigrations, ", "))
+		case config.OutOfOrderWarn:
+			common.LogWarn(c.ctx, "Applying out-of-order migrations: %v", strings.Join(outOfOrderMigrations, ", "))
+		default:
+			outOfOrderMigrations = nil
+		}
+	}
+
+	// callbacks are executed only when there is something to apply
+	if input.Action == types.ActionApply && len(migrationsToApply) > 0 {
+		migrationsToApply = append(migrationsToApply, c.filterCallbacks(sourceMigrations, types.CallbackBeforeVersion, types.CallbackBeforeEachTenant, types.CallbackAfterEachTenant, types.CallbackAfterVersion)...)
+	}
 
-	summary, version := c.connector.CreateVersion(versionName, action, migrationsToApply, dryRun)
+	summary, version := c.connector.CreateVersion(input.VersionName, input.Action, migrationsToApply, tenantMigrationsToApply, input.DryRun)
+	if summary != nil {
+		summary.OutOfOrderMigrations = outOfOrderMigrations
+		summary.SkippedMigrations = skippedMigrations
+	}
 
 	c.recordVersionMetrics(summary)
 
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
 }
 
-func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant string) *types.CreateResults {
+func (c *coordinator) CreateTenant(versionName string, action types.Action, dryRun bool, tenant types.Tenant) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	sourceMigrations := c.GetSourceMigrations(nil)
 
-	// filter only tenant schemas
-	migrationsToApply := c.filterTenantMigrations(sourceMigrations)
+	// filter only tenant schemas, migrations with tenant selectors are applied only when selected by new tenant's metadata
+	migrationsToApply := []types.Migration{}
+	for _, m := range c.filterTenantMigrations(sourceMigrations) {
+		if m.MatchesTenant(tenant) {
+			migrationsToApply = append(migrationsToApply, m)
+		}
+	}
+	migrationsToApply, skippedMigrations := c.filterMigrationsByContexts(migrationsToApply, c.getContexts(nil))
+	migrationsToApply, err = c.sortMigrationsByDependencies(sourceMigrations, c.connector.GetAppliedMigrations(), migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
 	common.LogInfo(c.ctx, "Migrations to apply for new tenant: %d", len(migrationsToApply))
 
+	if action == types.ActionApply {
+		migrationsToApply = append(migrationsToApply, c.filterCallbacks(sourceMigrations, types.CallbackBeforeEachTenant, types.CallbackAfterEachTenant, types.CallbackAfterCreateTenant)...)
+	}
+
 	summary, version := c.connector.CreateTenant(tenant, versionName, action, migrationsToApply, dryRun)
+	if summary != nil {
+		summary.SkippedMigrations = skippedMigrations
+	}
 
 	c.recordTenantMetrics(summary)
 
 	c.sendNotification(summary)
 
-	return &types.CreateResults{Summary: summary, Version: version}
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// DeleteTenant removes tenant, depending on the mode tenant schema is left untouched, archived (renamed), or dropped
+// dropping tenant requires confirmation token which must be equal to tenant name, deletion is recorded as a new version
+func (c *coordinator) DeleteTenant(input types.DeleteTenantInput) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := c.selectTenants(&[]string{input.TenantName}, nil); err != nil {
+		return nil, err
+	}
+
+	if input.Mode == types.DeleteTenantModeDrop && (input.ConfirmationToken == nil || *input.ConfirmationToken != input.TenantName) {
+		return nil, fmt.Errorf("confirmation token does not match tenant name: %v", input.TenantName)
+	}
+	common.LogInfo(c.ctx, "Deleting tenant: %v, mode: %v", input.TenantName, input.Mode)
+
+	summary, version := c.connector.DeleteTenant(input.TenantName, input.VersionName, input.Mode, input.DryRun)
+
+	c.recordTenantDeletionMetrics(summary)
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// RollbackVersion runs down migrations of all migrations applied in given version
+// migrations are rolled back in reverse order, scripts and migrations which were already rolled back are skipped
+// rollback is recorded as a new version
+func (c *coordinator) RollbackVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	version, err := c.GetVersionByID(ID)
+	if err != nil {
+		return nil, err
+	}
+
+	stillApplied := map[string]bool{}
+	for _, m := range c.excludeRolledBackMigrations(c.connector.GetAppliedMigrations()) {
+		stillApplied[m.File+"/"+m.Schema] = true
+	}
+
+	migrationsToRollback := []types.DBMigration{}
+	for i := len(version.DBMigrations) - 1; i >= 0; i-- {
+		m := version.DBMigrations[i]
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		if !stillApplied[m.File+"/"+m.Schema] {
+			continue
+		}
+		if m.DownContents == "" {
+			return nil, fmt.Errorf("migration %v does not have down migration", m.File)
+		}
+		migrationsToRollback = append(migrationsToRollback, m)
+	}
+
+	if len(migrationsToRollback) == 0 {
+		return nil, fmt.Errorf("version %v does not have any migrations to roll back", ID)
+	}
+	common.LogInfo(c.ctx, "Found migrations to roll back: %d", len(migrationsToRollback))
+
+	versionName := fmt.Sprintf("Rollback of version %v", ID)
+	summary, rollbackVersion := c.connector.RollbackVersion(versionName, migrationsToRollback, dryRun)
+
+	c.recordRollbackMetrics(summary)
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: rollbackVersion}, nil
+}
+
+// ResumeVersion applies again tenant migrations & scripts which failed in tenants of given partial version
+// tenants which were caught up (or deleted) since then are skipped, resume is recorded as a new version
+func (c *coordinator) ResumeVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	version, err := c.GetVersionByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if !version.Partial {
+		return nil, fmt.Errorf("version %v is not partial", ID)
+	}
+
+	sourceMigrations := c.GetSourceMigrations(nil)
+	appliedMigrations := c.connector.GetAppliedMigrations()
+
+	// key is Migration.File
+	sourceByFile := map[string]types.Migration{}
+	for _, m := range sourceMigrations {
+		sourceByFile[m.File] = m
+	}
+	// key is Migration.File and DBMigration.Schema, value is when it was last applied
+	lastApplied := map[string]time.Time{}
+	for _, m := range c.excludeRolledBackMigrations(appliedMigrations) {
+		key := m.File + "/" + m.Schema
+		if m.Created.Time.After(lastApplied[key]) {
+			lastApplied[key] = m.Created.Time
+		}
+	}
+	existing := map[string]bool{}
+	for _, t := range c.GetTenants() {
+		existing[t.Name] = true
+	}
+
+	tenantMigrationsToApply := map[string][]types.Migration{}
+	for _, m := range version.DBMigrations {
+		if m.MigrationType != types.MigrationTypeTenantFailure || !existing[m.Schema] {
+			continue
+		}
+		if applied, ok := lastApplied[m.File+"/"+m.Schema]; ok && !applied.Before(m.Created.Time) {
+			continue
+		}
+		source, ok := sourceByFile[m.File]
+		if !ok {
+			return nil, fmt.Errorf("source migration not found: %v", m.File)
+		}
+		tenantMigrationsToApply[m.Schema] = append(tenantMigrationsToApply[m.Schema], source)
+	}
+
+	if len(tenantMigrationsToApply) == 0 {
+		return nil, fmt.Errorf("version %v does not have any failed tenants to resume", ID)
+	}
+
+	migrationsToApply := c.mergeTenantMigrationsToApply(sourceMigrations, []types.Migration{}, tenantMigrationsToApply)
+	migrationsToApply, err = c.sortMigrationsByDependencies(sourceMigrations, appliedMigrations, migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Found migrations to resume: %d, failed tenants: %d", len(migrationsToApply), len(tenantMigrationsToApply))
+
+	versionName := fmt.Sprintf("Resume of version %v", ID)
+	summary, resumeVersion := c.connector.CreateVersion(versionName, types.ActionApply, migrationsToApply, tenantMigrationsToApply, dryRun)
+
+	c.recordVersionMetrics(summary)
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: resumeVersion}, nil
+}
+
+// CreateJob creates queued asynchronous job which creates new DB version, the job is run using RunJob
+// input is validated before the job is created
+func (c *coordinator) CreateJob(input types.VersionInput) (*types.Job, error) {
+	if _, err := c.selectTenants(input.Tenants, input.TenantPattern); err != nil {
+		return nil, err
+	}
+
+	job := c.connector.CreateJob(input.VersionName)
+	common.LogInfo(c.ctx, "Created job: %v, version: %v", job.ID, input.VersionName)
+
+	return job, nil
+}
+
+// RunJob creates new DB version and stores state, progress, and results of the job in DB
+// RunJob is called in background, panics and errors are recorded as job's error
+// cancellation requested using CancelJob is checked together with progress, cancelled job's transactions are rolled back
+func (c *coordinator) RunJob(job *types.Job, input types.VersionInput) {
+	progress := common.GetProgress(c.ctx)
+
+	if c.cancelRequested(job) {
+		common.LogInfo(c.ctx, "Job %v cancelled before it started", job.ID)
+		job.State = types.JobStateCancelled
+		job.CancelRequested = true
+		jobError := "job cancelled before it started"
+		job.Error = &jobError
+		c.updateJob(job)
+		return
+	}
+
+	job.State = types.JobStateRunning
+	c.updateJob(job)
+
+	// progress is stored periodically so that every migrator replica can report it
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if c.cancelRequested(job) {
+					common.LogInfo(c.ctx, "Cancelling job %v", job.ID)
+					c.cancel()
+				}
+				running := *job
+				running.MigrationsTotal = progress.Total()
+				running.MigrationsApplied = progress.Applied()
+				c.updateJob(&running)
+			}
+		}
+	}()
+
+	results, err := c.createVersionRecovered(input)
+
+	close(done)
+	<-stopped
+
+	job.MigrationsTotal = progress.Total()
+	job.MigrationsApplied = progress.Applied()
+	if err != nil && c.ctx.Err() != nil {
+		common.LogInfo(c.ctx, "Job %v cancelled: %v", job.ID, err)
+		job.State = types.JobStateCancelled
+		job.CancelRequested = true
+		jobError := err.Error()
+		job.Error = &jobError
+	} else if err != nil {
+		common.LogError(c.ctx, "Job %v failed: %v", job.ID, err)
+		job.State = types.JobStateFailed
+		jobError := err.Error()
+		job.Error = &jobError
+	} else {
+		common.LogInfo(c.ctx, "Job %v succeeded", job.ID)
+		job.State = types.JobStateSucceeded
+		job.Results = results
+	}
+	c.updateJob(job)
+}
+
+// FailJob marks job as failed with passed error, it is used when job could not be run
+func (c *coordinator) FailJob(job *types.Job, failure string) {
+	job.State = types.JobStateFailed
+	job.Error = &failure
+	c.updateJob(job)
+}
+
+// GetJob returns state, progress, and results of asynchronous job
+// jobs orphaned by migrator which was stopped while running them are marked as failed first
+func (c *coordinator) GetJob(ID int32) (*types.Job, error) {
+	failure := fmt.Sprintf("job orphaned, no progress stored for more than %v", jobStaleTimeout)
+	if err := c.connector.FailStaleJobs(jobStaleTimeout, failure); err != nil {
+		common.LogError(c.ctx, "Could not fail stale jobs: %v", err)
+	}
+	return c.connector.GetJobByID(ID)
+}
+
+// CancelJob requests cancellation of queued or running asynchronous job, the job is cancelled by the migrator which runs it
+func (c *coordinator) CancelJob(ID int32) (*types.Job, error) {
+	job, err := c.connector.CancelJob(ID)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Requested cancellation of job: %v", ID)
+	return job, nil
+}
+
+// cancelRequested returns true when cancellation of job was requested
+func (c *coordinator) cancelRequested(job *types.Job) bool {
+	stored, err := c.connector.GetJobByID(job.ID)
+	if err != nil {
+		common.LogError(c.ctx, "Could not read job %v: %v", job.ID, err)
+		return false
+	}
+	return stored.CancelRequested
+}
+
+// createVersionRecovered calls CreateVersion and converts panics to errors
+func (c *coordinator) createVersionRecovered(input types.VersionInput) (results *types.CreateResults, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return c.CreateVersion(input)
+}
+
+func (c *coordinator) updateJob(job *types.Job) {
+	if err := c.connector.UpdateJob(job); err != nil {
+		common.LogError(c.ctx, "Could not update job %v: %v", job.ID, err)
+	}
+}
+
+// GetTenantStatus compares source tenant migrations with tenant migrations applied in given tenant
+func (c *coordinator) GetTenantStatus(name string) (*types.TenantStatus, error) {
+	tenants, err := c.selectTenants(&[]string{name}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMigrations := c.GetSourceMigrations(nil)
+	appliedMigrations := c.excludeRolledBackMigrations(c.connector.GetAppliedMigrations())
+
+	status := &types.TenantStatus{
+		Name:              name,
+		MissingMigrations: c.computeMissingTenantMigrations(sourceMigrations, appliedMigrations, tenants)[name],
+		PendingMigrations: []types.Migration{},
+	}
+
+	// key is Migration.File
+	appliedInAnyTenant := map[string]bool{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		appliedInAnyTenant[m.File] = true
+		if m.Schema == name {
+			status.AppliedMigrations++
+		}
+	}
+	for _, m := range sourceMigrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration && !appliedInAnyTenant[m.File] {
+			status.PendingMigrations = append(status.PendingMigrations, m)
+		}
+	}
+
+	return status, nil
+}
+
+// CatchUpTenants creates new DB version by applying missing tenant migrations to lagging tenants
+func (c *coordinator) CatchUpTenants(input types.CatchUpTenantsInput) (*types.CreateResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tenants, err := c.selectTenants(input.Tenants, input.TenantPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMigrations := c.GetSourceMigrations(nil)
+	appliedMigrations := c.connector.GetAppliedMigrations()
+
+	missingMigrations := c.computeMissingTenantMigrations(sourceMigrations, appliedMigrations, tenants)
+
+	// only lagging tenants are caught up
+	tenantMigrationsToApply := map[string][]types.Migration{}
+	for tenant, ms := range missingMigrations {
+		if len(ms) > 0 {
+			tenantMigrationsToApply[tenant] = ms
+		}
+	}
+	migrationsToApply := c.mergeTenantMigrationsToApply(sourceMigrations, []types.Migration{}, tenantMigrationsToApply)
+	migrationsToApply, err = c.sortMigrationsByDependencies(sourceMigrations, appliedMigrations, migrationsToApply)
+	if err != nil {
+		return nil, err
+	}
+	common.LogInfo(c.ctx, "Found missing migrations to apply: %d, lagging tenants: %d", len(migrationsToApply), len(tenantMigrationsToApply))
+
+	summary, version := c.connector.CreateVersion(input.VersionName, input.Action, migrationsToApply, tenantMigrationsToApply, input.DryRun)
+
+	c.recordVersionMetrics(summary)
+
+	c.sendNotification(summary)
+
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+// Repair updates contents and checksum of applied migrations to match their (intentionally modified) source migrations
+// unless confirmed repair runs in dry-run mode, repair is recorded as a new version
+// Repair also returns applied migrations whose source migrations no longer exist
+func (c *coordinator) Repair(input types.RepairInput) (*types.RepairResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	sourceMigrations := c.GetSourceMigrations(nil)
+	appliedMigrations := c.connector.GetAppliedMigrations()
+
+	// key is Migration.File
+	mismatches := map[string]types.CheckSumMismatch{}
+	for _, m := range c.computeCheckSumMismatches(sourceMigrations, appliedMigrations) {
+		mismatches[m.SourceMigration.File] = m
+	}
+
+	migrationsToRepair := []types.CheckSumMismatch{}
+	for _, file := range input.Files {
+		m, ok := mismatches[file]
+		if !ok {
+			return nil, fmt.Errorf("migration does not need repair: %v", file)
+		}
+		migrationsToRepair = append(migrationsToRepair, m)
+	}
+
+	results := &types.RepairResults{
+		Summary:                 &types.Summary{StartedAt: graphql.Time{Time: time.Now()}},
+		MissingSourceMigrations: c.computeMissingSourceMigrations(sourceMigrations, appliedMigrations),
+	}
+
+	if len(migrationsToRepair) == 0 {
+		return results, nil
+	}
+	common.LogInfo(c.ctx, "Found migrations to repair: %d", len(migrationsToRepair))
+
+	results.Summary, results.Version = c.connector.RepairMigrations(input.VersionName, migrationsToRepair, !input.Confirm)
+
+	c.recordRepairMetrics(results.Summary)
+
+	c.sendNotification(results.Summary)
+
+	return results, nil
 }
 
 func (c *coordinator) HealthCheck() types.HealthResponse {
@@ -190,6 +744,22 @@ func (c *coordinator) HealthCheck() types.HealthResponse {
 		response.Status = types.HealthStatusDown
 	}
 
+	// optional missing source migrations check, requires both DB and Loader to be UP
+	if c.config != nil && c.config.MissingSourceMigrationsHealthCheck && response.Status == types.HealthStatusUp {
+		missing := c.GetMissingSourceMigrations()
+		if len(missing) == 0 {
+			checks = append(checks, types.HealthChecks{Name: "MissingSourceMigrations", Status: types.HealthStatusUp})
+		} else {
+			files := []string{}
+			for _, m := range missing {
+				files = append(files, m.File)
+			}
+			details := fmt.Sprintf("applied migrations missing from source migrations: %v", strings.Join(files, ", "))
+			checks = append(checks, types.HealthChecks{Name: "MissingSourceMigrations", Status: types.HealthStatusDown, Data: &types.HealthData{Details: details}})
+			response.Status = types.HealthStatusDown
+		}
+	}
+
 	response.Checks = checks
 
 	return response
@@ -197,13 +767,24 @@ func (c *coordinator) HealthCheck() types.HealthResponse {
 
 func (c *coordinator) Dispose() {
 	c.connector.Dispose()
+	if c.cancel != nil {
+		c.cancel()
+	}
 }
 
+// flattenAppliedMigrations removes consecutive duplicates (the same migration applied in multiple schemas)
+// applied migrations are fetched sorted lexically, for other version ordering strategies they are re-sorted first
 func (c *coordinator) flattenAppliedMigrations(appliedMigrations []types.DBMigration) []types.Migration {
+	if ordering := c.getVersionOrdering(); ordering != config.VersionOrderingLexical {
+		appliedMigrations = append([]types.DBMigration{}, appliedMigrations...)
+		sort.SliceStable(appliedMigrations, func(i, j int) bool {
+			return loader.CompareNames(ordering, appliedMigrations[i].Name, appliedMigrations[j].Name) < 0
+		})
+	}
 	var flattened []types.Migration
 	var previousMigration types.Migration
 	for i, m := range appliedMigrations {
-		if i == 0 || m.Migration != previousMigration {
+		if i == 0 || !reflect.DeepEqual(m.Migration, previousMigration) {
 			flattened = append(flattened, m.Migration)
 			previousMigration = m.Migration
 		}
@@ -238,16 +819,32 @@ func (c *coordinator) intersect(sourceMigrations []types.Migration, flattenedApp
 
 // difference returns the elements on disk which are not yet in DB
 // the exceptions are MigrationTypeSingleScript and MigrationTypeTenantScript which are always run
+// and repeatables which are run when their CheckSum differs from the CheckSum of the last applied repeatable
+// (superseded repeatables must be excluded from flattenedAppliedMigrations using excludeSupersededRepeatables)
 func (c *coordinator) difference(sourceMigrations []types.Migration, flattenedAppliedMigrations []types.Migration) []types.Migration {
 	// key is Migration.File
 	existsInDB := map[string]bool{}
+	// key is Migration.File and Migration.CheckSum
+	repeatableInDB := map[string]bool{}
 	for _, m := range flattenedAppliedMigrations {
-		if m.MigrationType != types.MigrationTypeSingleScript && m.MigrationType != types.MigrationTypeTenantScript {
+		if isRepeatable(m.MigrationType) {
+			repeatableInDB[m.File+"/"+m.CheckSum] = true
+		} else if m.MigrationType != types.MigrationTypeSingleScript && m.MigrationType != types.MigrationTypeTenantScript {
 			existsInDB[m.File] = true
 		}
 	}
 	diff := []types.Migration{}
 	for _, m := range sourceMigrations {
+		// callbacks are never pending, they are added to versions by CreateVersion and CreateTenant
+		if m.MigrationType == types.MigrationTypeCallback {
+			continue
+		}
+		if isRepeatable(m.MigrationType) {
+			if !repeatableInDB[m.File+"/"+m.CheckSum] {
+				diff = append(diff, m)
+			}
+			continue
+		}
 		if _, ok := existsInDB[m.File]; !ok {
 			diff = append(diff, m)
 		}
@@ -255,8 +852,92 @@ func (c *coordinator) difference(sourceMigrations []types.Migration, flattenedAp
 	return diff
 }
 
+// excludeSupersededRepeatables returns applied DB migrations without repeatables which were applied again later
+// (in the same schema), for every repeatable only the last applied entry is returned
+func (c *coordinator) excludeSupersededRepeatables(appliedMigrations []types.DBMigration) []types.DBMigration {
+	// key is Migration.File and DBMigration.Schema, value is index of the last applied repeatable
+	last := map[string]int{}
+	for i, m := range appliedMigrations {
+		if !isRepeatable(m.MigrationType) {
+			continue
+		}
+		key := m.File + "/" + m.Schema
+		if j, ok := last[key]; !ok || !m.Created.Time.Before(appliedMigrations[j].Created.Time) {
+			last[key] = i
+		}
+	}
+	out := []types.DBMigration{}
+	for i, m := range appliedMigrations {
+		if !isRepeatable(m.MigrationType) || last[m.File+"/"+m.Schema] == i {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// isRepeatable returns true for scripts which are applied only when their CheckSum changed
+func isRepeatable(migrationType types.MigrationType) bool {
+	return migrationType == types.MigrationTypeSingleRepeatable || migrationType == types.MigrationTypeTenantRepeatable
+}
+
+// excludeRolledBackMigrations returns applied DB migrations which were not rolled back
+// rollback entries and audit entries (repairs, tenant deletions) are also excluded
+func (c *coordinator) excludeRolledBackMigrations(appliedMigrations []types.DBMigration) []types.DBMigration {
+	// key is Migration.File and DBMigration.Schema
+	applied := map[string]int{}
+	for _, m := range appliedMigrations {
+		if isAuditEntry(m.MigrationType) {
+			continue
+		}
+		key := m.File + "/" + m.Schema
+		if m.MigrationType == types.MigrationTypeRollback {
+			applied[key]--
+		} else {
+			applied[key]++
+		}
+	}
+	out := []types.DBMigration{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType != types.MigrationTypeRollback && !isAuditEntry(m.MigrationType) && applied[m.File+"/"+m.Schema] > 0 {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// isAuditEntry returns true for DB entries which only record operations performed by migrator
+func isAuditEntry(migrationType types.MigrationType) bool {
+	return migrationType == types.MigrationTypeRepair || migrationType == types.MigrationTypeTenantDeletion || migrationType == types.MigrationTypeTenantFailure
+}
+
+// computeMissingSourceMigrations returns applied DB migrations (one per file) whose source migrations no longer exist
+// for example when the source file was deleted or was not synced to the loader's storage
+func (c *coordinator) computeMissingSourceMigrations(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []types.DBMigration {
+	appliedMigrations = c.excludeRolledBackMigrations(appliedMigrations)
+
+	// key is Migration.File
+	exists := map[string]bool{}
+	for _, m := range sourceMigrations {
+		exists[m.File] = true
+	}
+
+	missing := []types.DBMigration{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		if !exists[m.File] {
+			missing = append(missing, m)
+			// report every file only once
+			exists[m.File] = true
+		}
+	}
+	return missing
+}
+
 // computeMigrationsToApply computes which source migrations should be applied to DB based on migrations already present in DB
 func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration) []types.Migration {
+	appliedMigrations = c.excludeSupersededRepeatables(c.excludeRolledBackMigrations(appliedMigrations))
 	flattenedAppliedMigrations := c.flattenAppliedMigrations(appliedMigrations)
 
 	len := len(flattenedAppliedMigrations)
@@ -266,11 +947,366 @@ func (c *coordinator) computeMigrationsToApply(sourceMigrations []types.Migratio
 	return out
 }
 
+// computeOutOfOrderMigrations returns files of migrations to apply which sort before the latest applied migration from the same source directory
+// migrations already applied in some of the schemas (for example applied to a subset of tenants) are not out-of-order
+func (c *coordinator) computeOutOfOrderMigrations(migrationsToApply []types.Migration, appliedMigrations []types.DBMigration) []string {
+	appliedMigrations = c.excludeRolledBackMigrations(appliedMigrations)
+	ordering := c.getVersionOrdering()
+
+	// key is Migration.File
+	applied := map[string]bool{}
+	// key is Migration.SourceDir, value is the latest applied Migration.Name
+	latestApplied := map[string]string{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		applied[m.File] = true
+		if latest, ok := latestApplied[m.SourceDir]; !ok || loader.CompareNames(ordering, m.Name, latest) > 0 {
+			latestApplied[m.SourceDir] = m.Name
+		}
+	}
+
+	var outOfOrder []string
+	for _, m := range migrationsToApply {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		if latest, ok := latestApplied[m.SourceDir]; ok && !applied[m.File] && loader.CompareNames(ordering, m.Name, latest) < 0 {
+			outOfOrder = append(outOfOrder, m.File)
+		}
+	}
+	return outOfOrder
+}
+
+// getVersionOrdering returns version ordering strategy from config, coordinator created without config uses lexical ordering
+func (c *coordinator) getVersionOrdering() string {
+	if c.config == nil {
+		return config.VersionOrderingLexical
+	}
+	return c.config.GetVersionOrdering()
+}
+
+// getContexts returns optional VersionInput override or contexts from config
+func (c *coordinator) getContexts(contexts *[]string) []string {
+	if contexts != nil {
+		return *contexts
+	}
+	if c.config == nil {
+		return nil
+	}
+	return c.config.Contexts
+}
+
+// filterMigrationsByContexts removes migrations whose labels don't match passed contexts, returns files of removed migrations
+func (c *coordinator) filterMigrationsByContexts(migrations []types.Migration, contexts []string) ([]types.Migration, []string) {
+	filtered := []types.Migration{}
+	skipped := []string{}
+	for _, m := range migrations {
+		if m.MatchesContexts(contexts) {
+			filtered = append(filtered, m)
+		} else {
+			skipped = append(skipped, m.File)
+		}
+	}
+	return filtered, skipped
+}
+
+func (c *coordinator) getOutOfOrderPolicy() string {
+	if c.config == nil {
+		return config.OutOfOrderAllow
+	}
+	return c.config.GetOutOfOrder()
+}
+
+// computeTenantMigrationsToApply computes which tenant migrations & scripts should be applied to each of the passed tenants
+// tenant migration is pending in a tenant when it is not applied in that tenant and either it was not applied to any tenant yet
+// or it sorts after the last tenant migration applied in that tenant (the tenant was skipped by a version applied to a subset of tenants),
+// tenant without any tenant migrations applied was skipped by all versions and all tenant migrations are pending in it
+// tenant repeatable is pending in a tenant when its CheckSum differs from the CheckSum of the last repeatable applied in that tenant
+// migrations & scripts whose tenant selectors don't match tenant's metadata are never applied to that tenant
+func (c *coordinator) computeTenantMigrationsToApply(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant) map[string][]types.Migration {
+	appliedMigrations = c.excludeSupersededRepeatables(c.excludeRolledBackMigrations(appliedMigrations))
+
+	// key is Migration.File, value is position in source migrations
+	positions := map[string]int{}
+	for i, m := range sourceMigrations {
+		positions[m.File] = i
+	}
+
+	// key is Migration.File and DBMigration.Schema
+	appliedInTenant := map[string]bool{}
+	// key is Migration.File
+	appliedInAnyTenant := map[string]bool{}
+	// key is DBMigration.Schema, value is position of the last applied source migration
+	lastAppliedInTenant := map[string]int{}
+	// key is Migration.File and DBMigration.Schema, value is CheckSum of the last applied tenant repeatable
+	repeatableCheckSums := map[string]string{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType == types.MigrationTypeTenantRepeatable {
+			repeatableCheckSums[m.File+"/"+m.Schema] = m.CheckSum
+		}
+		if m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		appliedInTenant[m.File+"/"+m.Schema] = true
+		appliedInAnyTenant[m.File] = true
+		if position, ok := positions[m.File]; ok {
+			if last, ok := lastAppliedInTenant[m.Schema]; !ok || position > last {
+				lastAppliedInTenant[m.Schema] = position
+			}
+		}
+	}
+
+	tenantMigrations := map[string][]types.Migration{}
+	for _, t := range tenants {
+		pending := []types.Migration{}
+		last, ok := lastAppliedInTenant[t.Name]
+		if !ok {
+			last = -1
+		}
+		for i, m := range sourceMigrations {
+			if !m.MatchesTenant(t) {
+				continue
+			}
+			if m.MigrationType == types.MigrationTypeTenantScript {
+				pending = append(pending, m)
+			}
+			if m.MigrationType == types.MigrationTypeTenantRepeatable && repeatableCheckSums[m.File+"/"+t.Name] != m.CheckSum {
+				pending = append(pending, m)
+			}
+			if m.MigrationType != types.MigrationTypeTenantMigration || appliedInTenant[m.File+"/"+t.Name] {
+				continue
+			}
+			if !appliedInAnyTenant[m.File] || i > last {
+				pending = append(pending, m)
+			}
+		}
+		tenantMigrations[t.Name] = pending
+	}
+
+	return tenantMigrations
+}
+
+// computeMissingTenantMigrations computes for each of the passed tenants tenant migrations
+// which were applied in at least one tenant but were not applied in that tenant (and are selected by tenant's metadata)
+func (c *coordinator) computeMissingTenantMigrations(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration, tenants []types.Tenant) map[string][]types.Migration {
+	appliedMigrations = c.excludeRolledBackMigrations(appliedMigrations)
+
+	// key is Migration.File and DBMigration.Schema
+	appliedInTenant := map[string]bool{}
+	// key is Migration.File
+	appliedInAnyTenant := map[string]bool{}
+	for _, m := range appliedMigrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			appliedInTenant[m.File+"/"+m.Schema] = true
+			appliedInAnyTenant[m.File] = true
+		}
+	}
+
+	missingMigrations := map[string][]types.Migration{}
+	for _, t := range tenants {
+		missing := []types.Migration{}
+		for _, m := range sourceMigrations {
+			if m.MigrationType == types.MigrationTypeTenantMigration && appliedInAnyTenant[m.File] && !appliedInTenant[m.File+"/"+t.Name] && m.MatchesTenant(t) {
+				missing = append(missing, m)
+			}
+		}
+		missingMigrations[t.Name] = missing
+	}
+
+	return missingMigrations
+}
+
+// mergeTenantMigrationsToApply replaces tenant migrations & repeatables computed by computeMigrationsToApply
+// with tenant migrations & repeatables which are pending in at least one of the tenants, source migrations order is preserved
+func (c *coordinator) mergeTenantMigrationsToApply(sourceMigrations []types.Migration, migrationsToApply []types.Migration, tenantMigrations map[string][]types.Migration) []types.Migration {
+	// key is Migration.File
+	pending := map[string]bool{}
+	for _, m := range migrationsToApply {
+		if m.MigrationType != types.MigrationTypeTenantMigration && m.MigrationType != types.MigrationTypeTenantRepeatable {
+			pending[m.File] = true
+		}
+	}
+	for _, ms := range tenantMigrations {
+		for _, m := range ms {
+			pending[m.File] = true
+		}
+	}
+	merged := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if pending[m.File] {
+			merged = append(merged, m)
+		}
+	}
+	return merged
+}
+
+// filterTenantMigrationsToApply removes from tenant migrations all migrations which are not present in migrations to apply
+func (c *coordinator) filterTenantMigrationsToApply(tenantMigrations map[string][]types.Migration, migrationsToApply []types.Migration) map[string][]types.Migration {
+	// key is Migration.File
+	toApply := map[string]bool{}
+	for _, m := range migrationsToApply {
+		toApply[m.File] = true
+	}
+	filtered := map[string][]types.Migration{}
+	for tenant, ms := range tenantMigrations {
+		filtered[tenant] = []types.Migration{}
+		for _, m := range ms {
+			if toApply[m.File] {
+				filtered[tenant] = append(filtered[tenant], m)
+			}
+		}
+	}
+	return filtered
+}
+
+// selectTenants returns tenants with passed names or tenants which names match passed pattern
+// if both names and pattern are nil all tenants are returned
+func (c *coordinator) selectTenants(names *[]string, pattern *string) ([]types.Tenant, error) {
+	if names != nil && pattern != nil {
+		return nil, errors.New("tenants and tenantPattern cannot be used together")
+	}
+
+	allTenants := c.GetTenants()
+
+	if names != nil {
+		existing := map[string]types.Tenant{}
+		for _, t := range allTenants {
+			existing[t.Name] = t
+		}
+		selected := []types.Tenant{}
+		for _, name := range *names {
+			t, ok := existing[name]
+			if !ok {
+				return nil, fmt.Errorf("tenant not found: %v", name)
+			}
+			selected = append(selected, t)
+		}
+		return selected, nil
+	}
+
+	if pattern != nil {
+		// path.Match returns error only for malformed patterns, validate it upfront
+		if _, err := path.Match(*pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid tenant pattern %v: %v", *pattern, err)
+		}
+		selected := []types.Tenant{}
+		for _, t := range allTenants {
+			if matched, _ := path.Match(*pattern, t.Name); matched {
+				selected = append(selected, t)
+			}
+		}
+		return selected, nil
+	}
+
+	return allTenants, nil
+}
+
+// filterMigrationsUpToTarget returns migrations to apply which sort at or before target source migration
+// target can be either source migration name or file, scripts are always returned
+func (c *coordinator) filterMigrationsUpToTarget(sourceMigrations []types.Migration, migrationsToApply []types.Migration, target string) ([]types.Migration, error) {
+	// key is Migration.File, value is position in source migrations
+	positions := map[string]int{}
+	targetPosition := -1
+	for i, m := range sourceMigrations {
+		positions[m.File] = i
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeTenantMigration {
+			continue
+		}
+		// when name is used as a target all migrations with the same name are included
+		if m.File == target || m.Name == target {
+			targetPosition = i
+		}
+	}
+	if targetPosition == -1 {
+		return nil, fmt.Errorf("target source migration not found: %v", target)
+	}
+
+	filtered := []types.Migration{}
+	for _, m := range migrationsToApply {
+		if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeTenantScript || isRepeatable(m.MigrationType) || positions[m.File] <= targetPosition {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered, nil
+}
+
+// sortMigrationsByDependencies orders migrations to apply so that every migration is applied after the pending migrations
+// it depends on, migrations without dependencies keep their original order
+// every dependency must exist in source migrations and must be either already applied or pending
+func (c *coordinator) sortMigrationsByDependencies(sourceMigrations []types.Migration, appliedMigrations []types.DBMigration, migrationsToApply []types.Migration) ([]types.Migration, error) {
+	appliedMigrations = c.excludeRolledBackMigrations(appliedMigrations)
+
+	// key is Migration.File
+	inSource := map[string]bool{}
+	for _, m := range sourceMigrations {
+		inSource[m.File] = true
+	}
+	// key is Migration.File
+	applied := map[string]bool{}
+	for _, m := range appliedMigrations {
+		applied[m.File] = true
+	}
+	// key is Migration.File
+	pending := map[string]types.Migration{}
+	for _, m := range migrationsToApply {
+		pending[m.File] = m
+	}
+
+	for _, m := range migrationsToApply {
+		for _, dependency := range m.DependsOn {
+			if !inSource[dependency] {
+				return nil, fmt.Errorf("migration %v depends on %v which does not exist in source migrations", m.File, dependency)
+			}
+			if _, ok := pending[dependency]; !ok && !applied[dependency] {
+				return nil, fmt.Errorf("migration %v depends on %v which is neither applied nor pending", m.File, dependency)
+			}
+		}
+	}
+
+	sorted := []types.Migration{}
+	// key is Migration.File
+	visited := map[string]bool{}
+	// files of migrations currently being visited, used to report cycles
+	var path []string
+	var visit func(m types.Migration) error
+	visit = func(m types.Migration) error {
+		if visited[m.File] {
+			return nil
+		}
+		for i, file := range path {
+			if file == m.File {
+				return fmt.Errorf("dependency cycle detected: %v", strings.Join(append(path[i:], m.File), " -> "))
+			}
+		}
+		path = append(path, m.File)
+		for _, dependency := range m.DependsOn {
+			if d, ok := pending[dependency]; ok {
+				if err := visit(d); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		visited[m.File] = true
+		sorted = append(sorted, m)
+		return nil
+	}
+
+	for _, m := range migrationsToApply {
+		if err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
 // filterTenantMigrations returns only migrations which are of type MigrationTypeTenantSchema
 func (c *coordinator) filterTenantMigrations(sourceMigrations []types.Migration) []types.Migration {
 	filteredTenantMigrations := []types.Migration{}
 	for _, m := range sourceMigrations {
-		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
+		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript || m.MigrationType == types.MigrationTypeTenantRepeatable {
 			filteredTenantMigrations = append(filteredTenantMigrations, m)
 		}
 	}
@@ -278,6 +1314,36 @@ func (c *coordinator) filterTenantMigrations(sourceMigrations []types.Migration)
 	return filteredTenantMigrations
 }
 
+// countMigrationsToApply returns the number of migrations & scripts (for all tenants) which are going to be applied
+func countMigrationsToApply(migrationsToApply []types.Migration, tenantMigrationsToApply map[string][]types.Migration) int32 {
+	var total int32
+	for _, m := range migrationsToApply {
+		if m.MigrationType == types.MigrationTypeSingleMigration || m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeSingleRepeatable {
+			total++
+		}
+	}
+	for _, ms := range tenantMigrationsToApply {
+		total += int32(len(ms))
+	}
+	return total
+}
+
+// filterCallbacks returns callbacks which are executed at passed events
+func (c *coordinator) filterCallbacks(sourceMigrations []types.Migration, events ...types.CallbackEvent) []types.Migration {
+	callbacks := []types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType != types.MigrationTypeCallback {
+			continue
+		}
+		for _, event := range events {
+			if m.CallbackEvent() == event {
+				callbacks = append(callbacks, m)
+			}
+		}
+	}
+	return callbacks
+}
+
 // errors are silently discarded, adding tenant or applying migrations
 // must not fail because of notification error
 func (c *coordinator) sendNotification(results *types.Summary) {
@@ -330,6 +1396,11 @@ func (c *coordinator) recordTenantMetrics(summary *types.Summary) {
 	c.recordVersionMetrics(summary)
 }
 
+func (c *coordinator) recordTenantDeletionMetrics(summary *types.Summary) {
+	c.metrics.AddGaugeValue("tenants_deleted", []string{}, float64(summary.TenantsDeleted))
+	c.metrics.IncrementGaugeValue("versions_created", []string{})
+}
+
 func (c *coordinator) recordVersionMetrics(summary *types.Summary) {
 	c.metrics.IncrementGaugeValue("versions_created", []string{})
 	c.metrics.AddGaugeValue("migrations_applied", []string{"single_scripts"}, float64(summary.SingleScripts))
@@ -338,4 +1409,15 @@ func (c *coordinator) recordVersionMetrics(summary *types.Summary) {
 	c.metrics.AddGaugeValue("migrations_applied", []string{"single_migrations"}, float64(summary.SingleMigrations))
 	// total is for all tenants in the system
 	c.metrics.AddGaugeValue("migrations_applied", []string{"tenant_migrations_total"}, float64(summary.TenantMigrationsTotal))
+	c.metrics.AddGaugeValue("tenants_failed", []string{}, float64(summary.TenantsFailed))
+}
+
+func (c *coordinator) recordRollbackMetrics(summary *types.Summary) {
+	c.metrics.IncrementGaugeValue("versions_created", []string{})
+	c.metrics.AddGaugeValue("migrations_rolled_back", []string{}, float64(summary.MigrationsRolledBack))
+}
+
+func (c *coordinator) recordRepairMetrics(summary *types.Summary) {
+	c.metrics.IncrementGaugeValue("versions_created", []string{})
+	c.metrics.AddGaugeValue("migrations_repaired", []string{}, float64(summary.MigrationsRepaired))
 }
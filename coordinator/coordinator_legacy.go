@@ -0,0 +1,273 @@
+package coordinator
+
+import (
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/loader"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// ImportHistory reads history tables of legacy migration tool from single schemas and tenant schemas
+// and creates a Sync version containing only source migrations which the legacy tool applied
+// entries which were not matched to source migrations (or which failed) are returned as unmatched entries
+func (c *coordinator) ImportHistory(input types.ImportHistoryInput) (*types.ImportHistoryResults, error) {
+	unlock, err := c.connector.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tenants, err := c.selectTenants(input.Tenants, input.TenantPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMigrations := c.GetSourceMigrations(nil)
+	appliedMigrations := c.connector.GetAppliedMigrations()
+
+	table := input.Tool.HistoryTable()
+	if input.Table != nil {
+		table = *input.Table
+	}
+
+	// by default every single schema has its own history table
+	singleSchemas := c.singleSchemas(sourceMigrations)
+	if input.Schema != nil {
+		singleSchemas = []string{*input.Schema}
+	}
+	isTenant := map[string]bool{}
+	schemas := append([]string{}, singleSchemas...)
+	for _, t := range tenants {
+		isTenant[t.Name] = true
+		schemas = append(schemas, t.Name)
+	}
+
+	entries := c.connector.GetLegacyHistory(input.Tool, table, schemas)
+	common.LogInfo(c.ctx, "Found %v history entries: %d", input.Tool, len(entries))
+
+	matchedSingle, matchedTenant, unmatched := c.matchLegacyHistory(input.Tool, sourceMigrations, entries, isTenant, input.Schema == nil)
+
+	// migrations already recorded by migrator are not imported again
+	// key is Migration.File for single migrations and Migration.File and DBMigration.Schema for tenant migrations
+	applied := map[string]bool{}
+	for _, m := range c.excludeRolledBackMigrations(appliedMigrations) {
+		applied[m.File] = true
+		applied[m.File+"/"+m.Schema] = true
+	}
+
+	migrationsToSync := []types.Migration{}
+	tenantMigrationsToSync := map[string][]types.Migration{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType == types.MigrationTypeSingleMigration || m.MigrationType == types.MigrationTypeSingleRepeatable {
+			if matchedSingle[m.File] && !applied[m.File] {
+				migrationsToSync = append(migrationsToSync, m)
+			}
+			continue
+		}
+		synced := false
+		for _, t := range tenants {
+			if matchedTenant[t.Name][m.File] && !applied[m.File+"/"+t.Name] {
+				tenantMigrationsToSync[t.Name] = append(tenantMigrationsToSync[t.Name], m)
+				synced = true
+			}
+		}
+		if synced {
+			migrationsToSync = append(migrationsToSync, m)
+		}
+	}
+
+	results := &types.ImportHistoryResults{
+		Summary:          &types.Summary{StartedAt: graphql.Time{Time: time.Now()}},
+		UnmatchedEntries: unmatched,
+	}
+
+	if len(migrationsToSync) == 0 {
+		return results, nil
+	}
+	common.LogInfo(c.ctx, "Found migrations to import: %d, unmatched entries: %d", len(migrationsToSync), len(unmatched))
+
+	results.Summary, results.Version = c.connector.CreateVersion(input.VersionName, types.ActionSync, migrationsToSync, tenantMigrationsToSync, input.DryRun)
+
+	c.recordVersionMetrics(results.Summary)
+
+	c.sendNotification(results.Summary)
+
+	return results, nil
+}
+
+// singleSchemas returns sorted schemas of single migrations, schema is the name of migration's source dir
+func (c *coordinator) singleSchemas(sourceMigrations []types.Migration) []string {
+	schemas := []string{}
+	seen := map[string]bool{}
+	for _, m := range sourceMigrations {
+		if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeSingleRepeatable {
+			continue
+		}
+		schema := filepath.Base(m.SourceDir)
+		if !seen[schema] {
+			seen[schema] = true
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+// matchLegacyHistory maps entries of legacy history table to source migrations
+// entries from tenant schemas are matched to tenant migrations & repeatables, other entries to single migrations & repeatables
+// when perSchema is true entries from a single schema are matched only to migrations from the source dir of the same name
+// returns files of matched single migrations, files of matched tenant migrations (key is tenant), and unmatched entries
+func (c *coordinator) matchLegacyHistory(tool types.LegacyTool, sourceMigrations []types.Migration, entries []types.LegacyHistoryEntry, isTenant map[string]bool, perSchema bool) (map[string]bool, map[string]map[string]bool, []types.LegacyHistoryEntry) {
+	matchedSingle := map[string]bool{}
+	matchedTenant := map[string]map[string]bool{}
+	unmatched := []types.LegacyHistoryEntry{}
+
+	for _, e := range entries {
+		matched := matchedSingle
+		if isTenant[e.Schema] {
+			if matchedTenant[e.Schema] == nil {
+				matchedTenant[e.Schema] = map[string]bool{}
+			}
+			matched = matchedTenant[e.Schema]
+		}
+
+		candidates := []types.Migration{}
+		for _, m := range sourceMigrations {
+			if isTenant[e.Schema] {
+				if m.MigrationType != types.MigrationTypeTenantMigration && m.MigrationType != types.MigrationTypeTenantRepeatable {
+					continue
+				}
+			} else {
+				if m.MigrationType != types.MigrationTypeSingleMigration && m.MigrationType != types.MigrationTypeSingleRepeatable {
+					continue
+				}
+				if perSchema && filepath.Base(m.SourceDir) != e.Schema {
+					continue
+				}
+			}
+			// every entry is matched to a different migration, golang-migrate entries cover all migrations up to their version
+			if !matched[m.File] || tool == types.LegacyToolGolangMigrate {
+				candidates = append(candidates, m)
+			}
+		}
+
+		files, ok := matchLegacyEntry(tool, e, candidates)
+		for _, file := range files {
+			matched[file] = true
+		}
+		if !ok {
+			unmatched = append(unmatched, e)
+		}
+	}
+
+	return matchedSingle, matchedTenant, unmatched
+}
+
+// matchLegacyEntry returns files of source migrations applied according to legacy history entry
+// and whether the entry itself was matched, failed entries are never matched
+func matchLegacyEntry(tool types.LegacyTool, e types.LegacyHistoryEntry, candidates []types.Migration) ([]string, bool) {
+	if tool == types.LegacyToolGolangMigrate {
+		return matchGolangMigrateEntry(e, candidates)
+	}
+	if !e.Success {
+		return nil, false
+	}
+
+	var matchers []func(types.Migration) bool
+	switch tool {
+	case types.LegacyToolLiquibase:
+		// Liquibase MD5 sums are computed from parsed changesets, not from file contents, changesets are matched by file name or id
+		matchers = []func(types.Migration) bool{
+			func(m types.Migration) bool { return e.Script != "" && filepath.Base(e.Script) == m.Name },
+			func(m types.Migration) bool {
+				return e.Version == m.Name || e.Version == strings.TrimSuffix(m.Name, filepath.Ext(m.Name))
+			},
+		}
+	default:
+		matchers = []func(types.Migration) bool{
+			// repeatables are matched only when they were not modified after legacy tool applied them
+			func(m types.Migration) bool {
+				return e.Script != "" && filepath.Base(e.Script) == m.Name && (!isRepeatable(m.MigrationType) || e.CheckSum == flywayCheckSum(m.Contents))
+			},
+			func(m types.Migration) bool {
+				return e.Version != "" && !isRepeatable(m.MigrationType) && sameVersion("V"+e.Version+".sql", m.Name)
+			},
+			func(m types.Migration) bool { return e.CheckSum != "" && e.CheckSum == flywayCheckSum(m.Contents) },
+		}
+	}
+
+	for _, match := range matchers {
+		for _, m := range candidates {
+			if match(m) {
+				return []string{m.File}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// matchGolangMigrateEntry returns files of migrations up to golang-migrate version (the only entry in schema_migrations table)
+// when version is dirty its migration failed and only migrations before it are returned
+func matchGolangMigrateEntry(e types.LegacyHistoryEntry, candidates []types.Migration) ([]string, bool) {
+	version, err := strconv.ParseUint(e.Version, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	files := []string{}
+	found := false
+	for _, m := range candidates {
+		v, ok := leadingNumber(m.Name)
+		if !ok {
+			continue
+		}
+		if v < version || v == version && e.Success {
+			files = append(files, m.File)
+		}
+		if v == version {
+			found = true
+		}
+	}
+	return files, found && e.Success
+}
+
+// leadingNumber returns number which migration name starts with, for example 201602160001 for 201602160001_create_users.up.sql
+func leadingNumber(name string) (uint64, bool) {
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end == -1 {
+		end = len(name)
+	}
+	n, err := strconv.ParseUint(name[:end], 10, 64)
+	return n, err == nil
+}
+
+// sameVersion returns true when both names have the same numeric version, for example V1.2.sql and V1_2__create_users.sql
+func sameVersion(a, b string) bool {
+	va, okA := loader.ParseVersion(config.VersionOrderingSemver, a)
+	vb, okB := loader.ParseVersion(config.VersionOrderingSemver, b)
+	return okA && okB && strings.Join(va, ".") == strings.Join(vb, ".")
+}
+
+// flywayCheckSum computes Flyway checksum of migration contents: CRC32 of all lines (without line breaks and BOM) as signed int
+func flywayCheckSum(contents string) string {
+	contents = strings.TrimPrefix(contents, "\uFEFF")
+	contents = strings.ReplaceAll(contents, "\r\n", "\n")
+	contents = strings.ReplaceAll(contents, "\r", "\n")
+	lines := strings.Split(contents, "\n")
+	// like Java's BufferedReader.readLine trailing line break does not start a new line
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	crc := crc32.NewIEEE()
+	for _, line := range lines {
+		crc.Write([]byte(line))
+	}
+	return fmt.Sprint(int32(crc.Sum32()))
+}
@@ -0,0 +1,115 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+func TestImportHistoryFlyway(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ImportHistory(types.ImportHistoryInput{VersionName: "import", Tool: types.LegacyToolFlyway})
+	assert.Nil(t, err)
+	assert.Equal(t, "import", results.Version.Name)
+	// source/201602220000.sql was already applied by migrator
+	assert.Len(t, results.Version.DBMigrations, 3)
+	// matched by checksum
+	assert.Equal(t, "source/201602220001.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, "source", results.Version.DBMigrations[0].Schema)
+	assert.Equal(t, "config/201602220001.sql", results.Version.DBMigrations[1].File)
+	assert.Equal(t, "config", results.Version.DBMigrations[1].Schema)
+	assert.Equal(t, "tenant/201602220003.sql", results.Version.DBMigrations[2].File)
+	assert.Equal(t, "a", results.Version.DBMigrations[2].Schema)
+	assert.Len(t, results.UnmatchedEntries, 2)
+	assert.Equal(t, "<< Flyway Baseline >>", results.UnmatchedEntries[0].Script)
+	assert.Equal(t, "b", results.UnmatchedEntries[1].Schema)
+	assert.False(t, results.UnmatchedEntries[1].Success)
+}
+
+func TestImportHistoryGolangMigrate(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ImportHistory(types.ImportHistoryInput{VersionName: "import", Tool: types.LegacyToolGolangMigrate})
+	assert.Nil(t, err)
+	assert.Len(t, results.Version.DBMigrations, 2)
+	assert.Equal(t, "source/201602220001.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, "tenant/201602220003.sql", results.Version.DBMigrations[1].File)
+	assert.Equal(t, "a", results.Version.DBMigrations[1].Schema)
+	// dirty version in tenant b
+	assert.Len(t, results.UnmatchedEntries, 1)
+	assert.Equal(t, "b", results.UnmatchedEntries[0].Schema)
+}
+
+func TestImportHistorySelectedTenantsAndSchema(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	schema := "public"
+	results, err := coordinator.ImportHistory(types.ImportHistoryInput{VersionName: "import", Tool: types.LegacyToolFlyway, Schema: &schema, Tenants: &[]string{"a"}})
+	assert.Nil(t, err)
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", results.Version.DBMigrations[0].File)
+	assert.Empty(t, results.UnmatchedEntries)
+}
+
+func TestImportHistoryNothingToImport(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	// there are no history tables in public schema and in tenant c
+	schema := "public"
+	results, err := coordinator.ImportHistory(types.ImportHistoryInput{VersionName: "import", Tool: types.LegacyToolFlyway, Schema: &schema, Tenants: &[]string{"c"}})
+	assert.Nil(t, err)
+	assert.Nil(t, results.Version)
+	assert.Empty(t, results.UnmatchedEntries)
+}
+
+func TestImportHistoryTenantsAndTenantPatternError(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	pattern := "a*"
+	_, err := coordinator.ImportHistory(types.ImportHistoryInput{VersionName: "import", Tool: types.LegacyToolFlyway, Tenants: &[]string{"a"}, TenantPattern: &pattern})
+	assert.Equal(t, "tenants and tenantPattern cannot be used together", err.Error())
+}
+
+func TestMatchLegacyEntry(t *testing.T) {
+	m1 := types.Migration{Name: "V1_1__create_users.sql", File: "public/V1_1__create_users.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table users"}
+	m2 := types.Migration{Name: "changelog-2.sql", File: "public/changelog-2.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table orders"}
+	m3 := types.Migration{Name: "R__users_view.sql", File: "public/R__users_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, Contents: "create or replace view users_view"}
+	candidates := []types.Migration{m1, m2, m3}
+
+	// Flyway version 1.1 is the same as V1_1
+	files, ok := matchLegacyEntry(types.LegacyToolFlyway, types.LegacyHistoryEntry{Version: "1.1", Script: "V1_1__users.sql", Success: true}, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, []string{m1.File}, files)
+
+	// modified repeatable is not matched and will be applied again
+	_, ok = matchLegacyEntry(types.LegacyToolFlyway, types.LegacyHistoryEntry{Script: "R__users_view.sql", CheckSum: flywayCheckSum("create view users_view"), Success: true}, candidates)
+	assert.False(t, ok)
+	files, ok = matchLegacyEntry(types.LegacyToolFlyway, types.LegacyHistoryEntry{Script: "R__users_view.sql", CheckSum: flywayCheckSum(m3.Contents), Success: true}, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, []string{m3.File}, files)
+
+	// Liquibase changesets are matched by changelog file or id
+	files, ok = matchLegacyEntry(types.LegacyToolLiquibase, types.LegacyHistoryEntry{Version: "1", Script: "db/changelog/changelog-2.sql", Success: true}, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, []string{m2.File}, files)
+	files, ok = matchLegacyEntry(types.LegacyToolLiquibase, types.LegacyHistoryEntry{Version: "V1_1__create_users", Script: "db.changelog-master.xml", Success: true}, candidates)
+	assert.True(t, ok)
+	assert.Equal(t, []string{m1.File}, files)
+	_, ok = matchLegacyEntry(types.LegacyToolLiquibase, types.LegacyHistoryEntry{Version: "V1_1__create_users", Script: "db.changelog-master.xml", Success: false}, candidates)
+	assert.False(t, ok)
+}
+
+func TestFlywayCheckSum(t *testing.T) {
+	expected := int32(crc32.ChecksumIEEE([]byte("create table abc (id int);select 1;")))
+	assert.Equal(t, "0", flywayCheckSum(""))
+	// line breaks and BOM are not part of checksum
+	assert.Equal(t, flywayCheckSum("create table abc (id int);\nselect 1;"), flywayCheckSum("\uFEFFcreate table abc (id int);\r\nselect 1;\n"))
+	assert.Equal(t, flywayCheckSum("create table abc (id int);\nselect 1;"), flywayCheckSum("create table abc (id int);\rselect 1;"))
+	assert.Equal(t, fmt.Sprint(expected), flywayCheckSum("create table abc (id int);\nselect 1;"))
+}
@@ -3,6 +3,8 @@ package coordinator
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
@@ -105,18 +107,114 @@ func newDifferentScriptCheckSumMockedDiskLoader(_ context.Context, _ *config.Con
 	return new(mockedDifferentScriptCheckSumMockedDiskLoader)
 }
 
+type mockedTenantSelectorDiskLoader struct {
+	mockedDiskLoader
+}
+
+func (m *mockedTenantSelectorDiskLoader) GetSourceMigrations() []types.Migration {
+	s1 := types.Migration{Name: "enterprise-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/enterprise-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc", TenantSelector: "tier=enterprise"}
+	return append(m.mockedDiskLoader.GetSourceMigrations(), s1)
+}
+
+func newMockedTenantSelectorDiskLoader(_ context.Context, _ *config.Config) loader.Loader {
+	return &mockedTenantSelectorDiskLoader{}
+}
+
 type mockedConnector struct {
 }
 
 func (m *mockedConnector) Dispose() {
 }
 
-func (m *mockedConnector) CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version) {
+func (m *mockedConnector) CreateTenant(types.Tenant, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version) {
 	return &types.Summary{}, &types.Version{}
 }
 
-func (m *mockedConnector) CreateVersion(string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version) {
-	return &types.Summary{}, &types.Version{}
+func (m *mockedConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+	tenants := []string{}
+	for tenant := range tenantMigrations {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	dbMigrations := []types.DBMigration{}
+	for _, migration := range migrations {
+		if migration.MigrationType == types.MigrationTypeSingleMigration || migration.MigrationType == types.MigrationTypeSingleScript || migration.MigrationType == types.MigrationTypeSingleRepeatable {
+			dbMigrations = append(dbMigrations, types.DBMigration{Migration: migration, Schema: migration.SourceDir})
+			continue
+		}
+		for _, tenant := range tenants {
+			for _, tm := range tenantMigrations[tenant] {
+				if tm.File == migration.File {
+					dbMigrations = append(dbMigrations, types.DBMigration{Migration: migration, Schema: tenant})
+				}
+			}
+		}
+	}
+	return &types.Summary{Tenants: int32(len(tenants))}, &types.Version{Name: versionName, DBMigrations: dbMigrations}
+}
+
+func (m *mockedConnector) RollbackVersion(versionName string, migrations []types.DBMigration, dryRun bool) (*types.Summary, *types.Version) {
+	return &types.Summary{MigrationsRolledBack: int32(len(migrations))}, &types.Version{Name: versionName, DBMigrations: migrations}
+}
+
+func (m *mockedConnector) DeleteTenant(tenant string, versionName string, mode types.DeleteTenantMode, dryRun bool) (*types.Summary, *types.Version) {
+	summary := &types.Summary{TenantsDeleted: 1}
+	if dryRun {
+		return summary, nil
+	}
+	deletion := types.Migration{Name: mode.String(), MigrationType: types.MigrationTypeTenantDeletion}
+	return summary, &types.Version{Name: versionName, DBMigrations: []types.DBMigration{{Migration: deletion, Schema: tenant}}}
+}
+
+func (m *mockedConnector) RepairMigrations(versionName string, mismatches []types.CheckSumMismatch, dryRun bool) (*types.Summary, *types.Version) {
+	summary := &types.Summary{MigrationsRepaired: int32(len(mismatches))}
+	if dryRun {
+		return summary, nil
+	}
+	dbMigrations := []types.DBMigration{}
+	for _, m := range mismatches {
+		repair := m.SourceMigration
+		repair.MigrationType = types.MigrationTypeRepair
+		repair.Contents = m.AppliedContents
+		repair.CheckSum = m.AppliedCheckSum
+		dbMigrations = append(dbMigrations, types.DBMigration{Migration: repair, Schema: "migrator"})
+	}
+	return summary, &types.Version{Name: versionName, DBMigrations: dbMigrations}
+}
+
+func (m *mockedConnector) GetLegacyHistory(tool types.LegacyTool, table string, schemas []string) []types.LegacyHistoryEntry {
+	var history []types.LegacyHistoryEntry
+	switch tool {
+	case types.LegacyToolGolangMigrate:
+		history = []types.LegacyHistoryEntry{
+			{Schema: "source", Version: "201602220001", Success: true},
+			{Schema: "a", Version: "201602220003", Success: true},
+			// migration failed in tenant b
+			{Schema: "b", Version: "201602220003", Success: false},
+		}
+	default:
+		history = []types.LegacyHistoryEntry{
+			{Schema: "source", Version: "1", Description: "<< Flyway Baseline >>", Script: "<< Flyway Baseline >>", Success: true},
+			// already applied by migrator
+			{Schema: "source", Script: "201602220000.sql", CheckSum: flywayCheckSum("select abc"), Success: true},
+			// renamed after it had been applied, matched by checksum
+			{Schema: "source", Script: "V2__renamed.sql", CheckSum: flywayCheckSum("select def"), Success: true},
+			{Schema: "config", Script: "201602220001.sql", CheckSum: flywayCheckSum("select def"), Success: true},
+			{Schema: "a", Script: "201602220003.sql", CheckSum: flywayCheckSum("select def"), Success: true},
+			{Schema: "b", Script: "201602220003.sql", CheckSum: flywayCheckSum("select def"), Success: false},
+		}
+	}
+	requested := map[string]bool{}
+	for _, schema := range schemas {
+		requested[schema] = true
+	}
+	entries := []types.LegacyHistoryEntry{}
+	for _, e := range history {
+		if requested[e.Schema] {
+			entries = append(entries, e)
+		}
+	}
+	return entries
 }
 
 func (m *mockedConnector) GetTenants() []types.Tenant {
@@ -157,6 +255,39 @@ func (m *mockedConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, erro
 	return &db, nil
 }
 
+func (m *mockedConnector) Lock() (func(), error) {
+	return func() {}, nil
+}
+
+func (m *mockedConnector) CreateJob(versionName string) *types.Job {
+	return &types.Job{ID: 1, State: types.JobStateQueued, VersionName: versionName, Created: graphql.Time{Time: time.Now()}}
+}
+
+func (m *mockedConnector) UpdateJob(job *types.Job) error {
+	return nil
+}
+
+func (m *mockedConnector) GetJobByID(ID int32) (*types.Job, error) {
+	if ID != 1 {
+		return nil, errors.New("job not found")
+	}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return &types.Job{ID: ID, State: types.JobStateRunning, VersionName: "a", Created: graphql.Time{Time: d1}, Updated: graphql.Time{Time: d1}, MigrationsTotal: 10, MigrationsApplied: 4}, nil
+}
+
+func (m *mockedConnector) CancelJob(ID int32) (*types.Job, error) {
+	job, err := m.GetJobByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	job.CancelRequested = true
+	return job, nil
+}
+
+func (m *mockedConnector) FailStaleJobs(staleAfter time.Duration, failure string) error {
+	return nil
+}
+
 func (m *mockedConnector) HealthCheck() error {
 	return nil
 }
@@ -194,6 +325,193 @@ func newDifferentScriptCheckSumMockedConnector(context.Context, *config.Config)
 	return &mockedDifferentScriptCheckSumMockedConnector{mockedConnector{}}
 }
 
+type mockedRollbackConnector struct {
+	mockedConnector
+}
+
+func (m *mockedRollbackConnector) GetVersionByID(ID int32) (*types.Version, error) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc", DownContents: "drop table abc"}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, Contents: "select abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def", DownContents: "drop table {schema}.def"}
+	m3 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table ghi"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	switch ID {
+	case 1:
+		ms := []types.DBMigration{{Migration: m1, ID: 1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m2, ID: 2, Schema: "abc", Created: graphql.Time{Time: d1}}, {Migration: m2, ID: 3, Schema: "def", Created: graphql.Time{Time: d1}}, {Migration: s1, ID: 4, Schema: "abc", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: d1}, DBMigrations: ms}, nil
+	case 2:
+		ms := []types.DBMigration{{Migration: m3, ID: 5, Schema: "source", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "b", Created: graphql.Time{Time: d1}, DBMigrations: ms}, nil
+	case 3:
+		// m2 in tenant def was already rolled back
+		ms := []types.DBMigration{{Migration: m2, ID: 3, Schema: "def", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "c", Created: graphql.Time{Time: d1}, DBMigrations: ms}, nil
+	}
+	return nil, errors.New("version not found")
+}
+
+func (m *mockedRollbackConnector) GetAppliedMigrations() []types.DBMigration {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def"}
+	r2 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeRollback, Contents: "drop table {schema}.def"}
+	m3 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table ghi"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m2, Schema: "abc", Created: graphql.Time{Time: d1}}, {Migration: m2, Schema: "def", Created: graphql.Time{Time: d1}}, {Migration: r2, Schema: "def", Created: graphql.Time{Time: d1}}, {Migration: m3, Schema: "source", Created: graphql.Time{Time: d1}}}
+	return ms
+}
+
+func newMockedRollbackConnector(context.Context, *config.Config) db.Connector {
+	return &mockedRollbackConnector{mockedConnector{}}
+}
+
+type mockedLaggingTenantConnector struct {
+	mockedConnector
+}
+
+func (m *mockedLaggingTenantConnector) GetAppliedMigrations() []types.DBMigration {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	// tenant c was created outside of migrator
+	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m5, Schema: "a", Created: graphql.Time{Time: d1}}, {Migration: m5, Schema: "b", Created: graphql.Time{Time: d1}}}
+	return ms
+}
+
+func newMockedLaggingTenantConnector(context.Context, *config.Config) db.Connector {
+	return &mockedLaggingTenantConnector{mockedConnector{}}
+}
+
+type mockedTenantMetadataConnector struct {
+	mockedConnector
+}
+
+func (m *mockedTenantMetadataConnector) GetTenants() []types.Tenant {
+	a := types.Tenant{Name: "a", Metadata: types.TenantMetadata{"tier": "enterprise"}}
+	b := types.Tenant{Name: "b", Metadata: types.TenantMetadata{"tier": "free"}}
+	c := types.Tenant{Name: "c"}
+	return []types.Tenant{a, b, c}
+}
+
+func newMockedTenantMetadataConnector(context.Context, *config.Config) db.Connector {
+	return &mockedTenantMetadataConnector{mockedConnector{}}
+}
+
+type mockedOutOfOrderConnector struct {
+	mockedConnector
+}
+
+func (m *mockedOutOfOrderConnector) GetAppliedMigrations() []types.DBMigration {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m4 := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	// source/201602220001.sql was merged after source/201602220002.sql had been applied
+	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m4, Schema: "source", Created: graphql.Time{Time: d1}}}
+	return ms
+}
+
+func newMockedOutOfOrderConnector(context.Context, *config.Config) db.Connector {
+	return &mockedOutOfOrderConnector{mockedConnector{}}
+}
+
+type mockedPartialVersionConnector struct {
+	mockedConnector
+}
+
+func (m *mockedPartialVersionConnector) GetVersionByID(ID int32) (*types.Version, error) {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
+	f5 := m5
+	f5.MigrationType = types.MigrationTypeTenantFailure
+	f5.Contents = "trouble maker"
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	switch ID {
+	case 1:
+		// m5 failed in tenants b and c
+		ms := []types.DBMigration{{Migration: m5, ID: 1, Schema: "a", Created: graphql.Time{Time: d1}}, {Migration: f5, ID: 2, Schema: "b", Created: graphql.Time{Time: d1}}, {Migration: f5, ID: 3, Schema: "c", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "a", Created: graphql.Time{Time: d1}, DBMigrations: ms, Partial: true}, nil
+	case 2:
+		ms := []types.DBMigration{{Migration: m1, ID: 4, Schema: "source", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "b", Created: graphql.Time{Time: d1}, DBMigrations: ms}, nil
+	case 3:
+		// m5 failed only in tenant c
+		ms := []types.DBMigration{{Migration: f5, ID: 5, Schema: "c", Created: graphql.Time{Time: d1}}}
+		return &types.Version{ID: ID, Name: "c", Created: graphql.Time{Time: d1}, DBMigrations: ms, Partial: true}, nil
+	}
+	return nil, errors.New("version not found")
+}
+
+func (m *mockedPartialVersionConnector) GetAppliedMigrations() []types.DBMigration {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc"}
+	m5 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	d2 := time.Date(2016, 02, 23, 16, 41, 1, 123, time.UTC)
+	// tenant c was caught up after version 1 was created
+	ms := []types.DBMigration{{Migration: m1, Schema: "source", Created: graphql.Time{Time: d1}}, {Migration: m5, Schema: "a", Created: graphql.Time{Time: d1}}, {Migration: m5, Schema: "c", Created: graphql.Time{Time: d2}}}
+	return ms
+}
+
+func newMockedPartialVersionConnector(context.Context, *config.Config) db.Connector {
+	return &mockedPartialVersionConnector{mockedConnector{}}
+}
+
+type mockedLockedConnector struct {
+	mockedConnector
+}
+
+func (m *mockedLockedConnector) Lock() (func(), error) {
+	return nil, &db.LockHeldError{Holder: "migrator-1:42", Since: time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)}
+}
+
+func (m *mockedLockedConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+	panic("CreateVersion must not be called without migration lock")
+}
+
+func newMockedLockedConnector(context.Context, *config.Config) db.Connector {
+	return &mockedLockedConnector{mockedConnector{}}
+}
+
+// mockedJobConnector records all job updates and stale jobs timeout, cancelRequested is returned by GetJobByID (onGetJob is called before)
+type mockedJobConnector struct {
+	mockedConnector
+	updates         []types.Job
+	staleAfter      time.Duration
+	cancelRequested bool
+	onGetJob        func()
+}
+
+func (m *mockedJobConnector) GetJobByID(ID int32) (*types.Job, error) {
+	if m.onGetJob != nil {
+		m.onGetJob()
+	}
+	job, err := m.mockedConnector.GetJobByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	job.CancelRequested = m.cancelRequested
+	return job, nil
+}
+
+// mockedCancellableJobConnector blocks CreateVersion until its context is cancelled
+type mockedCancellableJobConnector struct {
+	mockedJobConnector
+	ctx context.Context
+}
+
+func (m *mockedCancellableJobConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+	<-m.ctx.Done()
+	panic(fmt.Sprintf("Could not apply migrations: %v", m.ctx.Err()))
+}
+
+func (m *mockedJobConnector) UpdateJob(job *types.Job) error {
+	m.updates = append(m.updates, *job)
+	return nil
+}
+
+func (m *mockedJobConnector) FailStaleJobs(staleAfter time.Duration, failure string) error {
+	m.staleAfter = staleAfter
+	return nil
+}
+
 func newNoopMetrics() metrics.Metrics {
 	return &noopMetrics{}
 }
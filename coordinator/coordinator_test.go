@@ -2,12 +2,16 @@ package coordinator
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
@@ -83,6 +87,38 @@ func TestMigrationsFlattenMigrationDBs3(t *testing.T) {
 	assert.Equal(t, []types.Migration{m1, m2, m4, m5, m6, m7}, migrations)
 }
 
+func TestMigrationsFlattenMigrationDBsVersionOrdering(t *testing.T) {
+	m1 := types.Migration{Name: "V10__x.sql", SourceDir: "public", File: "public/V10__x.sql", MigrationType: types.MigrationTypeSingleMigration}
+	db1 := types.DBMigration{Migration: m1, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	m2 := types.Migration{Name: "V2__y.sql", SourceDir: "tenants", File: "tenants/V2__y.sql", MigrationType: types.MigrationTypeTenantMigration}
+	db2 := types.DBMigration{Migration: m2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}
+	db3 := types.DBMigration{Migration: m2, Schema: "def", Created: graphql.Time{Time: time.Now()}}
+
+	// applied migrations are returned sorted lexically
+	dbs := []types.DBMigration{db1, db2, db3}
+
+	coordinator := &coordinator{config: &config.Config{VersionOrdering: config.VersionOrderingSemver}}
+	migrations := coordinator.flattenAppliedMigrations(dbs)
+
+	assert.Equal(t, []types.Migration{m2, m1}, migrations)
+}
+
+func TestComputeOutOfOrderMigrationsVersionOrdering(t *testing.T) {
+	m2 := types.Migration{Name: "V2__y.sql", SourceDir: "public", File: "public/V2__y.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m3 := types.Migration{Name: "V3__z.sql", SourceDir: "public", File: "public/V3__z.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m10 := types.Migration{Name: "V10__x.sql", SourceDir: "public", File: "public/V10__x.sql", MigrationType: types.MigrationTypeSingleMigration}
+
+	applied := []types.DBMigration{{Migration: m2, Schema: "public", Created: graphql.Time{Time: time.Now()}}}
+
+	// lexically V10__x.sql sorts before V2__y.sql
+	lexical := &coordinator{config: &config.Config{}}
+	assert.Equal(t, []string{m10.File}, lexical.computeOutOfOrderMigrations([]types.Migration{m3, m10}, applied))
+
+	semver := &coordinator{config: &config.Config{VersionOrdering: config.VersionOrderingSemver}}
+	assert.Empty(t, semver.computeOutOfOrderMigrations([]types.Migration{m3, m10}, applied))
+}
+
 func TestComputeMigrationsToApply(t *testing.T) {
 	mdef1 := types.Migration{Name: "a", SourceDir: "a", File: "a", MigrationType: types.MigrationTypeSingleMigration}
 	mdef2 := types.Migration{Name: "b", SourceDir: "b", File: "b", MigrationType: types.MigrationTypeTenantMigration}
@@ -154,6 +190,132 @@ func TestComputeMigrationsToApplyDifferentTimestamps(t *testing.T) {
 	assert.Equal(t, dev1p2.File, migrations[2].File)
 }
 
+func TestExcludeRolledBackMigrations(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	db1 := types.DBMigration{Migration: m1, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration}
+	db2 := types.DBMigration{Migration: m2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}
+	db3 := types.DBMigration{Migration: m2, Schema: "def", Created: graphql.Time{Time: time.Now()}}
+
+	r1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeRollback}
+	dbr1 := types.DBMigration{Migration: r1, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	r2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeRollback}
+	dbr2 := types.DBMigration{Migration: r2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}
+
+	// tenant migration rolled back and then applied again
+	db4 := types.DBMigration{Migration: m2, Schema: "abc", Created: graphql.Time{Time: time.Now()}}
+
+	dbs := []types.DBMigration{db1, db2, db3, dbr1, dbr2, db4}
+
+	coordinator := &coordinator{}
+	migrations := coordinator.excludeRolledBackMigrations(dbs)
+
+	assert.Equal(t, []types.DBMigration{db2, db3, db4}, migrations)
+}
+
+func TestComputeMigrationsToApplyRolledBack(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	db1 := types.DBMigration{Migration: m1, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	r1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeRollback}
+	dbr1 := types.DBMigration{Migration: r1, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	m2 := types.Migration{Name: "002.sql", SourceDir: "public", File: "public/002.sql", MigrationType: types.MigrationTypeSingleMigration}
+	db2 := types.DBMigration{Migration: m2, Schema: "public", Created: graphql.Time{Time: time.Now()}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations := coordinator.computeMigrationsToApply([]types.Migration{m1, m2}, []types.DBMigration{db1, db2, dbr1})
+
+	// rolled back migration is applied again
+	assert.Equal(t, []types.Migration{m1}, migrations)
+}
+
+func TestComputeMigrationsToApplyRepeatables(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration, CheckSum: "m1"}
+	r1 := types.Migration{Name: "orders_view.sql", SourceDir: "views", File: "views/orders_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, CheckSum: "r1-v2"}
+	r2 := types.Migration{Name: "users_view.sql", SourceDir: "views", File: "views/users_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, CheckSum: "r2-v1"}
+	r3 := types.Migration{Name: "products_view.sql", SourceDir: "views", File: "views/products_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, CheckSum: "r3-v1"}
+	r4 := types.Migration{Name: "stock_view.sql", SourceDir: "views", File: "views/stock_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, CheckSum: "r4-v1"}
+
+	r1v1 := r1
+	r1v1.CheckSum = "r1-v1"
+	r3v2 := r3
+	r3v2.CheckSum = "r3-v2"
+
+	now := time.Now()
+	appliedMigrations := []types.DBMigration{
+		{Migration: m1, Schema: "public", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		// r1 was modified since it was applied
+		{Migration: r1v1, Schema: "views", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		// r2 was not modified
+		{Migration: r2, Schema: "views", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		// r3 was reverted to its previous contents
+		{Migration: r3, Schema: "views", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		{Migration: r3v2, Schema: "views", Created: graphql.Time{Time: now.Add(-1 * time.Hour)}},
+	}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations := coordinator.computeMigrationsToApply([]types.Migration{m1, r1, r2, r3, r4}, appliedMigrations)
+
+	// r4 was never applied
+	assert.Equal(t, []types.Migration{r1, r3, r4}, migrations)
+
+	// repeatables are not reported as checksum mismatches
+	assert.Empty(t, coordinator.computeCheckSumMismatches([]types.Migration{m1, r1, r2, r3, r4}, appliedMigrations))
+}
+
+func TestComputeTenantMigrationsToApplyRepeatables(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, CheckSum: "m1"}
+	r1 := types.Migration{Name: "recalculate.sql", SourceDir: "tenants-procedures", File: "tenants-procedures/recalculate.sql", MigrationType: types.MigrationTypeTenantRepeatable, CheckSum: "r1-v2"}
+	sourceMigrations := []types.Migration{m1, r1}
+
+	r1v1 := r1
+	r1v1.CheckSum = "r1-v1"
+
+	now := time.Now()
+	// abc has the latest r1, def has the previous r1, ghi has no r1 at all
+	appliedMigrations := []types.DBMigration{
+		{Migration: m1, Schema: "abc", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		{Migration: m1, Schema: "def", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		{Migration: m1, Schema: "ghi", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		{Migration: r1v1, Schema: "abc", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+		{Migration: r1, Schema: "abc", Created: graphql.Time{Time: now.Add(-1 * time.Hour)}},
+		{Migration: r1v1, Schema: "def", Created: graphql.Time{Time: now.Add(-2 * time.Hour)}},
+	}
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}, {Name: "ghi"}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	tenantMigrations := coordinator.computeTenantMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
+
+	assert.Equal(t, []types.Migration{}, tenantMigrations["abc"])
+	assert.Equal(t, []types.Migration{r1}, tenantMigrations["def"])
+	assert.Equal(t, []types.Migration{r1}, tenantMigrations["ghi"])
+
+	// r1 is up to date in abc but is pending in def and ghi
+	migrationsToApply := coordinator.computeMigrationsToApply(sourceMigrations, appliedMigrations)
+	merged := coordinator.mergeTenantMigrationsToApply(sourceMigrations, migrationsToApply, tenantMigrations)
+	assert.Equal(t, []types.Migration{r1}, merged)
+	assert.Equal(t, int32(2), countMigrationsToApply(merged, tenantMigrations))
+}
+
+func TestFilterCallbacks(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	c1 := types.Migration{Name: "beforeVersion.sql", SourceDir: "callbacks", File: "callbacks/beforeVersion.sql", MigrationType: types.MigrationTypeCallback}
+	c2 := types.Migration{Name: "afterEachTenant_grants.sql", SourceDir: "callbacks", File: "callbacks/afterEachTenant_grants.sql", MigrationType: types.MigrationTypeCallback}
+	c3 := types.Migration{Name: "afterCreateTenant.sql", SourceDir: "callbacks", File: "callbacks/afterCreateTenant.sql", MigrationType: types.MigrationTypeCallback}
+	sourceMigrations := []types.Migration{m1, c1, c2, c3}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+
+	assert.Equal(t, []types.Migration{c1, c2}, coordinator.filterCallbacks(sourceMigrations, types.CallbackBeforeVersion, types.CallbackAfterEachTenant))
+	assert.Equal(t, []types.Migration{c3}, coordinator.filterCallbacks(sourceMigrations, types.CallbackAfterCreateTenant))
+
+	// callbacks are never pending even when they were never applied
+	assert.Equal(t, []types.Migration{m1}, coordinator.computeMigrationsToApply(sourceMigrations, []types.DBMigration{}))
+}
+
 func TestFilterTenantMigrations(t *testing.T) {
 	mdef1 := types.Migration{Name: "20181111", SourceDir: "tenants", File: "tenants/20181111", MigrationType: types.MigrationTypeTenantMigration}
 	mdef2 := types.Migration{Name: "20181111", SourceDir: "public", File: "public/20181111", MigrationType: types.MigrationTypeSingleMigration}
@@ -239,6 +401,148 @@ func TestVerifySourceMigrationsAndScriptsCheckSumsOK(t *testing.T) {
 	assert.Empty(t, offendingMigrations)
 }
 
+func TestGetCheckSumMismatches(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	mismatches := coordinator.GetCheckSumMismatches()
+	assert.Len(t, mismatches, 1)
+	assert.Equal(t, coordinator.GetSourceMigrations(nil)[0], mismatches[0].SourceMigration)
+	assert.Equal(t, "", mismatches[0].AppliedCheckSum)
+}
+
+func TestCreateVersionVerifyChecksums(t *testing.T) {
+	config := &config.Config{VerifyChecksums: true}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, results)
+	assert.Equal(t, "checksum mismatch found in applied migrations: source/201602220000.sql", err.Error())
+}
+
+func TestCreateVersionVerifyChecksumsOverride(t *testing.T) {
+	config := &config.Config{VerifyChecksums: true}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	verifyChecksums := false
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, VerifyChecksums: &verifyChecksums})
+	assert.Nil(t, err)
+	assert.NotNil(t, results.Version)
+}
+
+func TestCreateVersionVerifyChecksumsFromInput(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	verifyChecksums := true
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, VerifyChecksums: &verifyChecksums})
+	assert.Nil(t, results)
+	assert.NotNil(t, err)
+}
+
+func TestDeleteTenant(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "a", VersionName: "delete-a", Mode: types.DeleteTenantModeArchive})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Summary.TenantsDeleted)
+	assert.Equal(t, "delete-a", results.Version.Name)
+	assert.Equal(t, types.MigrationTypeTenantDeletion, results.Version.DBMigrations[0].MigrationType)
+	assert.Equal(t, "Archive", results.Version.DBMigrations[0].Name)
+	assert.Equal(t, "a", results.Version.DBMigrations[0].Schema)
+}
+
+func TestDeleteTenantNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "unknown", VersionName: "delete-unknown"})
+	assert.Nil(t, results)
+	assert.Equal(t, "tenant not found: unknown", err.Error())
+}
+
+func TestDeleteTenantDropConfirmationToken(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "a", VersionName: "drop-a", Mode: types.DeleteTenantModeDrop})
+	assert.Nil(t, results)
+	assert.Equal(t, "confirmation token does not match tenant name: a", err.Error())
+
+	token := "b"
+	results, err = coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "a", VersionName: "drop-a", Mode: types.DeleteTenantModeDrop, ConfirmationToken: &token})
+	assert.Nil(t, results)
+	assert.NotNil(t, err)
+
+	token = "a"
+	results, err = coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "a", VersionName: "drop-a", Mode: types.DeleteTenantModeDrop, ConfirmationToken: &token})
+	assert.Nil(t, err)
+	assert.Equal(t, "Drop", results.Version.DBMigrations[0].Name)
+}
+
+func TestRepair(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.Repair(types.RepairInput{VersionName: "repair", Files: []string{"source/201602220000.sql"}, Confirm: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Summary.MigrationsRepaired)
+	assert.Equal(t, "repair", results.Version.Name)
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, types.MigrationTypeRepair, results.Version.DBMigrations[0].MigrationType)
+	assert.Equal(t, "select abc", results.Version.DBMigrations[0].Contents)
+	assert.Empty(t, results.MissingSourceMigrations)
+}
+
+func TestRepairNotConfirmed(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.Repair(types.RepairInput{VersionName: "repair", Files: []string{"source/201602220000.sql"}})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), results.Summary.MigrationsRepaired)
+	assert.Nil(t, results.Version)
+}
+
+func TestRepairMigrationNotModified(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.Repair(types.RepairInput{VersionName: "repair", Files: []string{"source/201602220000.sql"}, Confirm: true})
+	assert.Nil(t, results)
+	assert.Equal(t, "migration does not need repair: source/201602220000.sql", err.Error())
+}
+
+func TestRepairMissingSourceMigrations(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedOutOfOrderConnector, newBrokenCheckSumMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.Repair(types.RepairInput{VersionName: "repair", Files: []string{}, Confirm: true})
+	assert.Nil(t, err)
+	assert.Nil(t, results.Version)
+	assert.Equal(t, int32(0), results.Summary.MigrationsRepaired)
+	assert.Len(t, results.MissingSourceMigrations, 1)
+	assert.Equal(t, "source/201602220002.sql", results.MissingSourceMigrations[0].File)
+}
+
+func TestGetAppliedMigrationsExcludesRollbacks(t *testing.T) {
+	coordinator := &coordinator{ctx: context.TODO(), connector: &mockedRollbackConnector{}}
+	applied := coordinator.GetAppliedMigrations()
+	// m2 rolled back in def and its rollback entry are not returned
+	assert.Len(t, applied, 3)
+	for _, m := range applied {
+		assert.NotEqual(t, types.MigrationTypeRollback, m.MigrationType)
+		assert.False(t, m.File == "tenants/201602220001.sql" && m.Schema == "def")
+	}
+}
+
+func TestExcludeRolledBackMigrationsSkipsRepairs(t *testing.T) {
+	coordinator := &coordinator{}
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	r1 := m1
+	r1.MigrationType = types.MigrationTypeRollback
+	p1 := m1
+	p1.MigrationType = types.MigrationTypeRepair
+	// repair entry recorded after rollback must not resurrect rolled back migration
+	applied := []types.DBMigration{{Migration: m1, Schema: "source"}, {Migration: r1, Schema: "source"}, {Migration: p1, Schema: "migrator"}}
+	assert.Empty(t, coordinator.excludeRolledBackMigrations(applied))
+	applied = []types.DBMigration{{Migration: m1, Schema: "source"}, {Migration: p1, Schema: "migrator"}}
+	assert.Equal(t, []types.DBMigration{{Migration: m1, Schema: "source"}}, coordinator.excludeRolledBackMigrations(applied))
+}
+
 func TestGetTenants(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
 	defer coordinator.Dispose()
@@ -352,21 +656,661 @@ func TestGetSourceMigrationsFilterFile(t *testing.T) {
 func TestCreateVersion(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateVersion("commit-sha", types.ActionApply, false)
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, DryRun: false})
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
+	// source/201602220000.sql is already applied, tenant migration is applied to all 3 tenants
+	assert.Len(t, results.Version.DBMigrations, 6)
+	assert.Equal(t, int32(3), results.Summary.Tenants)
+}
+
+func TestCreateVersionTenants(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	tenants := []string{"a", "c"}
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Tenants: &tenants})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.Summary.Tenants)
+	assert.Len(t, results.Version.DBMigrations, 5)
+	assert.Equal(t, "a", results.Version.DBMigrations[3].Schema)
+	assert.Equal(t, "c", results.Version.DBMigrations[4].Schema)
+}
+
+func TestCreateVersionTenantsNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	tenants := []string{"a", "xyz"}
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Tenants: &tenants})
+	assert.Nil(t, results)
+	assert.Equal(t, "tenant not found: xyz", err.Error())
+}
+
+func TestCreateVersionTenantPattern(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	pattern := "[ab]"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, TenantPattern: &pattern})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), results.Summary.Tenants)
+	assert.Len(t, results.Version.DBMigrations, 5)
+}
+
+func TestCreateVersionTenantPatternInvalid(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	pattern := "[ab"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, TenantPattern: &pattern})
+	assert.Nil(t, results)
+	assert.Equal(t, "invalid tenant pattern [ab: syntax error in pattern", err.Error())
+}
+
+func TestCreateVersionTenantsAndTenantPattern(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	tenants := []string{"a"}
+	pattern := "a*"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Tenants: &tenants, TenantPattern: &pattern})
+	assert.Nil(t, results)
+	assert.Equal(t, "tenants and tenantPattern cannot be used together", err.Error())
+}
+
+func TestComputeTenantMigrationsToApply(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration}
+	m3 := types.Migration{Name: "003.sql", SourceDir: "tenants", File: "tenants/003.sql", MigrationType: types.MigrationTypeTenantMigration}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript}
+	sourceMigrations := []types.Migration{m1, m2, m3, s1}
+
+	// abc and def have m1, m2 was applied only to abc (version applied to a subset of tenants)
+	// ghi was created outside of migrator and has no migrations at all
+	appliedMigrations := []types.DBMigration{
+		{Migration: m1, Schema: "abc"},
+		{Migration: m1, Schema: "def"},
+		{Migration: m2, Schema: "abc"},
+	}
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}, {Name: "ghi"}}
+
+	coordinator := &coordinator{}
+	tenantMigrations := coordinator.computeTenantMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
+
+	assert.Equal(t, []types.Migration{m3, s1}, tenantMigrations["abc"])
+	assert.Equal(t, []types.Migration{m2, m3, s1}, tenantMigrations["def"])
+	// tenants without any migrations get all tenant migrations
+	assert.Equal(t, []types.Migration{m1, m2, m3, s1}, tenantMigrations["ghi"])
+
+	merged := coordinator.mergeTenantMigrationsToApply(sourceMigrations, []types.Migration{m3, s1}, tenantMigrations)
+	assert.Equal(t, []types.Migration{m1, m2, m3, s1}, merged)
+}
+
+func TestComputeTenantMigrationsToApplyTenantSkippedByAllVersions(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration}
+	sourceMigrations := []types.Migration{m1, m2}
+
+	// m1 was applied only to abc, def has no tenant migrations applied
+	appliedMigrations := []types.DBMigration{
+		{Migration: m1, Schema: "abc"},
+	}
+	tenants := []types.Tenant{{Name: "abc"}, {Name: "def"}}
+
+	coordinator := &coordinator{}
+	tenantMigrations := coordinator.computeTenantMigrationsToApply(sourceMigrations, appliedMigrations, tenants)
+
+	assert.Equal(t, []types.Migration{m2}, tenantMigrations["abc"])
+	assert.Equal(t, []types.Migration{m1, m2}, tenantMigrations["def"])
+}
+
+func TestComputeTenantMigrationsToApplyTenantSelectors(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration, TenantSelector: "tier=enterprise|premium"}
+	m3 := types.Migration{Name: "003.sql", SourceDir: "tenants", File: "tenants/003.sql", MigrationType: types.MigrationTypeTenantMigration, TenantSelector: "tier=enterprise, region!=eu"}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "tenants-scripts", File: "tenants-scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeTenantScript, TenantSelector: "region=eu"}
+	sourceMigrations := []types.Migration{m1, m2, m3, s1}
+
+	tenants := []types.Tenant{
+		{Name: "abc", Metadata: types.TenantMetadata{"tier": "enterprise", "region": "us"}},
+		{Name: "def", Metadata: types.TenantMetadata{"tier": "premium", "region": "eu"}},
+		{Name: "ghi"},
+	}
+
+	coordinator := &coordinator{}
+	tenantMigrations := coordinator.computeTenantMigrationsToApply(sourceMigrations, []types.DBMigration{}, tenants)
+
+	assert.Equal(t, []types.Migration{m1, m2, m3}, tenantMigrations["abc"])
+	assert.Equal(t, []types.Migration{m1, m2, s1}, tenantMigrations["def"])
+	// tenant without metadata gets only migrations without tenant selectors
+	assert.Equal(t, []types.Migration{m1}, tenantMigrations["ghi"])
+
+	// m2 applied in abc is not missing in ghi which is not selected by it
+	appliedMigrations := []types.DBMigration{
+		{Migration: m1, Schema: "abc"},
+		{Migration: m2, Schema: "abc"},
+	}
+	missingMigrations := coordinator.computeMissingTenantMigrations(sourceMigrations, appliedMigrations, tenants)
+	assert.Equal(t, []types.Migration{m1, m2}, missingMigrations["def"])
+	assert.Equal(t, []types.Migration{m1}, missingMigrations["ghi"])
+}
+
+func TestCreateVersionSelectedTenantsTenantSelectors(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedTenantMetadataConnector, newMockedTenantSelectorDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	tenants := []string{"a", "b"}
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Tenants: &tenants})
+	assert.Nil(t, err)
+	tenantScripts := []types.DBMigration{}
+	for _, m := range results.Version.DBMigrations {
+		if m.MigrationType == types.MigrationTypeTenantScript {
+			tenantScripts = append(tenantScripts, m)
+		}
+	}
+	// tenants selected by name keep their metadata, b is not selected by enterprise-indexes.sql
+	assert.Len(t, tenantScripts, 1)
+	assert.Equal(t, "a", tenantScripts[0].Schema)
+}
+
+func TestFilterMigrationsByContexts(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "seeds", File: "seeds/002.sql", MigrationType: types.MigrationTypeSingleMigration, Labels: []string{"test-data"}}
+	m3 := types.Migration{Name: "003.sql", SourceDir: "public", File: "public/003.sql", MigrationType: types.MigrationTypeSingleMigration, Labels: []string{"prod", "staging"}}
+	migrations := []types.Migration{m1, m2, m3}
+
+	coordinator := &coordinator{}
+
+	filtered, skipped := coordinator.filterMigrationsByContexts(migrations, []string{"staging"})
+	assert.Equal(t, []types.Migration{m1, m3}, filtered)
+	assert.Equal(t, []string{"seeds/002.sql"}, skipped)
+
+	// without contexts only migrations without labels are applied
+	filtered, skipped = coordinator.filterMigrationsByContexts(migrations, nil)
+	assert.Equal(t, []types.Migration{m1}, filtered)
+	assert.Equal(t, []string{"seeds/002.sql", "public/003.sql"}, skipped)
+}
+
+func TestGetContexts(t *testing.T) {
+	coordinator := &coordinator{}
+	assert.Nil(t, coordinator.getContexts(nil))
+
+	coordinator.config = &config.Config{Contexts: []string{"prod"}}
+	assert.Equal(t, []string{"prod"}, coordinator.getContexts(nil))
+
+	contexts := []string{"test", "test-data"}
+	assert.Equal(t, contexts, coordinator.getContexts(&contexts))
+}
+
+func TestCreateVersionTargetFile(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	target := "source/201602220001.sql"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Target: &target})
+	assert.Nil(t, err)
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, "source/201602220001.sql", results.Version.DBMigrations[0].File)
+}
+
+func TestCreateVersionTargetName(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	// both source/201602220001.sql and config/201602220001.sql have the same name
+	target := "201602220001.sql"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Target: &target})
+	assert.Nil(t, err)
+	assert.Len(t, results.Version.DBMigrations, 2)
+	assert.Equal(t, "source/201602220001.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, "config/201602220001.sql", results.Version.DBMigrations[1].File)
+}
+
+func TestCreateVersionTargetNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	target := "source/209912310000.sql"
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Target: &target})
+	assert.Nil(t, results)
+	assert.Equal(t, "target source migration not found: source/209912310000.sql", err.Error())
+}
+
+func TestFilterMigrationsUpToTargetScripts(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "public", File: "public/002.sql", MigrationType: types.MigrationTypeSingleMigration}
+	s1 := types.Migration{Name: "recreate-indexes.sql", SourceDir: "scripts", File: "scripts/recreate-indexes.sql", MigrationType: types.MigrationTypeSingleScript}
+	sourceMigrations := []types.Migration{m1, m2, s1}
+
+	coordinator := &coordinator{}
+	// scripts are always applied and cannot be used as target
+	_, err := coordinator.filterMigrationsUpToTarget(sourceMigrations, sourceMigrations, "scripts/recreate-indexes.sql")
+	assert.NotNil(t, err)
+
+	migrations, err := coordinator.filterMigrationsUpToTarget(sourceMigrations, sourceMigrations, "001.sql")
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Migration{m1, s1}, migrations)
 }
 
 func TestCreateTenant(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
-	results := coordinator.CreateTenant("commit-sha", types.ActionSync, true, "NewTenant")
+	results, err := coordinator.CreateTenant("commit-sha", types.ActionSync, true, types.Tenant{Name: "NewTenant"})
+	assert.Nil(t, err)
 	assert.NotNil(t, results)
 	assert.NotNil(t, results.Summary)
 	assert.NotNil(t, results.Version)
 }
 
+func TestMigrationInProgress(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedLockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	expected := "another migration is in progress (holder: migrator-1:42, since: 2016-02-22T16:41:01Z)"
+
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, results)
+	assert.Equal(t, expected, err.Error())
+	var lockErr *db.LockHeldError
+	assert.True(t, errors.As(err, &lockErr))
+	assert.Equal(t, "migrator-1:42", lockErr.Holder)
+
+	_, err = coordinator.CreateTenant("commit-sha", types.ActionApply, false, types.Tenant{Name: "NewTenant"})
+	assert.Equal(t, expected, err.Error())
+
+	_, err = coordinator.DeleteTenant(types.DeleteTenantInput{TenantName: "a", VersionName: "commit-sha"})
+	assert.Equal(t, expected, err.Error())
+
+	_, err = coordinator.RollbackVersion(1, false)
+	assert.Equal(t, expected, err.Error())
+
+	_, err = coordinator.ResumeVersion(1, false)
+	assert.Equal(t, expected, err.Error())
+
+	_, err = coordinator.CatchUpTenants(types.CatchUpTenantsInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Equal(t, expected, err.Error())
+
+	_, err = coordinator.Repair(types.RepairInput{VersionName: "commit-sha"})
+	assert.Equal(t, expected, err.Error())
+}
+
+func TestRollbackVersion(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedRollbackConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RollbackVersion(1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Rollback of version 1", results.Version.Name)
+	// scripts and already rolled back migrations are skipped, migrations are rolled back in reverse order
+	assert.Equal(t, int32(2), results.Summary.MigrationsRolledBack)
+	assert.Equal(t, "tenants/201602220001.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, "abc", results.Version.DBMigrations[0].Schema)
+	assert.Equal(t, "source/201602220000.sql", results.Version.DBMigrations[1].File)
+}
+
+func TestRollbackVersionMissingDownMigration(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedRollbackConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RollbackVersion(2, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "migration source/201602220002.sql does not have down migration", err.Error())
+}
+
+func TestRollbackVersionAlreadyRolledBack(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedRollbackConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RollbackVersion(3, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "version 3 does not have any migrations to roll back", err.Error())
+}
+
+func TestRollbackVersionNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedRollbackConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.RollbackVersion(4, false)
+	assert.Nil(t, results)
+	assert.NotNil(t, err)
+}
+
+func TestCreateVersionOutOfOrderAllow(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedOutOfOrderConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, err)
+	assert.Nil(t, results.Summary.OutOfOrderMigrations)
+}
+
+func TestCreateVersionOutOfOrderWarn(t *testing.T) {
+	config := &config.Config{OutOfOrder: config.OutOfOrderWarn}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedOutOfOrderConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, err)
+	// config/201602220001.sql is from a different source directory
+	assert.Equal(t, []string{"source/201602220001.sql"}, results.Summary.OutOfOrderMigrations)
+	assert.Len(t, results.Version.DBMigrations, 5)
+}
+
+func TestCreateVersionOutOfOrderFail(t *testing.T) {
+	config := &config.Config{OutOfOrder: config.OutOfOrderFail}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedOutOfOrderConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, results)
+	assert.Equal(t, "out-of-order migrations found: source/201602220001.sql", err.Error())
+}
+
+func TestCreateVersionOutOfOrderFailInOrder(t *testing.T) {
+	config := &config.Config{OutOfOrder: config.OutOfOrderFail}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.CreateVersion(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply})
+	assert.Nil(t, err)
+	assert.Nil(t, results.Summary.OutOfOrderMigrations)
+}
+
+func TestSortMigrationsByDependencies(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "ref", File: "ref/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, DependsOn: []string{"ref/201602160003.sql", "ref/201602160001.sql"}}
+	m3 := types.Migration{Name: "201602160003.sql", SourceDir: "ref", File: "ref/201602160003.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m4 := types.Migration{Name: "201602160004.sql", SourceDir: "tenants", File: "tenants/201602160004.sql", MigrationType: types.MigrationTypeTenantMigration}
+
+	sourceMigrations := []types.Migration{m1, m2, m3, m4}
+	appliedMigrations := []types.DBMigration{{Migration: m1, Schema: "ref", Created: graphql.Time{Time: time.Now()}}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.sortMigrationsByDependencies(sourceMigrations, appliedMigrations, []types.Migration{m2, m3, m4})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Migration{m3, m2, m4}, migrations)
+}
+
+func TestSortMigrationsByDependenciesNotInSource(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, DependsOn: []string{"ref/201602160000.sql"}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.sortMigrationsByDependencies([]types.Migration{m1}, []types.DBMigration{}, []types.Migration{m1})
+
+	assert.Nil(t, migrations)
+	assert.Equal(t, "migration tenants/201602160001.sql depends on ref/201602160000.sql which does not exist in source migrations", err.Error())
+}
+
+func TestSortMigrationsByDependenciesNotPending(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "ref", File: "ref/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, DependsOn: []string{"ref/201602160001.sql"}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.sortMigrationsByDependencies([]types.Migration{m1, m2}, []types.DBMigration{}, []types.Migration{m2})
+
+	assert.Nil(t, migrations)
+	assert.Equal(t, "migration tenants/201602160002.sql depends on ref/201602160001.sql which is neither applied nor pending", err.Error())
+}
+
+func TestSortMigrationsByDependenciesCycle(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "ref", File: "ref/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, DependsOn: []string{"tenants/201602160002.sql"}}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, DependsOn: []string{"ref/201602160001.sql"}}
+
+	coordinator := &coordinator{ctx: context.TODO()}
+	migrations, err := coordinator.sortMigrationsByDependencies([]types.Migration{m1, m2}, []types.DBMigration{}, []types.Migration{m1, m2})
+
+	assert.Nil(t, migrations)
+	assert.Equal(t, "dependency cycle detected: ref/201602160001.sql -> tenants/201602160002.sql -> ref/201602160001.sql", err.Error())
+}
+
+func TestResumeVersion(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedPartialVersionConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ResumeVersion(1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "Resume of version 1", results.Version.Name)
+	// tenant c was already caught up, only tenant b is resumed
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, types.MigrationTypeTenantMigration, results.Version.DBMigrations[0].MigrationType)
+	assert.Equal(t, "b", results.Version.DBMigrations[0].Schema)
+}
+
+func TestResumeVersionNotPartial(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedPartialVersionConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ResumeVersion(2, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "version 2 is not partial", err.Error())
+}
+
+func TestResumeVersionAlreadyResumed(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedPartialVersionConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ResumeVersion(3, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "version 3 does not have any failed tenants to resume", err.Error())
+}
+
+func TestResumeVersionNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedPartialVersionConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	results, err := coordinator.ResumeVersion(4, false)
+	assert.Nil(t, results)
+	assert.Equal(t, "version not found", err.Error())
+}
+
+func TestCreateJob(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	job, err := coordinator.CreateJob(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), job.ID)
+	assert.Equal(t, types.JobStateQueued, job.State)
+	assert.Equal(t, "commit-sha", job.VersionName)
+}
+
+func TestCreateJobUnknownTenant(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	tenants := []string{"unknown"}
+	job, err := coordinator.CreateJob(types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true, Tenants: &tenants})
+	assert.Nil(t, job)
+	assert.NotNil(t, err)
+}
+
+func TestRunJob(t *testing.T) {
+	connector := &mockedJobConnector{}
+	connectorFactory := func(context.Context, *config.Config) db.Connector {
+		return connector
+	}
+	ctx := context.WithValue(context.TODO(), common.ProgressKey{}, &common.Progress{})
+	coordinator := New(ctx, nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job := &types.Job{ID: 1, State: types.JobStateQueued, VersionName: "commit-sha"}
+	coordinator.RunJob(job, types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true})
+
+	assert.True(t, len(connector.updates) >= 2)
+	assert.Equal(t, types.JobStateRunning, connector.updates[0].State)
+	last := connector.updates[len(connector.updates)-1]
+	assert.Equal(t, types.JobStateSucceeded, last.State)
+	assert.Nil(t, last.Error)
+	assert.NotNil(t, last.Results)
+	assert.Equal(t, "commit-sha", last.Results.Version.Name)
+	// 3 single migrations and 1 tenant migration in 3 tenants
+	assert.Equal(t, int32(6), last.MigrationsTotal)
+}
+
+func TestRunJobFailed(t *testing.T) {
+	connector := &mockedJobConnector{}
+	connectorFactory := func(context.Context, *config.Config) db.Connector {
+		return connector
+	}
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	tenants := []string{"unknown"}
+	job := &types.Job{ID: 1, State: types.JobStateQueued, VersionName: "commit-sha"}
+	coordinator.RunJob(job, types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true, Tenants: &tenants})
+
+	last := connector.updates[len(connector.updates)-1]
+	assert.Equal(t, types.JobStateFailed, last.State)
+	assert.Nil(t, last.Results)
+	assert.NotNil(t, last.Error)
+}
+
+func TestGetJob(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	job, err := coordinator.GetJob(1)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateRunning, job.State)
+	assert.Equal(t, int32(4), job.MigrationsApplied)
+
+	job, err = coordinator.GetJob(2)
+	assert.Nil(t, job)
+	assert.Equal(t, "job not found", err.Error())
+}
+
+func TestGetJobFailsStaleJobs(t *testing.T) {
+	connector := &mockedJobConnector{}
+	connectorFactory := func(context.Context, *config.Config) db.Connector {
+		return connector
+	}
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job, err := coordinator.GetJob(1)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), job.ID)
+	assert.Equal(t, jobStaleTimeout, connector.staleAfter)
+}
+
+func TestFailJob(t *testing.T) {
+	connector := &mockedJobConnector{}
+	connectorFactory := func(context.Context, *config.Config) db.Connector {
+		return connector
+	}
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job := &types.Job{ID: 1, State: types.JobStateRunning, VersionName: "commit-sha"}
+	coordinator.FailJob(job, "trouble maker")
+
+	assert.Len(t, connector.updates, 1)
+	assert.Equal(t, types.JobStateFailed, connector.updates[0].State)
+	assert.Equal(t, "trouble maker", *connector.updates[0].Error)
+}
+
+func TestRunJobCancelledBeforeStart(t *testing.T) {
+	connector := &mockedJobConnector{cancelRequested: true}
+	connectorFactory := func(context.Context, *config.Config) db.Connector {
+		return connector
+	}
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	job := &types.Job{ID: 1, State: types.JobStateQueued, VersionName: "commit-sha"}
+	coordinator.RunJob(job, types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true})
+
+	assert.Len(t, connector.updates, 1)
+	assert.Equal(t, types.JobStateCancelled, connector.updates[0].State)
+	assert.Equal(t, "job cancelled before it started", *connector.updates[0].Error)
+}
+
+func TestRunJobCancelled(t *testing.T) {
+	interval := jobProgressInterval
+	jobProgressInterval = 10 * time.Millisecond
+	defer func() { jobProgressInterval = interval }()
+
+	connector := &mockedCancellableJobConnector{}
+	connectorFactory := func(ctx context.Context, _ *config.Config) db.Connector {
+		connector.ctx = ctx
+		return connector
+	}
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), connectorFactory, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+
+	// first check is done before the job starts, cancellation is requested while the job is running
+	checks := 0
+	connector.onGetJob = func() {
+		checks++
+		connector.cancelRequested = checks > 1
+	}
+
+	job := &types.Job{ID: 1, State: types.JobStateQueued, VersionName: "commit-sha"}
+	coordinator.RunJob(job, types.VersionInput{VersionName: "commit-sha", Action: types.ActionApply, Async: true})
+
+	last := connector.updates[len(connector.updates)-1]
+	assert.Equal(t, types.JobStateCancelled, last.State)
+	assert.True(t, last.CancelRequested)
+	assert.Nil(t, last.Results)
+	assert.Contains(t, *last.Error, "context canceled")
+}
+
+func TestCancelJob(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newMockedNotifier)
+	defer coordinator.Dispose()
+	job, err := coordinator.CancelJob(1)
+	assert.Nil(t, err)
+	assert.True(t, job.CancelRequested)
+
+	job, err = coordinator.CancelJob(2)
+	assert.Nil(t, job)
+	assert.Equal(t, "job not found", err.Error())
+}
+
+func TestGetTenantStatus(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedLaggingTenantConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	status, err := coordinator.GetTenantStatus("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", status.Name)
+	assert.Equal(t, int32(1), status.AppliedMigrations)
+	assert.Empty(t, status.MissingMigrations)
+	assert.Empty(t, status.PendingMigrations)
+
+	status, err = coordinator.GetTenantStatus("c")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), status.AppliedMigrations)
+	assert.Len(t, status.MissingMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", status.MissingMigrations[0].File)
+	assert.Empty(t, status.PendingMigrations)
+}
+
+func TestGetTenantStatusPendingMigrations(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	status, err := coordinator.GetTenantStatus("a")
+	assert.Nil(t, err)
+	assert.Empty(t, status.MissingMigrations)
+	assert.Len(t, status.PendingMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", status.PendingMigrations[0].File)
+}
+
+func TestGetTenantStatusNotFound(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	status, err := coordinator.GetTenantStatus("xyz")
+	assert.Nil(t, status)
+	assert.Equal(t, "tenant not found: xyz", err.Error())
+}
+
+func TestCatchUpTenants(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedLaggingTenantConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	results, err := coordinator.CatchUpTenants(types.CatchUpTenantsInput{VersionName: "catch-up", Action: types.ActionApply})
+	assert.Nil(t, err)
+	// only tenant c is lagging and only missing tenant migration is applied
+	assert.Equal(t, int32(1), results.Summary.Tenants)
+	assert.Len(t, results.Version.DBMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", results.Version.DBMigrations[0].File)
+	assert.Equal(t, "c", results.Version.DBMigrations[0].Schema)
+}
+
+func TestCatchUpTenantsNotLagging(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedLaggingTenantConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+
+	tenants := []string{"a", "b"}
+	results, err := coordinator.CatchUpTenants(types.CatchUpTenantsInput{VersionName: "catch-up", Action: types.ActionApply, Tenants: &tenants})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), results.Summary.Tenants)
+	assert.Empty(t, results.Version.DBMigrations)
+}
+
 func TestHealthCheckDBAndLoaderOK(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
@@ -378,6 +1322,44 @@ func TestHealthCheckDBAndLoaderOK(t *testing.T) {
 	assert.Equal(t, types.HealthStatusUp, healthResponse.Checks[1].Status)
 }
 
+func TestHealthCheckMissingSourceMigrationsOK(t *testing.T) {
+	config := &config.Config{MissingSourceMigrationsHealthCheck: true}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedConnector, newMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	healthResponse := coordinator.HealthCheck()
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Status)
+	assert.Len(t, healthResponse.Checks, 3)
+	assert.Equal(t, "MissingSourceMigrations", healthResponse.Checks[2].Name)
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Checks[2].Status)
+}
+
+func TestHealthCheckMissingSourceMigrationsKO(t *testing.T) {
+	config := &config.Config{MissingSourceMigrationsHealthCheck: true}
+	coordinator := New(context.TODO(), config, newNoopMetrics(), newMockedOutOfOrderConnector, newBrokenCheckSumMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	healthResponse := coordinator.HealthCheck()
+	assert.Equal(t, types.HealthStatusDown, healthResponse.Status)
+	assert.Equal(t, "MissingSourceMigrations", healthResponse.Checks[2].Name)
+	assert.Equal(t, types.HealthStatusDown, healthResponse.Checks[2].Status)
+	assert.Equal(t, "applied migrations missing from source migrations: source/201602220002.sql", healthResponse.Checks[2].Data.Details)
+}
+
+func TestHealthCheckMissingSourceMigrationsDisabled(t *testing.T) {
+	coordinator := New(context.TODO(), &config.Config{}, newNoopMetrics(), newMockedOutOfOrderConnector, newBrokenCheckSumMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	healthResponse := coordinator.HealthCheck()
+	assert.Equal(t, types.HealthStatusUp, healthResponse.Status)
+	assert.Len(t, healthResponse.Checks, 2)
+}
+
+func TestGetMissingSourceMigrations(t *testing.T) {
+	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedOutOfOrderConnector, newBrokenCheckSumMockedDiskLoader, newErrorMockedNotifier)
+	defer coordinator.Dispose()
+	missing := coordinator.GetMissingSourceMigrations()
+	assert.Len(t, missing, 1)
+	assert.Equal(t, "source/201602220002.sql", missing[0].File)
+}
+
 func TestHealthCheckDBKO(t *testing.T) {
 	coordinator := New(context.TODO(), nil, newNoopMetrics(), newMockedConnectorHealthCheckError, newMockedDiskLoader, newErrorMockedNotifier)
 	defer coordinator.Dispose()
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"errors"
+
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/types"
 )
@@ -16,6 +18,13 @@ enum MigrationType {
   TenantMigration
   SingleScript
   TenantScript
+  Rollback
+  Repair
+  TenantDeletion
+  TenantFailure
+  SingleRepeatable
+  TenantRepeatable
+  Callback
 }
 enum Action {
   // Apply is the default action, migrator reads all source migrations and applies them
@@ -25,7 +34,34 @@ enum Action {
   // importing source migrations from a legacy tool or synchronising tenant migrations when tenant was created using external tool
   Sync
 }
+enum DeleteTenantMode {
+  // Unregister is the default mode, migrator only removes tenant entry (using tenantDelete statement), tenant schema is left untouched
+  Unregister
+  // Archive removes tenant entry and renames tenant schema (or database) to <tenant>_archived_<timestamp>
+  Archive
+  // Drop removes tenant entry and drops tenant schema (or database), requires confirmationToken equal to tenantName
+  Drop
+}
+enum LegacyTool {
+  // reads Flyway's flyway_schema_history table
+  Flyway
+  // reads Liquibase's DATABASECHANGELOG table
+  Liquibase
+  // reads golang-migrate's schema_migrations table
+  GolangMigrate
+}
+enum JobState {
+  // job was created and waits to be run
+  Queued
+  Running
+  Succeeded
+  Failed
+  // job was cancelled using cancelJob, its pending changes were rolled back
+  Cancelled
+}
 scalar Time
+// JSON object with tenant attributes, for example: {"tier": "enterprise", "region": "eu"}
+scalar Metadata
 interface Migration {
   name: String!
   migrationType: MigrationType!
@@ -33,6 +69,7 @@ interface Migration {
   file: String!
   contents: String!
   checkSum: String!
+  downContents: String!
 }
 type SourceMigration implements Migration {
   name: String!
@@ -41,6 +78,15 @@ type SourceMigration implements Migration {
   file: String!
   contents: String!
   checkSum: String!
+  downContents: String!
+  // files of migrations declared in migrator:depends-on header directives
+  dependsOn: [String!]!
+  // true when migration is run outside of version transaction
+  noTransaction: Boolean!
+  // tenant selector declared in migrator:tenants header directive or tenantSelectors config
+  tenantSelector: String!
+  // labels declared in migrator:labels header directive or labels config
+  labels: [String!]!
 }
 type DBMigration implements Migration {
   id: Int!
@@ -50,17 +96,40 @@ type DBMigration implements Migration {
   file: String!
   contents: String!
   checkSum: String!
+  downContents: String!
   schema: String!
   created: Time!
 }
 type Tenant {
   name: String!
+  // extra columns returned by tenantSelect or metadata stored in default tenants table
+  metadata: Metadata!
+}
+type CheckSumMismatch {
+  // source migration which was modified after it had been applied
+  sourceMigration: SourceMigration!
+  // checkSum of the applied DB migration
+  appliedCheckSum: String!
+  // contents of the applied DB migration
+  appliedContents: String!
+}
+type TenantStatus {
+  name: String!
+  // number of tenant migrations applied in tenant
+  appliedMigrations: Int!
+  // tenant migrations applied in other tenants but missing in this tenant
+  // for example when tenant was created outside of migrator
+  missingMigrations: [SourceMigration!]!
+  // tenant migrations not applied in any tenant yet
+  pendingMigrations: [SourceMigration!]!
 }
 type Version {
   id: Int!
   name: String!
   created: Time!
   dbMigrations: [DBMigration!]!
+  // true when migrations failed in some of the tenants, failed tenants can be resumed using resumeVersion()
+  partial: Boolean!
 }
 input SourceMigrationFilters {
   name: String
@@ -72,12 +141,69 @@ input VersionInput {
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  // optional name or file of the last source migration to apply
+  // pending migrations which sort after target are not applied, scripts are always applied
+  target: String
+  // optional list of tenants to which tenant migrations & scripts are applied, by default all tenants are used
+  tenants: [String!]
+  // optional pattern of tenants to which tenant migrations & scripts are applied, for example: "eu-*"
+  // tenants and tenantPattern cannot be used together
+  tenantPattern: String
+  // optional, when true createVersion fails if any applied migration was modified, defaults to verifyChecksums from config
+  verifyChecksums: Boolean
+  // when true createVersion returns immediately with a queued job, job's state and progress can be polled using job(id: Int!)
+  async: Boolean = false
+  // optional contexts, migrations with labels are applied only when one of their labels is among contexts
+  // defaults to contexts from config
+  contexts: [String!]
+}
+input CatchUpTenantsInput {
+  versionName: String!
+  action: Action = Apply
+  dryRun: Boolean = false
+  // optional list of tenants to catch up, by default all lagging tenants are caught up
+  tenants: [String!]
+  // optional pattern of tenants to catch up, for example: "eu-*"
+  // tenants and tenantPattern cannot be used together
+  tenantPattern: String
+}
+input DeleteTenantInput {
+  tenantName: String!
+  versionName: String!
+  mode: DeleteTenantMode = Unregister
+  // required by Drop mode, must be equal to tenantName
+  confirmationToken: String
+  dryRun: Boolean = false
+}
+input RepairInput {
+  versionName: String!
+  // files of modified source migrations whose contents and checkSum should be accepted, see verifyChecksums()
+  files: [String!]!
+  // repair runs in dry-run mode unless explicitly confirmed
+  confirm: Boolean = false
+}
+input ImportHistoryInput {
+  versionName: String!
+  tool: LegacyTool!
+  // optional name of history table, defaults to the tool's default history table
+  table: String
+  // optional schema of history table of single schema migrations
+  // by default history table is read from every single schema (schema named after source dir of single migrations)
+  schema: String
+  // optional list of tenants whose history tables are imported, by default all tenants are used
+  tenants: [String!]
+  // optional pattern of tenants whose history tables are imported, for example: "eu-*"
+  // tenants and tenantPattern cannot be used together
+  tenantPattern: String
+  dryRun: Boolean = false
 }
 input TenantInput {
   tenantName: String!
   versionName: String!
   action: Action = Apply
   dryRun: Boolean = false
+  // optional tenant attributes, tenant migrations & scripts whose tenant selectors don't match them are not applied
+  metadata: Metadata
 }
 type Summary {
   // date time operation started
@@ -102,10 +228,78 @@ type Summary {
   tenantScriptsTotal: Int!
   // sum of singleScripts and tenantScriptsTotal
   scriptsGrandTotal: Int!
+  // number of rolled back migrations (for all tenants)
+  migrationsRolledBack: Int!
+  // files of applied migrations which sort before already applied migrations from the same source directory
+  // reported only when outOfOrder policy is set to warn
+  outOfOrderMigrations: [String!]!
+  // number of repaired migrations
+  migrationsRepaired: Int!
+  // number of deleted tenants
+  tenantsDeleted: Int!
+  // files of migrations which were run outside of version transaction
+  nonTransactionalMigrations: [String!]!
+  // number of tenants whose migrations were applied successfully
+  tenantsSucceeded: Int!
+  // number of tenants whose migrations failed, reported only when failure policy is continue or stopAfterN
+  tenantsFailed: Int!
+  // errors of failed tenants
+  tenantFailures: [TenantFailure!]!
+  // files of pending migrations which were not applied because their labels don't match contexts
+  skippedMigrations: [String!]!
+}
+type TenantFailure {
+  tenant: String!
+  error: String!
 }
 type CreateResults {
   summary: Summary!
   version: Version
+  // set only for async createVersion
+  job: Job
+}
+type Job {
+  id: Int!
+  state: JobState!
+  versionName: String!
+  created: Time!
+  // date time job's state or progress was last updated
+  updated: Time!
+  // number of migrations & scripts (for all tenants) which job is going to apply, known once job is running
+  migrationsTotal: Int!
+  // number of migrations & scripts (for all tenants) which job applied so far
+  migrationsApplied: Int!
+  // set when job succeeded
+  results: CreateResults
+  // set when job failed or was cancelled
+  error: String
+  // true when cancellation of job was requested using cancelJob
+  cancelRequested: Boolean!
+}
+type RepairResults {
+  summary: Summary!
+  version: Version
+  // applied migrations whose source migrations no longer exist
+  missingSourceMigrations: [DBMigration!]!
+}
+type LegacyHistoryEntry {
+  // schema in which history table is stored
+  schema: String!
+  // Flyway version, Liquibase changeset id, or golang-migrate version
+  version: String!
+  // Flyway script or Liquibase changelog file
+  script: String!
+  description: String!
+  // Flyway checksum or Liquibase MD5 sum
+  checkSum: String!
+  // false for failed Flyway migrations, failed Liquibase changesets, and dirty golang-migrate version
+  success: Boolean!
+}
+type ImportHistoryResults {
+  summary: Summary!
+  version: Version
+  // entries of history table which were not imported, either failed or not matched to any source migration
+  unmatchedEntries: [LegacyHistoryEntry!]!
 }
 type Query {
   // returns array of SourceMigration objects
@@ -134,18 +328,56 @@ type Query {
   dbMigration(id: Int!): DBMigration
   // returns array of Tenant objects
   tenants(): [Tenant!]!
+  // returns status of tenant migrations in a single tenant
+  // name is the unique identifier of a tenant which you can get from tenants()
+  tenantStatus(name: String!): TenantStatus
+  // returns source migrations whose checkSum differs from the checkSum of applied DB migrations
+  // scripts are not verified as they are applied every time and are often updated
+  verifyChecksums: [CheckSumMismatch!]!
+  // returns applied DB migrations (one per file) whose source migrations no longer exist
+  // for example when source migration file was deleted or was not synced to loader's storage
+  missingSourceMigrations: [DBMigration!]!
+  // returns state, progress, and results of asynchronous createVersion job
+  // id is the unique identifier of a job which you can get from createVersion(input: {async: true})
+  job(id: Int!): Job
 }
 type Mutation {
   // creates new DB version by applying all eligible DB migrations & scripts
   createVersion(input: VersionInput!): CreateResults!
   // creates new tenant by applying only tenant-specific DB migrations & scripts, also creates new DB version
   createTenant(input: TenantInput!): CreateResults!
+  // deletes tenant, depending on the mode tenant schema is left untouched, archived, or dropped, also creates new DB version
+  deleteTenant(input: DeleteTenantInput!): CreateResults!
+  // creates new DB version by running down migrations of all migrations applied in given version (in reverse order)
+  // id is the unique identifier of a version which you can get from versions()
+  rollbackVersion(id: Int!, dryRun: Boolean = false): CreateResults!
+  // creates new DB version by applying again tenant migrations & scripts to tenants which failed in given partial version
+  // tenants which were caught up since then are skipped
+  resumeVersion(id: Int!, dryRun: Boolean = false): CreateResults!
+  // creates new DB version by applying to each lagging tenant only tenant migrations which are missing in it
+  // missing tenant migrations are the ones applied in other tenants but not in the lagging tenant
+  catchUpTenants(input: CatchUpTenantsInput!): CreateResults!
+  // updates contents and checkSum of applied migrations to match their modified source migrations
+  // every repaired migration is recorded in a new DB version as Repair entry which stores replaced contents and checkSum
+  repair(input: RepairInput!): RepairResults!
+  // creates new Sync DB version containing only source migrations applied by legacy tool (Flyway, Liquibase, or golang-migrate)
+  // history entries are matched to source migrations by name or checksum, unmatched entries are returned in the results
+  importHistory(input: ImportHistoryInput!): ImportHistoryResults!
+  // requests cancellation of queued or running asynchronous createVersion job
+  // the job is cancelled by the migrator which runs it, running statements are cancelled and transactions rolled back
+  cancelJob(id: Int!): Job!
 }
 `
 
+// JobRunner runs asynchronous jobs in background
+type JobRunner interface {
+	Submit(*types.Job, types.VersionInput)
+}
+
 // RootResolver is resolver for all the migrator data
 type RootResolver struct {
 	Coordinator coordinator.Coordinator
+	Jobs        JobRunner
 }
 
 // Tenants resolves all tenants
@@ -154,6 +386,25 @@ func (r *RootResolver) Tenants() ([]types.Tenant, error) {
 	return tenants, nil
 }
 
+// TenantStatus resolves status of tenant migrations in a tenant
+func (r *RootResolver) TenantStatus(args struct {
+	Name string
+}) (*types.TenantStatus, error) {
+	return r.Coordinator.GetTenantStatus(args.Name)
+}
+
+// VerifyChecksums resolves source migrations which were modified after they had been applied
+func (r *RootResolver) VerifyChecksums() ([]types.CheckSumMismatch, error) {
+	mismatches := r.Coordinator.GetCheckSumMismatches()
+	return mismatches, nil
+}
+
+// MissingSourceMigrations resolves applied DB migrations whose source migrations no longer exist
+func (r *RootResolver) MissingSourceMigrations() ([]types.DBMigration, error) {
+	missing := r.Coordinator.GetMissingSourceMigrations()
+	return missing, nil
+}
+
 // Versions resoves all versions, optionally can return versions with specific source migration (file is the identifier for source migrations)
 func (r *RootResolver) Versions(args struct {
 	File *string
@@ -193,18 +444,89 @@ func (r *RootResolver) DBMigration(args struct {
 	return r.Coordinator.GetDBMigrationByID(args.ID)
 }
 
-// CreateVersion creates new DB version
+// Job resolves asynchronous job by ID
+func (r *RootResolver) Job(args struct {
+	ID int32
+}) (*types.Job, error) {
+	return r.Coordinator.GetJob(args.ID)
+}
+
+// CancelJob requests cancellation of asynchronous job
+func (r *RootResolver) CancelJob(args struct {
+	ID int32
+}) (*types.Job, error) {
+	return r.Coordinator.CancelJob(args.ID)
+}
+
+// CreateVersion creates new DB version, async versions are created in background by a job
 func (r *RootResolver) CreateVersion(args struct {
 	Input types.VersionInput
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateVersion(args.Input.VersionName, args.Input.Action, args.Input.DryRun)
-	return results, nil
+	if !args.Input.Async {
+		return r.Coordinator.CreateVersion(args.Input)
+	}
+	if r.Jobs == nil {
+		return nil, errors.New("async createVersion is not supported")
+	}
+	job, err := r.Coordinator.CreateJob(args.Input)
+	if err != nil {
+		return nil, err
+	}
+	r.Jobs.Submit(job, args.Input)
+	return &types.CreateResults{Summary: &types.Summary{StartedAt: job.Created}, Job: job}, nil
 }
 
 // CreateTenant creates new tenant
 func (r *RootResolver) CreateTenant(args struct {
 	Input types.TenantInput
 }) (*types.CreateResults, error) {
-	results := r.Coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, args.Input.TenantName)
-	return results, nil
+	tenant := types.Tenant{Name: args.Input.TenantName}
+	if args.Input.Metadata != nil {
+		tenant.Metadata = *args.Input.Metadata
+	}
+	return r.Coordinator.CreateTenant(args.Input.VersionName, args.Input.Action, args.Input.DryRun, tenant)
+}
+
+// DeleteTenant deletes tenant
+func (r *RootResolver) DeleteTenant(args struct {
+	Input types.DeleteTenantInput
+}) (*types.CreateResults, error) {
+	return r.Coordinator.DeleteTenant(args.Input)
+}
+
+// RollbackVersion rolls back DB version
+func (r *RootResolver) RollbackVersion(args struct {
+	ID     int32
+	DryRun bool
+}) (*types.CreateResults, error) {
+	return r.Coordinator.RollbackVersion(args.ID, args.DryRun)
+}
+
+// ResumeVersion applies again migrations of tenants which failed in given version
+func (r *RootResolver) ResumeVersion(args struct {
+	ID     int32
+	DryRun bool
+}) (*types.CreateResults, error) {
+	return r.Coordinator.ResumeVersion(args.ID, args.DryRun)
+}
+
+// Repair repairs contents and checksums of applied migrations
+func (r *RootResolver) Repair(args struct {
+	Input types.RepairInput
+}) (*types.RepairResults, error) {
+	return r.Coordinator.Repair(args.Input)
+}
+
+// ImportHistory imports history of legacy migration tool as a Sync version
+func (r *RootResolver) ImportHistory(args struct {
+	Input types.ImportHistoryInput
+}) (*types.ImportHistoryResults, error) {
+	return r.Coordinator.ImportHistory(args.Input)
+}
+
+// CatchUpTenants applies missing tenant migrations to lagging tenants
+func (r *RootResolver) CatchUpTenants(args struct {
+	Input types.CatchUpTenantsInput
+}) (*types.CreateResults, error) {
+	return r.Coordinator.CatchUpTenants(args.Input)
 }
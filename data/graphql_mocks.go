@@ -1,15 +1,20 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
 	"github.com/lukaszbudnik/migrator/coordinator"
+	"github.com/lukaszbudnik/migrator/db"
 	"github.com/lukaszbudnik/migrator/types"
 )
 
 type mockedCoordinator struct {
+	// tenant passed to CreateTenant
+	tenant types.Tenant
 }
 
 func (m *mockedCoordinator) safeString(value *string) string {
@@ -19,15 +24,146 @@ func (m *mockedCoordinator) safeString(value *string) string {
 	return *value
 }
 
-func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) *types.CreateResults {
+func (m *mockedCoordinator) CreateTenant(_ string, _ types.Action, _ bool, tenant types.Tenant) (*types.CreateResults, error) {
+	if tenant.Name == "locked" {
+		return nil, &db.LockHeldError{Holder: "migrator-1:42", Since: time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)}
+	}
+	m.tenant = tenant
+	version, _ := m.GetVersionByID(0)
+	return &types.CreateResults{Summary: &types.Summary{}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) DeleteTenant(input types.DeleteTenantInput) (*types.CreateResults, error) {
+	if input.Mode == types.DeleteTenantModeDrop && (input.ConfirmationToken == nil || *input.ConfirmationToken != input.TenantName) {
+		return nil, errors.New("confirmation token does not match tenant name: " + input.TenantName)
+	}
+	version, _ := m.GetVersionByID(0)
+	return &types.CreateResults{Summary: &types.Summary{TenantsDeleted: 1}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) CreateVersion(input types.VersionInput) (*types.CreateResults, error) {
+	if input.Target != nil && *input.Target == "unknown.sql" {
+		return nil, errors.New("target source migration not found: unknown.sql")
+	}
+	summary := &types.Summary{}
+	seed := types.Migration{File: "seeds/201602220001.sql", Labels: []string{"test"}}
+	if input.Contexts != nil && !seed.MatchesContexts(*input.Contexts) {
+		summary.SkippedMigrations = []string{seed.File}
+	}
+	// re-use mocked version from GetVersionByID...
+	version, _ := m.GetVersionByID(0)
+	return &types.CreateResults{Summary: summary, Version: version}, nil
+}
+
+func (m *mockedCoordinator) CreateJob(input types.VersionInput) (*types.Job, error) {
+	if input.Target != nil && *input.Target == "unknown.sql" {
+		return nil, errors.New("target source migration not found: unknown.sql")
+	}
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	return &types.Job{ID: 1, State: types.JobStateQueued, VersionName: input.VersionName, Created: graphql.Time{Time: d1}, Updated: graphql.Time{Time: d1}}, nil
+}
+
+// not used in GraphQL, jobs are run by JobRunner
+func (m *mockedCoordinator) RunJob(*types.Job, types.VersionInput) {
+}
+
+func (m *mockedCoordinator) FailJob(*types.Job, string) {
+}
+
+func (m *mockedCoordinator) GetJob(ID int32) (*types.Job, error) {
+	d1 := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	switch ID {
+	case 1:
+		return &types.Job{ID: ID, State: types.JobStateRunning, VersionName: "a", Created: graphql.Time{Time: d1}, Updated: graphql.Time{Time: d1}, MigrationsTotal: 10, MigrationsApplied: 4}, nil
+	case 2:
+		version, _ := m.GetVersionByID(ID)
+		results := &types.CreateResults{Summary: &types.Summary{}, Version: version}
+		return &types.Job{ID: ID, State: types.JobStateSucceeded, VersionName: "a", Created: graphql.Time{Time: d1}, Updated: graphql.Time{Time: d1}, MigrationsTotal: 5, MigrationsApplied: 5, Results: results}, nil
+	case 3:
+		jobError := "trouble maker"
+		return &types.Job{ID: ID, State: types.JobStateFailed, VersionName: "a", Created: graphql.Time{Time: d1}, Updated: graphql.Time{Time: d1}, MigrationsTotal: 5, MigrationsApplied: 2, Error: &jobError}, nil
+	}
+	return nil, fmt.Errorf("job not found ID: %v", ID)
+}
+
+func (m *mockedCoordinator) CancelJob(ID int32) (*types.Job, error) {
+	job, err := m.GetJob(ID)
+	if err != nil {
+		return nil, err
+	}
+	if job.State != types.JobStateQueued && job.State != types.JobStateRunning {
+		return nil, fmt.Errorf("job %v already finished with state: %v", ID, job.State)
+	}
+	job.CancelRequested = true
+	return job, nil
+}
+
+type mockedJobRunner struct {
+	submitted []types.Job
+}
+
+func (m *mockedJobRunner) Submit(job *types.Job, input types.VersionInput) {
+	m.submitted = append(m.submitted, *job)
+}
+
+func (m *mockedCoordinator) RollbackVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	if ID == 0 {
+		return nil, errors.New("version 0 does not have any migrations to roll back")
+	}
+	version, _ := m.GetVersionByID(ID)
+	return &types.CreateResults{Summary: &types.Summary{MigrationsRolledBack: 1}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) ResumeVersion(ID int32, dryRun bool) (*types.CreateResults, error) {
+	if ID == 0 {
+		return nil, errors.New("version 0 is not partial")
+	}
+	version, _ := m.GetVersionByID(ID)
+	return &types.CreateResults{Summary: &types.Summary{TenantsSucceeded: 1}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) GetTenantStatus(name string) (*types.TenantStatus, error) {
+	if name == "unknown" {
+		return nil, errors.New("tenant not found: unknown")
+	}
+	m1 := types.Migration{Name: "201602220003.sql", SourceDir: "tenant", File: "tenant/201602220003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select def"}
+	m2 := types.Migration{Name: "201602220004.sql", SourceDir: "tenant", File: "tenant/201602220004.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "select ghi"}
+	return &types.TenantStatus{Name: name, AppliedMigrations: 2, MissingMigrations: []types.Migration{m1}, PendingMigrations: []types.Migration{m2}}, nil
+}
+
+func (m *mockedCoordinator) CatchUpTenants(input types.CatchUpTenantsInput) (*types.CreateResults, error) {
+	// re-use mocked version from GetVersionByID...
+	version, _ := m.GetVersionByID(0)
+	return &types.CreateResults{Summary: &types.Summary{Tenants: 2}, Version: version}, nil
+}
+
+func (m *mockedCoordinator) Repair(input types.RepairInput) (*types.RepairResults, error) {
+	if len(input.Files) > 0 && input.Files[0] == "unknown.sql" {
+		return nil, errors.New("migration does not need repair: " + input.Files[0])
+	}
+	mdef := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	missing := []types.DBMigration{{Migration: mdef, ID: 3, Schema: "source", Created: graphql.Time{Time: time.Now()}}}
+	summary := &types.Summary{MigrationsRepaired: int32(len(input.Files))}
+	if !input.Confirm {
+		return &types.RepairResults{Summary: summary, MissingSourceMigrations: missing}, nil
+	}
+	// re-use mocked version from GetVersionByID...
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.Summary{}, Version: version}
+	return &types.RepairResults{Summary: summary, Version: version, MissingSourceMigrations: missing}, nil
 }
 
-func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) *types.CreateResults {
+func (m *mockedCoordinator) ImportHistory(input types.ImportHistoryInput) (*types.ImportHistoryResults, error) {
+	if input.Tenants != nil && input.TenantPattern != nil {
+		return nil, errors.New("tenants and tenantPattern cannot be used together")
+	}
+	unmatched := []types.LegacyHistoryEntry{{Schema: "source", Version: "1", Description: "<< Flyway Baseline >>", Script: "<< Flyway Baseline >>", Success: true}}
+	summary := &types.Summary{SingleMigrations: 2}
+	if input.DryRun {
+		return &types.ImportHistoryResults{Summary: summary, UnmatchedEntries: unmatched}, nil
+	}
 	// re-use mocked version from GetVersionByID...
 	version, _ := m.GetVersionByID(0)
-	return &types.CreateResults{Summary: &types.Summary{}, Version: version}
+	return &types.ImportHistoryResults{Summary: summary, Version: version, UnmatchedEntries: unmatched}, nil
 }
 
 func (m *mockedCoordinator) GetSourceMigrations(filters *coordinator.SourceMigrationFilters) []types.Migration {
@@ -57,7 +193,7 @@ func (m *mockedCoordinator) Dispose() {
 }
 
 func (m *mockedCoordinator) GetTenants() []types.Tenant {
-	a := types.Tenant{Name: "a"}
+	a := types.Tenant{Name: "a", Metadata: types.TenantMetadata{"tier": "enterprise"}}
 	b := types.Tenant{Name: "b"}
 	c := types.Tenant{Name: "c"}
 	return []types.Tenant{a, b, c}
@@ -111,6 +247,16 @@ func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Mig
 	return true, nil
 }
 
+func (m *mockedCoordinator) GetCheckSumMismatches() []types.CheckSumMismatch {
+	m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "sha256"}
+	return []types.CheckSumMismatch{{SourceMigration: m1, AppliedCheckSum: "sha256-applied"}}
+}
+
+func (m *mockedCoordinator) GetMissingSourceMigrations() []types.DBMigration {
+	mdef := types.Migration{Name: "201602220002.sql", SourceDir: "source", File: "source/201602220002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select def"}
+	return []types.DBMigration{{Migration: mdef, ID: 3, Schema: "source", Created: graphql.Time{Time: time.Now()}}}
+}
+
 func (m *mockedCoordinator) HealthCheck() types.HealthResponse {
 	return types.HealthResponse{Status: types.HealthStatusUp, Checks: []types.HealthChecks{}}
 }
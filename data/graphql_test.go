@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/graph-gophers/graphql-go"
+	"github.com/lukaszbudnik/migrator/types"
 )
 
 func TestTenants(t *testing.T) {
@@ -32,6 +33,69 @@ func TestTenants(t *testing.T) {
 	assert.Equal(t, 3, results)
 }
 
+func TestTenantsMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Tenants"
+	query := `query Tenants {
+      tenants {
+        name
+        metadata
+      }
+    }`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	tenants := jsonMap["tenants"].([]interface{})
+	assert.Equal(t, map[string]interface{}{"tier": "enterprise"}, tenants[0].(map[string]interface{})["metadata"])
+	// tenants without metadata return empty object
+	assert.Equal(t, map[string]interface{}{}, tenants[1].(map[string]interface{})["metadata"])
+}
+
+func TestCreateTenantMetadata(t *testing.T) {
+	ctx := context.Background()
+
+	coordinator := &mockedCoordinator{}
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: coordinator}, opts...)
+
+	opName := "CreateTenant"
+	query := `mutation CreateTenant($input: TenantInput!) {
+  createTenant(input: $input) {
+    summary {
+      tenants
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"tenantName":  "new-tenant",
+			"metadata": map[string]interface{}{
+				"tier":  "enterprise",
+				"shard": 3,
+			},
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Nil(t, resp.Errors)
+	assert.Equal(t, types.Tenant{Name: "new-tenant", Metadata: types.TenantMetadata{"tier": "enterprise", "shard": "3"}}, coordinator.tenant)
+
+	// metadata values cannot be objects
+	variables["input"].(map[string]interface{})["metadata"] = map[string]interface{}{"tier": map[string]interface{}{"name": "enterprise"}}
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.NotNil(t, resp.Errors)
+	assert.Contains(t, resp.Errors[0].Message, "wrong type for Metadata value of key tier")
+}
+
 func TestVersions(t *testing.T) {
 	ctx := context.Background()
 
@@ -634,3 +698,786 @@ func TestCreateTenantNonDefaultParams(t *testing.T) {
 	// we return only 4 fields in above query others should be nil including duration
 	assert.Nil(t, summary["duration"])
 }
+
+func TestRollbackVersion(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RollbackVersion"
+	query := `mutation RollbackVersion($id: Int!, $dryRun: Boolean) {
+  rollbackVersion(id: $id, dryRun: $dryRun) {
+    version {
+      id,
+      name,
+      dbMigrations {
+        file
+        downContents
+      }
+    }
+    summary {
+      startedAt
+      migrationsRolledBack
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id":     123,
+		"dryRun": true,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["rollbackVersion"].(map[string]interface{})
+
+	version := results["version"].(map[string]interface{})
+	assert.Equal(t, float64(123), version["id"])
+	assert.NotEmpty(t, version["dbMigrations"])
+
+	summary := results["summary"].(map[string]interface{})
+	assert.NotNil(t, summary["startedAt"])
+	assert.Equal(t, float64(1), summary["migrationsRolledBack"])
+}
+
+func TestRollbackVersionError(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "RollbackVersion"
+	query := `mutation RollbackVersion($id: Int!) {
+  rollbackVersion(id: $id) {
+    summary {
+      migrationsRolledBack
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id": 0,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "version 0 does not have any migrations to roll back", resp.Errors[0].Message)
+}
+
+func TestResumeVersion(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "ResumeVersion"
+	query := `mutation ResumeVersion($id: Int!, $dryRun: Boolean) {
+  resumeVersion(id: $id, dryRun: $dryRun) {
+    version {
+      id,
+      partial
+    }
+    summary {
+      tenantsSucceeded
+      tenantsFailed
+      tenantFailures {
+        tenant
+        error
+      }
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id":     123,
+		"dryRun": true,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["resumeVersion"].(map[string]interface{})
+
+	version := results["version"].(map[string]interface{})
+	assert.Equal(t, float64(123), version["id"])
+	assert.Equal(t, false, version["partial"])
+
+	summary := results["summary"].(map[string]interface{})
+	assert.Equal(t, float64(1), summary["tenantsSucceeded"])
+	assert.Equal(t, float64(0), summary["tenantsFailed"])
+	assert.Empty(t, summary["tenantFailures"])
+}
+
+func TestResumeVersionError(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "ResumeVersion"
+	query := `mutation ResumeVersion($id: Int!) {
+  resumeVersion(id: $id) {
+    summary {
+      tenantsSucceeded
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"id": 0,
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "version 0 is not partial", resp.Errors[0].Message)
+}
+
+func TestCreateTenantMigrationInProgress(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateTenant"
+	query := `mutation CreateTenant($input: TenantInput!) {
+  createTenant(input: $input) {
+    summary {
+      tenants
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"tenantName":  "locked",
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "another migration is in progress (holder: migrator-1:42, since: 2016-02-22T16:41:01Z)", resp.Errors[0].Message)
+	assert.Equal(t, "MIGRATION_IN_PROGRESS", resp.Errors[0].Extensions["code"])
+	assert.Equal(t, "migrator-1:42", resp.Errors[0].Extensions["holder"])
+}
+
+func TestCreateVersionTarget(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    version {
+      id,
+      name,
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"target":      "source/201602220001.sql",
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["createVersion"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"target":      "unknown.sql",
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "target source migration not found: unknown.sql", resp.Errors[0].Message)
+}
+
+func TestCreateVersionContexts(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      skippedMigrations
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"contexts":    []interface{}{"prod"},
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	summary := jsonMap["createVersion"].(map[string]interface{})["summary"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"seeds/201602220001.sql"}, summary["skippedMigrations"])
+
+	variables["input"].(map[string]interface{})["contexts"] = []interface{}{"test"}
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	summary = jsonMap["createVersion"].(map[string]interface{})["summary"].(map[string]interface{})
+	assert.Equal(t, []interface{}{}, summary["skippedMigrations"])
+}
+
+func TestCreateVersionTenants(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    summary {
+      tenants
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"tenants":     []interface{}{"abc", "def"},
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName":   "commit-sha",
+			"tenantPattern": "eu-*",
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+}
+
+func TestTenantStatus(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "TenantStatus"
+	query := `query TenantStatus($name: String!) {
+  tenantStatus(name: $name) {
+    name
+    appliedMigrations
+    missingMigrations {
+      file
+    }
+    pendingMigrations {
+      file
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"name": "abc",
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	status := jsonMap["tenantStatus"].(map[string]interface{})
+	assert.Equal(t, "abc", status["name"])
+	assert.Equal(t, float64(2), status["appliedMigrations"])
+	missingMigrations := status["missingMigrations"].([]interface{})
+	assert.Len(t, missingMigrations, 1)
+	assert.Equal(t, "tenant/201602220003.sql", missingMigrations[0].(map[string]interface{})["file"])
+	pendingMigrations := status["pendingMigrations"].([]interface{})
+	assert.Len(t, pendingMigrations, 1)
+	assert.Equal(t, "tenant/201602220004.sql", pendingMigrations[0].(map[string]interface{})["file"])
+
+	variables = map[string]interface{}{
+		"name": "unknown",
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "tenant not found: unknown", resp.Errors[0].Message)
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "VerifyChecksums"
+	query := `query VerifyChecksums {
+  verifyChecksums {
+    sourceMigration {
+      file
+      checkSum
+    }
+    appliedCheckSum
+  }
+}`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	mismatches := jsonMap["verifyChecksums"].([]interface{})
+	assert.Len(t, mismatches, 1)
+	mismatch := mismatches[0].(map[string]interface{})
+	sourceMigration := mismatch["sourceMigration"].(map[string]interface{})
+	assert.Equal(t, "source/201602220000.sql", sourceMigration["file"])
+	assert.Equal(t, "sha256", sourceMigration["checkSum"])
+	assert.Equal(t, "sha256-applied", mismatch["appliedCheckSum"])
+}
+
+func TestCatchUpTenants(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CatchUpTenants"
+	query := `mutation CatchUpTenants($input: CatchUpTenantsInput!) {
+  catchUpTenants(input: $input) {
+    version {
+      id,
+      name,
+    }
+    summary {
+      tenants
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "catch-up",
+			"dryRun":      true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["catchUpTenants"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+	summary := results["summary"].(map[string]interface{})
+	assert.Equal(t, float64(2), summary["tenants"])
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Repair"
+	query := `mutation Repair($input: RepairInput!) {
+  repair(input: $input) {
+    version {
+      id,
+      name,
+    }
+    summary {
+      migrationsRepaired
+    }
+    missingSourceMigrations {
+      file
+      migrationType
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "repair",
+			"files":       []interface{}{"source/201602220000.sql"},
+			"confirm":     true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["repair"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+	summary := results["summary"].(map[string]interface{})
+	assert.Equal(t, float64(1), summary["migrationsRepaired"])
+	missingSourceMigrations := results["missingSourceMigrations"].([]interface{})
+	assert.Len(t, missingSourceMigrations, 1)
+	assert.Equal(t, "source/201602220002.sql", missingSourceMigrations[0].(map[string]interface{})["file"])
+
+	// confirm defaults to false
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "repair",
+			"files":       []interface{}{"source/201602220000.sql"},
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap = make(map[string]interface{})
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results = jsonMap["repair"].(map[string]interface{})
+	assert.Nil(t, results["version"])
+
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "repair",
+			"files":       []interface{}{"unknown.sql"},
+			"confirm":     true,
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "migration does not need repair: unknown.sql", resp.Errors[0].Message)
+}
+
+func TestImportHistory(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "ImportHistory"
+	query := `mutation ImportHistory($input: ImportHistoryInput!) {
+  importHistory(input: $input) {
+    version {
+      id,
+      name,
+    }
+    summary {
+      singleMigrations
+    }
+    unmatchedEntries {
+      schema
+      version
+      script
+      checkSum
+      success
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "import",
+			"tool":        "Flyway",
+			"tenants":     []interface{}{"a", "b"},
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["importHistory"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+	summary := results["summary"].(map[string]interface{})
+	assert.Equal(t, float64(2), summary["singleMigrations"])
+	unmatchedEntries := results["unmatchedEntries"].([]interface{})
+	assert.Len(t, unmatchedEntries, 1)
+	assert.Equal(t, "<< Flyway Baseline >>", unmatchedEntries[0].(map[string]interface{})["script"])
+
+	// dry run
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "import",
+			"tool":        "GolangMigrate",
+			"dryRun":      true,
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap = make(map[string]interface{})
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results = jsonMap["importHistory"].(map[string]interface{})
+	assert.Nil(t, results["version"])
+
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName":   "import",
+			"tool":          "Liquibase",
+			"tenants":       []interface{}{"a"},
+			"tenantPattern": "a*",
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "tenants and tenantPattern cannot be used together", resp.Errors[0].Message)
+}
+
+func TestMissingSourceMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "MissingSourceMigrations"
+	query := `query MissingSourceMigrations {
+  missingSourceMigrations {
+    id
+    file
+    schema
+  }
+}`
+	variables := map[string]interface{}{}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	missing := jsonMap["missingSourceMigrations"].([]interface{})
+	assert.Len(t, missing, 1)
+	assert.Equal(t, "source/201602220002.sql", missing[0].(map[string]interface{})["file"])
+}
+
+func TestDeleteTenant(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "DeleteTenant"
+	query := `mutation DeleteTenant($input: DeleteTenantInput!) {
+  deleteTenant(input: $input) {
+    version {
+      id,
+      name,
+    }
+    summary {
+      tenantsDeleted
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"tenantName":  "abc",
+			"versionName": "delete-abc",
+			"mode":        "Archive",
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["deleteTenant"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+	summary := results["summary"].(map[string]interface{})
+	assert.Equal(t, float64(1), summary["tenantsDeleted"])
+
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"tenantName":  "abc",
+			"versionName": "delete-abc",
+			"mode":        "Drop",
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "confirmation token does not match tenant name: abc", resp.Errors[0].Message)
+}
+
+func TestCreateVersionAsync(t *testing.T) {
+	ctx := context.Background()
+
+	jobs := &mockedJobRunner{}
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}, Jobs: jobs}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    version {
+      id
+    }
+    job {
+      id,
+      state,
+      versionName
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	results := jsonMap["createVersion"].(map[string]interface{})
+	assert.Nil(t, results["version"])
+	job := results["job"].(map[string]interface{})
+	assert.Equal(t, float64(1), job["id"])
+	assert.Equal(t, "Queued", job["state"])
+	assert.Equal(t, "commit-sha", job["versionName"])
+	assert.Len(t, jobs.submitted, 1)
+
+	// input is validated before job is submitted
+	variables = map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"target":      "unknown.sql",
+			"async":       true,
+		},
+	}
+
+	resp = schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "target source migration not found: unknown.sql", resp.Errors[0].Message)
+	assert.Len(t, jobs.submitted, 1)
+}
+
+func TestCreateVersionAsyncNotSupported(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CreateVersion"
+	query := `mutation CreateVersion($input: VersionInput!) {
+  createVersion(input: $input) {
+    job {
+      id
+    }
+  }
+}`
+	variables := map[string]interface{}{
+		"input": map[string]interface{}{
+			"versionName": "commit-sha",
+			"async":       true,
+		},
+	}
+
+	resp := schema.Exec(ctx, query, opName, variables)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "async createVersion is not supported", resp.Errors[0].Message)
+}
+
+func TestJob(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "Job"
+	query := `query Job($id: Int!) {
+  job(id: $id) {
+    id,
+    state,
+    migrationsTotal,
+    migrationsApplied,
+    results {
+      version {
+        id
+      }
+    }
+    error
+  }
+}`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{"id": 1})
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job := jsonMap["job"].(map[string]interface{})
+	assert.Equal(t, "Running", job["state"])
+	assert.Equal(t, float64(10), job["migrationsTotal"])
+	assert.Equal(t, float64(4), job["migrationsApplied"])
+	assert.Nil(t, job["results"])
+	assert.Nil(t, job["error"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": 2})
+	assert.Empty(t, resp.Errors)
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job = jsonMap["job"].(map[string]interface{})
+	assert.Equal(t, "Succeeded", job["state"])
+	results := job["results"].(map[string]interface{})
+	assert.NotNil(t, results["version"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": 3})
+	assert.Empty(t, resp.Errors)
+	err = json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job = jsonMap["job"].(map[string]interface{})
+	assert.Equal(t, "Failed", job["state"])
+	assert.Equal(t, "trouble maker", job["error"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": 4})
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "job not found ID: 4", resp.Errors[0].Message)
+}
+
+func TestCancelJob(t *testing.T) {
+	ctx := context.Background()
+
+	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
+	schema := graphql.MustParseSchema(SchemaDefinition, &RootResolver{Coordinator: &mockedCoordinator{}}, opts...)
+
+	opName := "CancelJob"
+	query := `mutation CancelJob($id: Int!) {
+  cancelJob(id: $id) {
+    id,
+    state,
+    cancelRequested
+  }
+}`
+
+	resp := schema.Exec(ctx, query, opName, map[string]interface{}{"id": 1})
+	assert.Empty(t, resp.Errors)
+	jsonMap := make(map[string]interface{})
+	err := json.Unmarshal(resp.Data, &jsonMap)
+	assert.Nil(t, err)
+	job := jsonMap["cancelJob"].(map[string]interface{})
+	assert.Equal(t, "Running", job["state"])
+	assert.Equal(t, true, job["cancelRequested"])
+
+	resp = schema.Exec(ctx, query, opName, map[string]interface{}{"id": 2})
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, "job 2 already finished with state: Succeeded", resp.Errors[0].Message)
+}
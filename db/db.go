@@ -3,10 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/graph-gophers/graphql-go"
@@ -24,8 +27,18 @@ type Connector interface {
 	GetVersionByID(ID int32) (*types.Version, error)
 	GetDBMigrationByID(ID int32) (*types.DBMigration, error)
 	GetAppliedMigrations() []types.DBMigration
-	CreateVersion(string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version)
-	CreateTenant(string, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version)
+	CreateVersion(string, types.Action, []types.Migration, map[string][]types.Migration, bool) (*types.Summary, *types.Version)
+	CreateTenant(types.Tenant, string, types.Action, []types.Migration, bool) (*types.Summary, *types.Version)
+	DeleteTenant(string, string, types.DeleteTenantMode, bool) (*types.Summary, *types.Version)
+	RollbackVersion(string, []types.DBMigration, bool) (*types.Summary, *types.Version)
+	RepairMigrations(string, []types.CheckSumMismatch, bool) (*types.Summary, *types.Version)
+	GetLegacyHistory(types.LegacyTool, string, []string) []types.LegacyHistoryEntry
+	Lock() (func(), error)
+	CreateJob(string) *types.Job
+	UpdateJob(*types.Job) error
+	GetJobByID(int32) (*types.Job, error)
+	CancelJob(int32) (*types.Job, error)
+	FailStaleJobs(time.Duration, string) error
 	HealthCheck() error
 	Dispose()
 }
@@ -57,6 +70,10 @@ const (
 	migratorTenantsTable     = "migrator_tenants"
 	migratorMigrationsTable  = "migrator_migrations"
 	migratorVersionsTable    = "migrator_versions"
+	migratorLocksTable       = "migrator_locks"
+	migratorJobsTable        = "migrator_jobs"
+	tenantMetadataColumn     = "metadata"
+	migrationLockName        = "migrator"
 	defaultSchemaPlaceHolder = "{schema}"
 )
 
@@ -72,32 +89,40 @@ func (bc *baseConnector) init() error {
 		}
 		bc.db = db
 
-		if err := bc.db.Ping(); err != nil {
+		if err := bc.db.PingContext(bc.ctx); err != nil {
 			return fmt.Errorf("failed to connect to database: %v", err)
 		}
 	}
 
-	tx, err := bc.db.Begin()
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
 	if err != nil {
 		return fmt.Errorf("could not start DB transaction: %v", err)
 	}
 
 	// make sure migrator schema exists
 	createSchema := bc.dialect.GetCreateSchemaSQL(migratorSchema)
-	if _, err := bc.db.Exec(createSchema); err != nil {
+	if _, err := bc.db.ExecContext(bc.ctx, createSchema); err != nil {
 		return fmt.Errorf("could not create migrator schema: %v", err)
 	}
 
 	// make sure migrations table exists
 	createMigrationsTable := bc.dialect.GetCreateMigrationsTableSQL()
-	if _, err := bc.db.Exec(createMigrationsTable); err != nil {
+	if _, err := bc.db.ExecContext(bc.ctx, createMigrationsTable); err != nil {
 		return fmt.Errorf("could not create migrations table: %v", err)
 	}
 
+	// make sure down_contents column (added in later version of migrator) exists
+	addDownContentsColumnSQLs := bc.dialect.GetAddColumnSQL(migratorMigrationsTable, "down_contents", "text")
+	for _, addDownContentsColumnSQL := range addDownContentsColumnSQLs {
+		if _, err := bc.db.ExecContext(bc.ctx, addDownContentsColumnSQL); err != nil {
+			return fmt.Errorf("could not add down_contents column to migrations table: %v", err)
+		}
+	}
+
 	// make sure versions table exists
 	createVersionsTableSQLs := bc.dialect.GetCreateVersionsTableSQL()
 	for _, createVersionsTableSQL := range createVersionsTableSQLs {
-		if _, err := bc.db.Exec(createVersionsTableSQL); err != nil {
+		if _, err := bc.db.ExecContext(bc.ctx, createVersionsTableSQL); err != nil {
 			return fmt.Errorf("could not create versions table: %v", err)
 		}
 	}
@@ -105,9 +130,28 @@ func (bc *baseConnector) init() error {
 	// if using default migrator tenants table make sure it exists
 	if bc.config.TenantSelectSQL == "" {
 		createTenantsTable := bc.dialect.GetCreateTenantsTableSQL()
-		if _, err := bc.db.Exec(createTenantsTable); err != nil {
+		if _, err := bc.db.ExecContext(bc.ctx, createTenantsTable); err != nil {
 			return fmt.Errorf("could not create default tenants table: %v", err)
 		}
+		// make sure metadata column (added in later version of migrator) exists
+		addMetadataColumnSQLs := bc.dialect.GetAddColumnSQL(migratorTenantsTable, tenantMetadataColumn, "text")
+		for _, addMetadataColumnSQL := range addMetadataColumnSQLs {
+			if _, err := bc.db.ExecContext(bc.ctx, addMetadataColumnSQL); err != nil {
+				return fmt.Errorf("could not add metadata column to tenants table: %v", err)
+			}
+		}
+	}
+
+	// make sure locks table (which stores holder of migration lock) exists
+	createLocksTable := bc.dialect.GetCreateLocksTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createLocksTable); err != nil {
+		return fmt.Errorf("could not create locks table: %v", err)
+	}
+
+	// make sure jobs table (which stores state of asynchronous jobs) exists
+	createJobsTable := bc.dialect.GetCreateJobsTableSQL()
+	if _, err := bc.db.ExecContext(bc.ctx, createJobsTable); err != nil {
+		return fmt.Errorf("could not create jobs table: %v", err)
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -149,25 +193,64 @@ func (bc *baseConnector) getTenantSelectSQL() string {
 }
 
 // GetTenants returns a list of all DB tenants
+// the first column returned by tenant select SQL is tenant name, other columns are tenant metadata
+// metadata column (used by default tenants table) stores metadata as JSON object
 func (bc *baseConnector) GetTenants() []types.Tenant {
 	bc.initOrPanic()
 
 	tenantSelectSQL := bc.getTenantSelectSQL()
 
-	tenants := []types.Tenant{}
+	rows, err := bc.db.QueryContext(bc.ctx, tenantSelectSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not query tenants: %v", err))
+	}
 
-	rows, err := bc.db.Query(tenantSelectSQL)
+	return bc.readTenants(rows)
+}
+
+// getTenantsInTx returns a list of all DB tenants including tenants created in passed transaction (or DB session)
+func (bc *baseConnector) getTenantsInTx(exec execer) []types.Tenant {
+	rows, err := exec.QueryContext(bc.ctx, bc.getTenantSelectSQL())
 	if err != nil {
 		panic(fmt.Sprintf("Could not query tenants: %v", err))
 	}
+
+	return bc.readTenants(rows)
+}
+
+// readTenants reads tenants and their metadata and closes rows
+func (bc *baseConnector) readTenants(rows *sql.Rows) []types.Tenant {
 	defer rows.Close()
 
+	tenants := []types.Tenant{}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		panic(fmt.Sprintf("Could not read tenants: %v", err))
+	}
+
 	for rows.Next() {
 		var name string
-		if err = rows.Scan(&name); err != nil {
+		values := make([]sql.NullString, len(columns)-1)
+		dest := []interface{}{&name}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
 			panic(fmt.Sprintf("Could not read tenants: %v", err))
 		}
-		tenants = append(tenants, types.Tenant{Name: name})
+		metadata := types.TenantMetadata{}
+		for i, value := range values {
+			if !value.Valid {
+				continue
+			}
+			if column := columns[i+1]; column != tenantMetadataColumn {
+				metadata[column] = value.String
+			} else if err := json.Unmarshal([]byte(value.String), &metadata); err != nil {
+				panic(fmt.Sprintf("Could not read metadata of tenant %v: %v", name, err))
+			}
+		}
+		tenants = append(tenants, types.Tenant{Name: name, Metadata: metadata})
 	}
 
 	return tenants
@@ -178,7 +261,7 @@ func (bc *baseConnector) GetVersions() []types.Version {
 
 	versionsSelectSQL := bc.dialect.GetVersionsSelectSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query versions: %v", err))
 	}
@@ -192,7 +275,7 @@ func (bc *baseConnector) GetVersionsByFile(file string) []types.Version {
 
 	versionsSelectSQL := bc.dialect.GetVersionsByFileSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL, file)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL, file)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query versions: %v", err))
 	}
@@ -206,7 +289,7 @@ func (bc *baseConnector) GetVersionByID(ID int32) (*types.Version, error) {
 
 	versionsSelectSQL := bc.dialect.GetVersionByIDSQL()
 
-	rows, err := bc.db.Query(versionsSelectSQL, ID)
+	rows, err := bc.db.QueryContext(bc.ctx, versionsSelectSQL, ID)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query versions: %v", err))
 	}
@@ -226,7 +309,7 @@ func (bc *baseConnector) GetVersionByID(ID int32) (*types.Version, error) {
 func (bc *baseConnector) getVersionByIDInTx(tx *sql.Tx, ID int32) *types.Version {
 	versionsSelectSQL := bc.dialect.GetVersionByIDSQL()
 
-	rows, err := tx.Query(versionsSelectSQL, ID)
+	rows, err := tx.QueryContext(bc.ctx, versionsSelectSQL, ID)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query versions: %v", err))
 	}
@@ -262,9 +345,10 @@ func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
 			created       time.Time
 			contents      string
 			checksum      string
+			downContents  sql.NullString
 		)
 
-		if err := rows.Scan(&vid, &vname, &vcreated, &mid, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
+		if err := rows.Scan(&vid, &vname, &vcreated, &mid, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum, &downContents); err != nil {
 			panic(fmt.Sprintf("Could not read versions: %v", err))
 		}
 		if versionsMap[vid] == nil {
@@ -273,8 +357,11 @@ func (bc *baseConnector) readVersions(rows *sql.Rows) []types.Version {
 		}
 
 		version := versionsMap[vid]
-		migration := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
+		migration := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum, DownContents: downContents.String}
 		version.DBMigrations = append(version.DBMigrations, types.DBMigration{Migration: migration, ID: int32(mid), Schema: schema, Created: graphql.Time{Time: created}})
+		if migrationType == types.MigrationTypeTenantFailure {
+			version.Partial = true
+		}
 	}
 
 	// map to versions
@@ -293,7 +380,7 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 
 	query := bc.dialect.GetMigrationByIDSQL()
 
-	rows, err := bc.db.Query(query, ID)
+	rows, err := bc.db.QueryContext(bc.ctx, query, ID)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
 	}
@@ -313,11 +400,12 @@ func (bc *baseConnector) GetDBMigrationByID(ID int32) (*types.DBMigration, error
 		created       time.Time
 		contents      string
 		checksum      string
+		downContents  sql.NullString
 	)
-	if err = rows.Scan(&id, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum); err != nil {
+	if err = rows.Scan(&id, &name, &sourceDir, &filename, &migrationType, &schema, &created, &contents, &checksum, &downContents); err != nil {
 		panic(fmt.Sprintf("Could not read DB migration: %v", err.Error()))
 	}
-	m := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum}
+	m := types.Migration{Name: name, SourceDir: sourceDir, File: filename, MigrationType: migrationType, Contents: contents, CheckSum: checksum, DownContents: downContents.String}
 	db := types.DBMigration{Migration: m, ID: int32(id), Schema: schema, Created: graphql.Time{Time: created}}
 
 	return &db, nil
@@ -331,7 +419,7 @@ func (bc *baseConnector) GetAppliedMigrations() []types.DBMigration {
 
 	dbMigrations := []types.DBMigration{}
 
-	rows, err := bc.db.Query(query)
+	rows, err := bc.db.QueryContext(bc.ctx, query)
 	if err != nil {
 		panic(fmt.Sprintf("Could not query DB migrations: %v", err.Error()))
 	}
@@ -358,7 +446,9 @@ func (bc *baseConnector) GetAppliedMigrations() []types.DBMigration {
 }
 
 // CreateVersion creates new DB version and applies passed migrations
-func (bc *baseConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+// tenantMigrations maps tenant names to tenant migrations & scripts which should be applied to them
+// if tenantMigrations is nil all tenant migrations & scripts are applied to all tenants
+func (bc *baseConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
 	if len(migrations) == 0 {
 		return &types.Summary{
 			StartedAt: graphql.Time{Time: time.Now()},
@@ -366,11 +456,41 @@ func (bc *baseConnector) CreateVersion(versionName string, action types.Action,
 		}, nil
 	}
 
-	tenants := bc.GetTenants()
+	bc.initOrPanic()
+
+	if tenantMigrations == nil {
+		tenantMigrations = allTenantsMigrations(bc.GetTenants(), migrations)
+	}
+
+	if action == types.ActionApply && hasNonTransactionalMigrations(migrations) {
+		// non-transactional migrations cannot be rolled back per tenant, such versions are applied only with abortAll policy
+		if bc.config.GetFailurePolicy() != config.FailurePolicyAbortAll {
+			panic(fmt.Sprintf("Version %v contains non-transactional migrations which cannot be applied with failurePolicy %v", versionName, bc.config.GetFailurePolicy()))
+		}
+		if !dryRun {
+			return bc.applyMigrationsInSegments(versionName, tenantMigrations, migrations, nil)
+		}
+	}
+
+	if !dryRun && bc.config.GetFailurePolicy() != config.FailurePolicyAbortAll {
+		return bc.applyMigrationsPerTenant(versionName, action, tenantMigrations, migrations)
+	}
 
-	tx, err := bc.db.Begin()
+	var results *types.Summary
+	var version *types.Version
+	bc.retry(fmt.Sprintf("Version %v", versionName), func() {
+		defer bc.rollbackProgress(common.GetProgress(bc.ctx).Applied())
+		results, version = bc.createVersionInTx(versionName, action, migrations, tenantMigrations, dryRun)
+	})
+
+	return results, version
+}
+
+// createVersionInTx creates new DB version and applies passed migrations in a single transaction
+func (bc *baseConnector) createVersionInTx(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		bc.panicOnError(err, fmt.Sprintf("Could not start transaction: %v", err.Error()))
 	}
 
 	defer func() {
@@ -382,7 +502,7 @@ func (bc *baseConnector) CreateVersion(versionName string, action types.Action,
 			} else {
 				common.LogInfo(bc.ctx, "Running %v, committing transaction", action)
 				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+					bc.panicOnError(err, fmt.Sprintf("Could not commit transaction: %v", err.Error()))
 				}
 			}
 		} else {
@@ -392,21 +512,37 @@ func (bc *baseConnector) CreateVersion(versionName string, action types.Action,
 		}
 	}()
 
-	results := bc.applyMigrationsInTx(tx, versionName, action, tenants, migrations)
+	results := bc.applyMigrationsInTx(tx, versionName, action, tenantMigrations, migrations)
 	version := bc.getVersionByIDInTx(tx, results.VersionID)
 
 	return results, version
 }
 
 // CreateTenant creates new tenant and applies passed tenant migrations
-func (bc *baseConnector) CreateTenant(tenant string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+func (bc *baseConnector) CreateTenant(tenant types.Tenant, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
 	bc.initOrPanic()
 
-	tenantInsertSQL := bc.getTenantInsertSQL()
+	if action == types.ActionApply && !dryRun && hasNonTransactionalMigrations(migrations) {
+		return bc.applyMigrationsInSegments(versionName, map[string][]types.Migration{tenant.Name: migrations}, migrations, func(tx *sql.Tx) {
+			bc.createTenantInTx(tx, tenant)
+		})
+	}
+
+	var results *types.Summary
+	var version *types.Version
+	bc.retry(fmt.Sprintf("Tenant %v", tenant.Name), func() {
+		defer bc.rollbackProgress(common.GetProgress(bc.ctx).Applied())
+		results, version = bc.createTenantVersionInTx(tenant, versionName, action, migrations, dryRun)
+	})
 
-	tx, err := bc.db.Begin()
+	return results, version
+}
+
+// createTenantVersionInTx creates new tenant and applies passed tenant migrations in a single transaction
+func (bc *baseConnector) createTenantVersionInTx(tenant types.Tenant, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
 	if err != nil {
-		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+		bc.panicOnError(err, fmt.Sprintf("Could not start transaction: %v", err.Error()))
 	}
 
 	defer func() {
@@ -418,7 +554,7 @@ func (bc *baseConnector) CreateTenant(tenant string, versionName string, action
 			} else {
 				common.LogInfo(bc.ctx, "Running %v action, committing transaction", action)
 				if err := tx.Commit(); err != nil {
-					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+					bc.panicOnError(err, fmt.Sprintf("Could not commit transaction: %v", err.Error()))
 				}
 			}
 		} else {
@@ -428,29 +564,156 @@ func (bc *baseConnector) CreateTenant(tenant string, versionName string, action
 		}
 	}()
 
-	createSchema := bc.dialect.GetCreateSchemaSQL(tenant)
-	if _, err = tx.Exec(createSchema); err != nil {
-		panic(fmt.Sprintf("Create schema failed: %v", err))
+	bc.createTenantInTx(tx, tenant)
+
+	results := bc.applyMigrationsInTx(tx, versionName, action, map[string][]types.Migration{tenant.Name: migrations}, migrations)
+
+	version := bc.getVersionByIDInTx(tx, results.VersionID)
+
+	return results, version
+}
+
+// createTenantInTx creates tenant schema and adds tenant entry
+func (bc *baseConnector) createTenantInTx(tx *sql.Tx, tenant types.Tenant) {
+	tenantInsertSQL := bc.getTenantInsertSQL()
+
+	createSchema := bc.dialect.GetCreateSchemaSQL(tenant.Name)
+	if _, err := tx.ExecContext(bc.ctx, createSchema); err != nil {
+		bc.panicOnError(err, fmt.Sprintf("Create schema failed: %v", err))
 	}
 
-	insert, err := bc.db.Prepare(tenantInsertSQL)
+	insert, err := bc.db.PrepareContext(bc.ctx, tenantInsertSQL)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement: %v", err))
+		bc.panicOnError(err, fmt.Sprintf("Could not create prepared statement: %v", err))
 	}
 
-	_, err = tx.Stmt(insert).Exec(tenant)
+	_, err = tx.StmtContext(bc.ctx, insert).ExecContext(bc.ctx, bc.tenantInsertArgs(tenant)...)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to add tenant entry: %v", err))
+		bc.panicOnError(err, fmt.Sprintf("Failed to add tenant entry: %v", err))
 	}
+}
 
-	tenantStruct := types.Tenant{Name: tenant}
-	results := bc.applyMigrationsInTx(tx, versionName, action, []types.Tenant{tenantStruct}, migrations)
+// tenantInsertArgs returns arguments of tenant insert SQL statement, default tenant insert SQL takes tenant name
+// and metadata stored as JSON object, custom tenant insert SQL takes tenant name and metadata only when it is passed
+func (bc *baseConnector) tenantInsertArgs(tenant types.Tenant) []interface{} {
+	var metadata sql.NullString
+	if len(tenant.Metadata) > 0 {
+		bytes, err := json.Marshal(tenant.Metadata)
+		if err != nil {
+			panic(fmt.Sprintf("Could not marshal metadata of tenant %v: %v", tenant.Name, err))
+		}
+		metadata = sql.NullString{String: string(bytes), Valid: true}
+	}
+	if bc.config.GetTenantInsert() != "" && !metadata.Valid {
+		return []interface{}{tenant.Name}
+	}
+	return []interface{}{tenant.Name, metadata}
+}
+
+// DeleteTenant removes tenant entry and depending on the mode leaves tenant schema untouched, renames it, or drops it
+// deletion is recorded in a new DB version as a tenant deletion entry which stores executed SQL statements
+func (bc *baseConnector) DeleteTenant(tenant string, versionName string, mode types.DeleteTenantMode, dryRun bool) (*types.Summary, *types.Version) {
+	bc.initOrPanic()
+
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
+	if err != nil {
+		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			if dryRun {
+				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
+				tx.Rollback()
+			} else {
+				common.LogInfo(bc.ctx, "Deleting tenant in %v mode, committing transaction", mode)
+				if err := tx.Commit(); err != nil {
+					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+				}
+			}
+		} else {
+			common.LogInfo(bc.ctx, "Recovered in DeleteTenant. Transaction rollback.")
+			tx.Rollback()
+			panic(r)
+		}
+	}()
 
+	results := bc.deleteTenantInTx(tx, tenant, versionName, mode, dryRun)
 	version := bc.getVersionByIDInTx(tx, results.VersionID)
 
 	return results, version
 }
 
+func (bc *baseConnector) deleteTenantInTx(tx *sql.Tx, tenant string, versionName string, mode types.DeleteTenantMode, dryRun bool) *types.Summary {
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+	}()
+
+	var statements []string
+	switch mode {
+	case types.DeleteTenantModeArchive:
+		archivedSchema := fmt.Sprintf("%v_archived_%v", tenant, results.StartedAt.Time.UTC().Format("20060102150405"))
+		statements = bc.dialect.GetRenameSchemaSQL(tenant, archivedSchema)
+	case types.DeleteTenantModeDrop:
+		statements = bc.dialect.GetDropSchemaSQL(tenant)
+	}
+
+	// schema DDL cannot be rolled back in all databases (MySQL commits DDL implicitly),
+	// in dry-run mode statements are only reported in tenant deletion entry
+	for _, statement := range statements {
+		if dryRun {
+			common.LogInfo(bc.ctx, "Running in dry-run mode, skipping: %v", statement)
+			continue
+		}
+		if _, err := tx.ExecContext(bc.ctx, statement); err != nil {
+			panic(fmt.Sprintf("%v tenant schema failed: %v", mode, err))
+		}
+	}
+
+	tenantDeleteSQL := bc.getTenantDeleteSQL()
+	tenantDelete, err := bc.db.PrepareContext(bc.ctx, tenantDeleteSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement: %v", err))
+	}
+
+	if _, err = tx.StmtContext(bc.ctx, tenantDelete).ExecContext(bc.ctx, tenant); err != nil {
+		panic(fmt.Sprintf("Failed to remove tenant entry: %v", err))
+	}
+	statements = append(statements, tenantDeleteSQL)
+
+	versionID := bc.insertVersionInTx(tx, versionName)
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+
+	// tenant deletion entry stores executed SQL statements as its contents
+	if _, err = tx.StmtContext(bc.ctx, insert).ExecContext(bc.ctx, mode.String(), "", "", types.MigrationTypeTenantDeletion, tenant, strings.Join(statements, "\n"), "", "", versionID); err != nil {
+		panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
+	}
+
+	results.TenantsDeleted = 1
+	results.VersionID = int32(versionID)
+
+	return results
+}
+
+// getTenantDeleteSQL returns tenant delete SQL statement from configuration file
+// or, if absent, returns default Dialect-specific migrator tenant delete SQL
+func (bc *baseConnector) getTenantDeleteSQL() string {
+	if bc.config.TenantDelete != "" {
+		return bc.config.TenantDelete
+	}
+	return bc.dialect.GetTenantDeleteSQL()
+}
+
 // getTenantInsertSQL returns tenant insert SQL statement from configuration file
 // or, if absent, returns default Dialect-specific migrator tenant insert SQL
 func (bc *baseConnector) getTenantInsertSQL() string {
@@ -482,81 +745,743 @@ func (bc *baseConnector) getSchemaPlaceHolder() string {
 	return schemaPlaceHolder
 }
 
-func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, action types.Action, tenants []types.Tenant, migrations []types.Migration) *types.Summary {
+func (bc *baseConnector) applyMigrationsInTx(tx *sql.Tx, versionName string, action types.Action, tenantMigrations map[string][]types.Migration, migrations []types.Migration) *types.Summary {
+
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   int32(len(tenantMigrations)),
+	}
+
+	defer computeTotals(results)
+
+	versionID := bc.insertVersionInTx(tx, versionName)
+
+	insert := bc.prepareMigrationInsert()
+	insertInTx := func() *sql.Stmt { return tx.StmtContext(bc.ctx, insert) }
 
+	migrations, callbacks := splitCallbacks(migrations)
+	tenants, pendingInTenants := pendingTenantMigrations(tenantMigrations)
+	migrated := migratedTenants(tenants, pendingInTenants, migrations)
+
+	bc.applyCallbacks(tx, insertInTx, versionID, action, callbacks, types.CallbackBeforeVersion, nil)
+	bc.applyCallbacks(tx, insertInTx, versionID, action, callbacks, types.CallbackBeforeEachTenant, migrated)
+
+	for _, m := range migrations {
+		// non-transactional migrations are applied in a single transaction only in dry-run mode (or when synced)
+		// they cannot be run inside a transaction and are not executed
+		executedAction := action
+		if m.NoTransaction && action == types.ActionApply {
+			common.LogInfo(bc.ctx, "Non-transactional migration %v is not executed in dry-run mode", m.File)
+			executedAction = types.ActionSync
+			results.NonTransactionalMigrations = append(results.NonTransactionalMigrations, m.File)
+		}
+		schemas := migrationSchemas(m, tenants, pendingInTenants)
+		bc.applyMigration(tx, insertInTx, versionID, executedAction, m, schemas)
+		countMigration(results, m, schemas)
+	}
+
+	bc.applyCallbacks(tx, insertInTx, versionID, action, callbacks, types.CallbackAfterEachTenant, migrated)
+	bc.applyCallbacks(tx, insertInTx, versionID, action, callbacks, types.CallbackAfterCreateTenant, tenants)
+	bc.applyCallbacks(tx, insertInTx, versionID, action, callbacks, types.CallbackAfterVersion, nil)
+
+	results.VersionID = int32(versionID)
+	results.TenantsSucceeded = results.Tenants
+
+	return results
+}
+
+// applyMigrationsInSegments applies migrations when some of them must run outside of version transaction
+// migrations are split into segments: consecutive transactional migrations are applied and committed in their own transaction
+// while non-transactional migrations are run directly on DB, if a migration fails segments applied before it stay committed
+// initTx (optional) is called in the transaction which creates the version
+func (bc *baseConnector) applyMigrationsInSegments(versionName string, tenantMigrations map[string][]types.Migration, migrations []types.Migration, initTx func(tx *sql.Tx)) (*types.Summary, *types.Version) {
 	results := &types.Summary{
 		StartedAt: graphql.Time{Time: time.Now()},
-		Tenants:   int32(len(tenants)),
+		Tenants:   int32(len(tenantMigrations)),
 	}
 
+	defer computeTotals(results)
+
+	migrations, callbacks := splitCallbacks(migrations)
+	tenants, pendingInTenants := pendingTenantMigrations(tenantMigrations)
+	migrated := migratedTenants(tenants, pendingInTenants, migrations)
+
+	var versionID int64
+	bc.retry(fmt.Sprintf("Version %v", versionName), func() {
+		bc.runInTx(func(tx *sql.Tx) {
+			if initTx != nil {
+				initTx(tx)
+			}
+			versionID = bc.insertVersionInTx(tx, versionName)
+			if len(callbacks) > 0 {
+				insert := bc.prepareMigrationInsertInTx(tx)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, types.ActionApply, callbacks, types.CallbackBeforeVersion, nil)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, types.ActionApply, callbacks, types.CallbackBeforeEachTenant, migrated)
+			}
+		})
+	})
+
+	insert := bc.prepareMigrationInsert()
+
+	for _, segment := range splitIntoSegments(migrations) {
+		if segment[0].NoTransaction {
+			m := segment[0]
+			common.LogInfo(bc.ctx, "Applying non-transactional migration %v", m.File)
+			schemas := migrationSchemas(m, tenants, pendingInTenants)
+			bc.applyMigrationInConn(versionID, m, schemas)
+			countMigration(results, m, schemas)
+			results.NonTransactionalMigrations = append(results.NonTransactionalMigrations, m.File)
+			continue
+		}
+		bc.retry(fmt.Sprintf("Segment starting with migration %v", segment[0].File), func() {
+			defer bc.rollbackProgress(common.GetProgress(bc.ctx).Applied())
+			bc.runInTx(func(tx *sql.Tx) {
+				for _, m := range segment {
+					schemas := migrationSchemas(m, tenants, pendingInTenants)
+					bc.applyMigration(tx, func() *sql.Stmt { return tx.StmtContext(bc.ctx, insert) }, versionID, types.ActionApply, m, schemas)
+				}
+			})
+		})
+		// segment is counted once its transaction is committed
+		for _, m := range segment {
+			countMigration(results, m, migrationSchemas(m, tenants, pendingInTenants))
+		}
+	}
+
+	if len(callbacks) > 0 {
+		bc.retry(fmt.Sprintf("Callbacks of version %v", versionName), func() {
+			bc.runInTx(func(tx *sql.Tx) {
+				insert := bc.prepareMigrationInsertInTx(tx)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, types.ActionApply, callbacks, types.CallbackAfterEachTenant, migrated)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, types.ActionApply, callbacks, types.CallbackAfterCreateTenant, tenants)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, types.ActionApply, callbacks, types.CallbackAfterVersion, nil)
+			})
+		})
+	}
+
+	results.VersionID = int32(versionID)
+	results.TenantsSucceeded = results.Tenants
+
+	version, err := bc.GetVersionByID(results.VersionID)
+	if err != nil {
+		panic(fmt.Sprintf("Could not read version: %v", err.Error()))
+	}
+
+	return results, version
+}
+
+// applyMigrationsPerTenant applies single migrations & scripts serially in the transaction which creates the version
+// then tenant migrations & scripts are applied by a pool of tenantConcurrency workers, every tenant in its own transaction
+// failure of a tenant does not affect other tenants, it is recorded in migrator_migrations table and reported in the summary
+// with stopAfterN failure policy remaining tenants are skipped (and recorded as failed) once the failures limit is reached
+func (bc *baseConnector) applyMigrationsPerTenant(versionName string, action types.Action, tenantMigrations map[string][]types.Migration, migrations []types.Migration) (*types.Summary, *types.Version) {
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   int32(len(tenantMigrations)),
+	}
+
+	defer computeTotals(results)
+
+	migrations, callbacks := splitCallbacks(migrations)
+	tenants, pendingInTenants := pendingTenantMigrations(tenantMigrations)
+
+	var singleMigrations, tenantMigrationsToApply []types.Migration
+	for _, m := range migrations {
+		if isTenantMigration(m) {
+			tenantMigrationsToApply = append(tenantMigrationsToApply, m)
+			// totals are added only for tenants which succeeded
+			countMigration(results, m, nil)
+		} else {
+			singleMigrations = append(singleMigrations, m)
+		}
+	}
+
+	var versionID int64
+	bc.retry(fmt.Sprintf("Version %v", versionName), func() {
+		defer bc.rollbackProgress(common.GetProgress(bc.ctx).Applied())
+		bc.runInTx(func(tx *sql.Tx) {
+			versionID = bc.insertVersionInTx(tx, versionName)
+			insert := bc.prepareMigrationInsertInTx(tx)
+			bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, action, callbacks, types.CallbackBeforeVersion, nil)
+			for _, m := range singleMigrations {
+				schemas := migrationSchemas(m, tenants, pendingInTenants)
+				bc.applyMigration(tx, func() *sql.Stmt { return insert }, versionID, action, m, schemas)
+			}
+		})
+	})
+	for _, m := range singleMigrations {
+		countMigration(results, m, migrationSchemas(m, tenants, pendingInTenants))
+	}
+
+	stopAfterFailures := int32(0)
+	if bc.config.GetFailurePolicy() == config.FailurePolicyStopAfterN {
+		stopAfterFailures = int32(bc.config.GetMaxTenantFailures())
+	}
+	concurrency := bc.config.TenantConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tenant := range jobs {
+				mutex.Lock()
+				skip := stopAfterFailures > 0 && results.TenantsFailed >= stopAfterFailures
+				mutex.Unlock()
+
+				var migrationsTotal, scriptsTotal int32
+				var err error
+				if skip {
+					err = fmt.Errorf("tenant skipped, %v tenants already failed", stopAfterFailures)
+				} else {
+					migrationsTotal, scriptsTotal, err = bc.applyTenantMigrations(tenant, versionID, action, tenantMigrationsToApply, callbacks, pendingInTenants[tenant])
+				}
+				if err != nil {
+					common.LogError(bc.ctx, "Migrations of tenant %v failed: %v", tenant, err.Error())
+					bc.recordTenantFailure(tenant, versionID, tenantMigrationsToApply, pendingInTenants[tenant], err.Error())
+				}
+
+				mutex.Lock()
+				if err != nil {
+					results.TenantsFailed++
+					results.TenantFailures = append(results.TenantFailures, types.TenantFailure{Tenant: tenant, Error: err.Error()})
+				} else {
+					results.TenantsSucceeded++
+					results.TenantMigrationsTotal += migrationsTotal
+					results.TenantScriptsTotal += scriptsTotal
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, tenant := range tenants {
+		jobs <- tenant
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results.TenantFailures, func(i, j int) bool {
+		return results.TenantFailures[i].Tenant < results.TenantFailures[j].Tenant
+	})
+
+	if len(callbacks) > 0 {
+		bc.retry(fmt.Sprintf("Callbacks of version %v", versionName), func() {
+			bc.runInTx(func(tx *sql.Tx) {
+				insert := bc.prepareMigrationInsertInTx(tx)
+				bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, action, callbacks, types.CallbackAfterVersion, nil)
+			})
+		})
+	}
+
+	results.VersionID = int32(versionID)
+
+	version, err := bc.GetVersionByID(results.VersionID)
+	if err != nil {
+		panic(fmt.Sprintf("Could not read version: %v", err.Error()))
+	}
+
+	return results, version
+}
+
+// recordTenantFailure adds TenantFailure entries for all pending tenant migrations & scripts of a failed tenant
+// the entries are used to resume the version later, errors are only logged as the version was already created
+func (bc *baseConnector) recordTenantFailure(tenant string, versionID int64, migrations []types.Migration, pending map[string]bool, failure string) {
 	defer func() {
-		results.Duration = time.Since(results.StartedAt.Time).Seconds()
-		results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
-		results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+		if r := recover(); r != nil {
+			common.LogError(bc.ctx, "Could not record failure of tenant %v: %v", tenant, r)
+		}
+	}()
+
+	// failure must be recorded even when the request was cancelled
+	ctx := context.WithoutCancel(bc.ctx)
+	bc.runInTxContext(ctx, func(tx *sql.Tx) {
+		insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+		for _, m := range migrations {
+			if !pending[m.File] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, insertMigrationSQL, m.Name, m.SourceDir, m.File, types.MigrationTypeTenantFailure, tenant, failure, "", "", versionID); err != nil {
+				panic(fmt.Sprintf("Failed to add tenant failure entry: %v", err.Error()))
+			}
+		}
+	})
+}
+
+// applyTenantMigrations applies pending tenant migrations & scripts to a tenant in a new transaction
+// surrounded by beforeEachTenant and afterEachTenant callbacks, returns number of applied migrations and scripts, panics are returned as errors
+func (bc *baseConnector) applyTenantMigrations(tenant string, versionID int64, action types.Action, migrations []types.Migration, callbacks []types.Migration, pending map[string]bool) (migrationsTotal int32, scriptsTotal int32, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			migrationsTotal, scriptsTotal, err = 0, 0, fmt.Errorf("%v", r)
+		}
 	}()
 
+	bc.retry(fmt.Sprintf("Migrations of tenant %v", tenant), func() {
+		migrationsTotal, scriptsTotal = 0, 0
+		defer func() {
+			if r := recover(); r != nil {
+				// tenants are migrated concurrently, only migrations applied in this tenant's rolled back transaction are subtracted
+				common.GetProgress(bc.ctx).AddApplied(-(migrationsTotal + scriptsTotal))
+				panic(r)
+			}
+		}()
+		bc.runInTx(func(tx *sql.Tx) {
+			insert := bc.prepareMigrationInsertInTx(tx)
+			tenants := migratedTenants([]string{tenant}, map[string]map[string]bool{tenant: pending}, migrations)
+			bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, action, callbacks, types.CallbackBeforeEachTenant, tenants)
+			for _, m := range migrations {
+				if !pending[m.File] {
+					continue
+				}
+				bc.applyMigration(tx, func() *sql.Stmt { return insert }, versionID, action, m, []string{tenant})
+				if m.MigrationType == types.MigrationTypeTenantMigration {
+					migrationsTotal++
+				} else {
+					scriptsTotal++
+				}
+			}
+			bc.applyCallbacks(tx, func() *sql.Stmt { return insert }, versionID, action, callbacks, types.CallbackAfterEachTenant, tenants)
+		})
+	})
+
+	return migrationsTotal, scriptsTotal, nil
+}
+
+// runInTx runs f in a new transaction which is committed when f returns and rolled back when f panics
+func (bc *baseConnector) runInTx(f func(tx *sql.Tx)) {
+	bc.runInTxContext(bc.ctx, f)
+}
+
+// runInTxContext runs f in a new transaction bound to passed context, see runInTx
+func (bc *baseConnector) runInTxContext(ctx context.Context, f func(tx *sql.Tx)) {
+	tx, err := bc.db.BeginTx(ctx, nil)
+	if err != nil {
+		bc.panicOnError(err, fmt.Sprintf("Could not start transaction: %v", err.Error()))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			common.LogInfo(bc.ctx, "Recovered in runInTx. Transaction rollback.")
+			tx.Rollback()
+			panic(r)
+		}
+		if err := tx.Commit(); err != nil {
+			bc.panicOnError(err, fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+		}
+	}()
+
+	f(tx)
+}
+
+// execer is implemented by both *sql.Tx and *sql.Conn
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// applyMigrationInConn applies non-transactional migration on a dedicated DB session,
+// statement timeouts are set per session and must not leak to other connections in the pool
+func (bc *baseConnector) applyMigrationInConn(versionID int64, m types.Migration, schemas []string) {
+	conn, err := bc.db.Conn(bc.ctx)
+	if err != nil {
+		panic(fmt.Sprintf("Could not obtain DB connection: %v", err.Error()))
+	}
+	defer conn.Close()
+
+	insert, err := conn.PrepareContext(bc.ctx, bc.dialect.GetMigrationInsertSQL())
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+	defer insert.Close()
+
+	bc.applyMigration(conn, func() *sql.Stmt { return insert }, versionID, types.ActionApply, m, schemas)
+}
+
+// applyMigration executes migration in passed schemas and records it in migrator_migrations table
+// exec and insert are bound either to a transaction or to DB
+func (bc *baseConnector) applyMigration(exec execer, insert func() *sql.Stmt, versionID int64, action types.Action, m types.Migration, schemas []string) {
 	schemaPlaceHolder := bc.getSchemaPlaceHolder()
 
+	var metadata map[string]types.TenantMetadata
+	if action == types.ActionApply && usesTenantMetadata(bc.config, m, m.Contents) {
+		metadata = tenantsMetadata(bc.getTenantsInTx(exec))
+	}
+
+	for _, s := range schemas {
+		common.LogDebug(bc.ctx, "Applying migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
+
+		if action == types.ActionApply {
+			contents := strings.Replace(renderMigration(bc.config, m, m.Contents, s, metadata[s]), schemaPlaceHolder, s, -1)
+			if statement, line, err := bc.execStatements(exec, contents, migrationTimeout(m, bc.config)); err != nil {
+				bc.panicOnError(err, fmt.Sprintf("SQL migration %v failed at statement %d (line %d) with error: %v", m.File, statement, line, err.Error()))
+			}
+		}
+
+		if _, err := insert().ExecContext(bc.ctx, m.Name, m.SourceDir, m.File, m.MigrationType, s, m.Contents, m.CheckSum, m.DownContents, versionID); err != nil {
+			bc.panicOnError(err, fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
+		}
+		// callbacks are not counted in the progress of migrations
+		if m.MigrationType != types.MigrationTypeCallback {
+			common.GetProgress(bc.ctx).AddApplied(1)
+		}
+	}
+}
+
+// migrationTimeout returns statement timeout of migration, falls back to global statementTimeout
+func migrationTimeout(m types.Migration, config *config.Config) time.Duration {
+	if m.Timeout > 0 {
+		return m.Timeout
+	}
+	return config.GetStatementTimeout()
+}
+
+// execStatements executes statements of migration contents, when timeout is set it is applied to the DB session
+// (if supported by dialect) and every statement is cancelled once it runs longer than the timeout,
+// on error returns number and line of the failed statement
+func (bc *baseConnector) execStatements(exec execer, contents string, timeout time.Duration) (statement int, line int, err error) {
+	if timeout > 0 {
+		for _, timeoutSQL := range bc.dialect.GetStatementTimeoutSQL(timeout) {
+			if _, err := exec.ExecContext(bc.ctx, timeoutSQL); err != nil {
+				return 0, 0, fmt.Errorf("could not set statement timeout: %v", err)
+			}
+		}
+		defer func() {
+			for _, resetSQL := range bc.dialect.GetResetStatementTimeoutSQL() {
+				// reset fails in a transaction aborted by failed migration, the transaction is rolled back anyway
+				if _, resetErr := exec.ExecContext(context.WithoutCancel(bc.ctx), resetSQL); resetErr != nil && err == nil {
+					common.LogError(bc.ctx, "Could not reset statement timeout: %v", resetErr)
+				}
+			}
+		}()
+	}
+
+	for i, st := range bc.dialect.SplitStatements(contents) {
+		if err := bc.execStatement(exec, st.sql, timeout); err != nil {
+			return i + 1, st.line, err
+		}
+	}
+
+	return 0, 0, nil
+}
+
+// execStatement executes single statement, statement running longer than timeout (if set) is cancelled
+func (bc *baseConnector) execStatement(exec execer, statement string, timeout time.Duration) error {
+	if timeout == 0 {
+		_, err := exec.ExecContext(bc.ctx, statement)
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(bc.ctx, timeout)
+	defer cancel()
+	_, err := exec.ExecContext(ctx, statement)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("statement timeout of %v exceeded: %v", timeout, err)
+	}
+	return err
+}
+
+func (bc *baseConnector) prepareMigrationInsert() *sql.Stmt {
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+	return insert
+}
+
+// prepareMigrationInsertInTx prepares migration insert statement in a transaction, used when transactions run in parallel
+// on many connections and statement prepared on DB would have to be re-prepared on every connection anyway
+func (bc *baseConnector) prepareMigrationInsertInTx(tx *sql.Tx) *sql.Stmt {
+	insert, err := tx.PrepareContext(bc.ctx, bc.dialect.GetMigrationInsertSQL())
+	if err != nil {
+		bc.panicOnError(err, fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+	return insert
+}
+
+// migrationSchemas returns schemas in which migration should be applied
+func migrationSchemas(m types.Migration, tenants []string, pendingInTenants map[string]map[string]bool) []string {
+	if !isTenantMigration(m) {
+		return []string{filepath.Base(m.SourceDir)}
+	}
+	var schemas []string
+	for _, t := range tenants {
+		if pendingInTenants[t][m.File] {
+			schemas = append(schemas, t)
+		}
+	}
+	return schemas
+}
+
+// countMigration adds migration applied in passed schemas to summary, repeatables are counted as scripts
+func countMigration(results *types.Summary, m types.Migration, schemas []string) {
+	if m.MigrationType == types.MigrationTypeSingleMigration {
+		results.SingleMigrations++
+	}
+	if m.MigrationType == types.MigrationTypeSingleScript || m.MigrationType == types.MigrationTypeSingleRepeatable {
+		results.SingleScripts++
+	}
+	if m.MigrationType == types.MigrationTypeTenantMigration {
+		results.TenantMigrations++
+		results.TenantMigrationsTotal += int32(len(schemas))
+	}
+	if m.MigrationType == types.MigrationTypeTenantScript || m.MigrationType == types.MigrationTypeTenantRepeatable {
+		results.TenantScripts++
+		results.TenantScriptsTotal += int32(len(schemas))
+	}
+}
+
+// computeTotals sets duration and grand totals of summary
+func computeTotals(results *types.Summary) {
+	results.Duration = time.Since(results.StartedAt.Time).Seconds()
+	results.MigrationsGrandTotal = results.TenantMigrationsTotal + results.SingleMigrations
+	results.ScriptsGrandTotal = results.TenantScriptsTotal + results.SingleScripts
+}
+
+// hasNonTransactionalMigrations returns true if any of migrations must run outside of version transaction
+func hasNonTransactionalMigrations(migrations []types.Migration) bool {
+	for _, m := range migrations {
+		if m.NoTransaction {
+			return true
+		}
+	}
+	return false
+}
+
+// splitIntoSegments splits migrations into segments of consecutive transactional migrations
+// every non-transactional migration forms its own segment
+func splitIntoSegments(migrations []types.Migration) [][]types.Migration {
+	var segments [][]types.Migration
+	var segment []types.Migration
+	for _, m := range migrations {
+		if !m.NoTransaction {
+			segment = append(segment, m)
+			continue
+		}
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+			segment = nil
+		}
+		segments = append(segments, []types.Migration{m})
+	}
+	if len(segment) > 0 {
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// allTenantsMigrations returns tenant migrations & scripts which should be applied to every tenant, tenant selectors are respected
+func allTenantsMigrations(tenants []types.Tenant, migrations []types.Migration) map[string][]types.Migration {
+	tenantMigrations := map[string][]types.Migration{}
+	for _, t := range tenants {
+		tenantMigrations[t.Name] = []types.Migration{}
+		for _, m := range migrations {
+			if m.MatchesTenant(t) {
+				tenantMigrations[t.Name] = append(tenantMigrations[t.Name], m)
+			}
+		}
+	}
+	return tenantMigrations
+}
+
+// pendingTenantMigrations returns sorted tenant names and for every tenant a set of files which should be applied to it
+func pendingTenantMigrations(tenantMigrations map[string][]types.Migration) ([]string, map[string]map[string]bool) {
+	tenants := make([]string, 0, len(tenantMigrations))
+	pending := map[string]map[string]bool{}
+	for t, ms := range tenantMigrations {
+		tenants = append(tenants, t)
+		pending[t] = map[string]bool{}
+		for _, m := range ms {
+			pending[t][m.File] = true
+		}
+	}
+	sort.Strings(tenants)
+	return tenants, pending
+}
+
+// insertVersionInTx creates new version and returns its ID
+func (bc *baseConnector) insertVersionInTx(tx *sql.Tx, versionName string) int64 {
 	var versionID int64
 	versionInsertSQL := bc.dialect.GetVersionInsertSQL()
-	versionInsert, err := bc.db.Prepare(versionInsertSQL)
+	versionInsert, err := bc.db.PrepareContext(bc.ctx, versionInsertSQL)
 	if err != nil {
 		panic(fmt.Sprintf("Could not create prepared statement for version: %v", err))
 	}
-	stmt := tx.Stmt(versionInsert)
+	stmt := tx.StmtContext(bc.ctx, versionInsert)
 	if bc.dialect.LastInsertIDSupported() {
-		result, _ := stmt.Exec(versionName)
+		result, _ := stmt.ExecContext(bc.ctx, versionName)
 		versionID, _ = result.LastInsertId()
 	} else {
-		stmt.QueryRow(versionName).Scan(&versionID)
+		stmt.QueryRowContext(bc.ctx, versionName).Scan(&versionID)
 	}
+	return versionID
+}
 
-	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
-	insert, err := bc.db.Prepare(insertMigrationSQL)
+// RollbackVersion creates new DB version and applies down migrations of passed DB migrations
+// DB migrations are rolled back in the order they are passed
+func (bc *baseConnector) RollbackVersion(versionName string, migrations []types.DBMigration, dryRun bool) (*types.Summary, *types.Version) {
+	bc.initOrPanic()
+
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
 	}
 
-	for _, m := range migrations {
-		var schemas []string
-		if m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript {
-			for _, t := range tenants {
-				schemas = append(schemas, t.Name)
+	defer func() {
+		r := recover()
+		if r == nil {
+			if dryRun {
+				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
+				tx.Rollback()
+			} else {
+				common.LogInfo(bc.ctx, "Rolling back version, committing transaction")
+				if err := tx.Commit(); err != nil {
+					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+				}
 			}
 		} else {
-			schemas = []string{filepath.Base(m.SourceDir)}
+			common.LogInfo(bc.ctx, "Recovered in RollbackVersion. Transaction rollback.")
+			tx.Rollback()
+			panic(r)
 		}
+	}()
 
-		for _, s := range schemas {
-			common.LogDebug(bc.ctx, "Applying migration type: %d, schema: %s, file: %s ", m.MigrationType, s, m.File)
+	results := bc.rollbackMigrationsInTx(tx, versionName, migrations, dryRun)
+	version := bc.getVersionByIDInTx(tx, results.VersionID)
 
-			if action == types.ActionApply {
-				contents := strings.Replace(m.Contents, schemaPlaceHolder, s, -1)
-				if _, err = tx.Exec(contents); err != nil {
-					panic(fmt.Sprintf("SQL migration %v failed with error: %v", m.File, err.Error()))
-				}
-			}
+	return results, version
+}
 
-			if _, err = tx.Stmt(insert).Exec(m.Name, m.SourceDir, m.File, m.MigrationType, s, m.Contents, m.CheckSum, versionID); err != nil {
-				panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
-			}
-		}
+// rollbackMigrationsInTx applies down migrations in passed transaction, in dry-run mode down migrations are executed only
+// when DDL statements can be rolled back, otherwise they are only recorded as rollback entries
+func (bc *baseConnector) rollbackMigrationsInTx(tx *sql.Tx, versionName string, migrations []types.DBMigration, dryRun bool) *types.Summary {
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+	}()
+
+	schemaPlaceHolder := bc.getSchemaPlaceHolder()
 
-		if m.MigrationType == types.MigrationTypeSingleMigration {
-			results.SingleMigrations++
+	versionID := bc.insertVersionInTx(tx, versionName)
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+
+	tenants := map[string]bool{}
+	for _, m := range migrations {
+		common.LogDebug(bc.ctx, "Rolling back migration type: %d, schema: %s, file: %s ", m.MigrationType, m.Schema, m.File)
+
+		var metadata types.TenantMetadata
+		if usesTenantMetadata(bc.config, m.Migration, m.DownContents) {
+			metadata = tenantsMetadata(bc.getTenantsInTx(tx))[m.Schema]
+		}
+		contents := strings.Replace(renderMigration(bc.config, m.Migration, m.DownContents, m.Schema, metadata), schemaPlaceHolder, m.Schema, -1)
+		if dryRun && !bc.dialect.TransactionalDDLSupported() {
+			common.LogInfo(bc.ctx, "Running in dry-run mode, down migration %v is not executed as DDL cannot be rolled back", m.File)
+		} else if statement, line, err := bc.execStatements(tx, contents, bc.config.GetStatementTimeout()); err != nil {
+			panic(fmt.Sprintf("SQL down migration %v failed at statement %d (line %d) with error: %v", m.File, statement, line, err.Error()))
 		}
-		if m.MigrationType == types.MigrationTypeSingleScript {
-			results.SingleScripts++
+
+		// rollback entry stores executed down migration as its contents
+		if _, err = tx.StmtContext(bc.ctx, insert).ExecContext(bc.ctx, m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, m.Schema, m.DownContents, m.CheckSum, "", versionID); err != nil {
+			panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
 		}
+
 		if m.MigrationType == types.MigrationTypeTenantMigration {
-			results.TenantMigrations++
-			results.TenantMigrationsTotal += int32(len(schemas))
+			tenants[m.Schema] = true
 		}
-		if m.MigrationType == types.MigrationTypeTenantScript {
-			results.TenantScripts++
-			results.TenantScriptsTotal += int32(len(schemas))
+		results.MigrationsRolledBack++
+	}
+
+	results.Tenants = int32(len(tenants))
+	results.VersionID = int32(versionID)
+
+	return results
+}
+
+// RepairMigrations creates new DB version and updates contents and checksum of applied migrations to match their source migrations
+// every repaired migration is recorded in the new version as a repair entry which stores the replaced contents and checksum
+func (bc *baseConnector) RepairMigrations(versionName string, mismatches []types.CheckSumMismatch, dryRun bool) (*types.Summary, *types.Version) {
+	bc.initOrPanic()
+
+	tx, err := bc.db.BeginTx(bc.ctx, nil)
+	if err != nil {
+		panic(fmt.Sprintf("Could not start transaction: %v", err.Error()))
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			if dryRun {
+				common.LogInfo(bc.ctx, "Running in dry-run mode, calling rollback")
+				tx.Rollback()
+			} else {
+				common.LogInfo(bc.ctx, "Repairing migrations, committing transaction")
+				if err := tx.Commit(); err != nil {
+					panic(fmt.Sprintf("Could not commit transaction: %v", err.Error()))
+				}
+			}
+		} else {
+			common.LogInfo(bc.ctx, "Recovered in RepairMigrations. Transaction rollback.")
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	results := bc.repairMigrationsInTx(tx, versionName, mismatches)
+	version := bc.getVersionByIDInTx(tx, results.VersionID)
+
+	return results, version
+}
+
+func (bc *baseConnector) repairMigrationsInTx(tx *sql.Tx, versionName string, mismatches []types.CheckSumMismatch) *types.Summary {
+	results := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+	}
+
+	defer func() {
+		results.Duration = time.Since(results.StartedAt.Time).Seconds()
+	}()
+
+	versionID := bc.insertVersionInTx(tx, versionName)
+
+	updateMigrationSQL := bc.dialect.GetMigrationUpdateSQL()
+	update, err := bc.db.PrepareContext(bc.ctx, updateMigrationSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration update: %v", err))
+	}
+
+	insertMigrationSQL := bc.dialect.GetMigrationInsertSQL()
+	insert, err := bc.db.PrepareContext(bc.ctx, insertMigrationSQL)
+	if err != nil {
+		panic(fmt.Sprintf("Could not create prepared statement for migration: %v", err))
+	}
+
+	for _, m := range mismatches {
+		common.LogDebug(bc.ctx, "Repairing migration file: %s, applied checksum: %s, source checksum: %s", m.SourceMigration.File, m.AppliedCheckSum, m.SourceMigration.CheckSum)
+
+		s := m.SourceMigration
+		if _, err = tx.StmtContext(bc.ctx, update).ExecContext(bc.ctx, s.Contents, s.CheckSum, s.File, types.MigrationTypeSingleMigration, types.MigrationTypeTenantMigration); err != nil {
+			panic(fmt.Sprintf("Failed to update migration entry: %v", err.Error()))
+		}
+
+		// repair entry stores replaced contents and checksum
+		if _, err = tx.StmtContext(bc.ctx, insert).ExecContext(bc.ctx, s.Name, s.SourceDir, s.File, types.MigrationTypeRepair, migratorSchema, m.AppliedContents, m.AppliedCheckSum, "", versionID); err != nil {
+			panic(fmt.Sprintf("Failed to add migration entry: %v", err.Error()))
 		}
 
+		results.MigrationsRepaired++
 	}
 
 	results.VersionID = int32(versionID)
@@ -568,5 +1493,5 @@ func (bc *baseConnector) HealthCheck() error {
 	if err := bc.init(); err != nil {
 		return err
 	}
-	return bc.db.Ping()
+	return bc.db.PingContext(bc.ctx)
 }
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// splitCallbacks separates lifecycle callbacks from migrations, order of both is preserved
+func splitCallbacks(migrations []types.Migration) ([]types.Migration, []types.Migration) {
+	var ms, callbacks []types.Migration
+	for _, m := range migrations {
+		if m.MigrationType == types.MigrationTypeCallback {
+			callbacks = append(callbacks, m)
+		} else {
+			ms = append(ms, m)
+		}
+	}
+	return ms, callbacks
+}
+
+// isTenantCallback returns true for callbacks which are executed in tenant schemas
+func isTenantCallback(m types.Migration) bool {
+	return m.MigrationType == types.MigrationTypeCallback && m.CallbackEvent().IsTenant()
+}
+
+// migratedTenants returns tenants in which at least one of tenant migrations & scripts is pending,
+// beforeEachTenant and afterEachTenant callbacks are executed only in such tenants
+func migratedTenants(tenants []string, pendingInTenants map[string]map[string]bool, migrations []types.Migration) []string {
+	var migrated []string
+	for _, t := range tenants {
+		for _, m := range migrations {
+			if isTenantMigration(m) && pendingInTenants[t][m.File] {
+				migrated = append(migrated, t)
+				break
+			}
+		}
+	}
+	return migrated
+}
+
+// applyCallbacks executes callbacks of passed event and records them in the version
+// version callbacks are executed in the schema named after their source dir (like single scripts), tenant callbacks in passed tenants
+func (bc *baseConnector) applyCallbacks(exec execer, insert func() *sql.Stmt, versionID int64, action types.Action, callbacks []types.Migration, event types.CallbackEvent, tenants []string) {
+	for _, m := range callbacks {
+		if m.CallbackEvent() != event {
+			continue
+		}
+		schemas := []string{filepath.Base(m.SourceDir)}
+		if event.IsTenant() {
+			schemas = tenants
+		}
+		bc.applyMigration(exec, insert, versionID, action, m, schemas)
+	}
+}
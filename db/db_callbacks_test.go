@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCallbacks() (types.Migration, types.Migration, types.Migration, types.Migration) {
+	beforeVersion := types.Migration{Name: "beforeVersion.sql", SourceDir: "callbacks", File: "callbacks/beforeVersion.sql", MigrationType: types.MigrationTypeCallback, Contents: "set lock_timeout = 1000"}
+	beforeEachTenant := types.Migration{Name: "beforeEachTenant.sql", SourceDir: "callbacks", File: "callbacks/beforeEachTenant.sql", MigrationType: types.MigrationTypeCallback, Contents: "set search_path to {schema}"}
+	afterEachTenant := types.Migration{Name: "afterEachTenant_grants.sql", SourceDir: "callbacks", File: "callbacks/afterEachTenant_grants.sql", MigrationType: types.MigrationTypeCallback, Contents: "grant select on all tables in schema {schema} to reporting"}
+	afterVersion := types.Migration{Name: "afterVersion_refresh.sql", SourceDir: "callbacks", File: "callbacks/afterVersion_refresh.sql", MigrationType: types.MigrationTypeCallback, Contents: "refresh materialized view public.stats"}
+	return beforeVersion, beforeEachTenant, afterEachTenant, afterVersion
+}
+
+func TestMigratedTenants(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "public", File: "public/001.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration}
+	_, beforeEachTenant, _, _ := testCallbacks()
+
+	tenants, pending := pendingTenantMigrations(map[string][]types.Migration{
+		"abc": {m1, m2, beforeEachTenant},
+		// only single migration and callback are pending in def
+		"def": {m1, beforeEachTenant},
+		"ghi": {},
+	})
+
+	assert.Equal(t, []string{"abc"}, migratedTenants(tenants, pending, []types.Migration{m1, m2, beforeEachTenant}))
+}
+
+func TestCreateVersionCallbacks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	progress := &common.Progress{}
+	ctx := context.WithValue(newTestContext(), common.ProgressKey{}, progress)
+	connector := baseConnector{ctx, config, dialect, db, true}
+
+	beforeVersion, beforeEachTenant, afterEachTenant, afterVersion := testCallbacks()
+	m := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	// m was already applied in def, callbacks are not executed in def
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m},
+		"def": {},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(beforeVersion.Name, beforeVersion.SourceDir, beforeVersion.File, types.MigrationTypeCallback, "callbacks", beforeVersion.Contents, beforeVersion.CheckSum, beforeVersion.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set search_path to abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(beforeEachTenant.Name, beforeEachTenant.SourceDir, beforeEachTenant.File, types.MigrationTypeCallback, "abc", beforeEachTenant.Contents, beforeEachTenant.CheckSum, beforeEachTenant.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, "abc", m.Contents, m.CheckSum, m.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("grant select on all tables in schema abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(afterEachTenant.Name, afterEachTenant.SourceDir, afterEachTenant.File, types.MigrationTypeCallback, "abc", afterEachTenant.Contents, afterEachTenant.CheckSum, afterEachTenant.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("refresh materialized view public.stats").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(afterVersion.Name, afterVersion.SourceDir, afterVersion.File, types.MigrationTypeCallback, "callbacks", afterVersion.Contents, afterVersion.CheckSum, afterVersion.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "abc", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	// callbacks are passed in any order
+	migrations := []types.Migration{m, afterVersion, afterEachTenant, beforeEachTenant, beforeVersion}
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrations, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsGrandTotal)
+	assert.Equal(t, int32(0), results.ScriptsGrandTotal)
+	// callbacks are not counted in progress
+	assert.Equal(t, int32(1), progress.Applied())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionCallbacksPerTenant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.FailurePolicy = "continue"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	beforeVersion, beforeEachTenant, afterEachTenant, afterVersion := testCallbacks()
+	m := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m},
+	}
+
+	// version
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(beforeVersion.Name, beforeVersion.SourceDir, beforeVersion.File, types.MigrationTypeCallback, "callbacks", beforeVersion.Contents, beforeVersion.CheckSum, beforeVersion.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// tenant abc, callbacks are executed in tenant's transaction
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set search_path to abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("grant select on all tables in schema abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// afterVersion callbacks are executed once all tenants are done
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("refresh materialized view public.stats").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(afterVersion.Name, afterVersion.SourceDir, afterVersion.File, types.MigrationTypeCallback, "callbacks", afterVersion.Contents, afterVersion.CheckSum, afterVersion.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "abc", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	migrations := []types.Migration{m, beforeVersion, beforeEachTenant, afterEachTenant, afterVersion}
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrations, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.TenantsSucceeded)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateTenantCallbacks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	afterCreateTenant := types.Migration{Name: "afterCreateTenant.sql", SourceDir: "callbacks", File: "callbacks/afterCreateTenant.sql", MigrationType: types.MigrationTypeCallback, Contents: "insert into {schema}.settings values (1)"}
+	m := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.settings (id int)"}
+
+	mock.ExpectBegin()
+	// tenant
+	mock.ExpectExec("create schema if not exists abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_tenants")
+	mock.ExpectPrepare("insert into migrator.migrator_tenants").ExpectExec().WithArgs("abc", nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table abc.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into abc.settings").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(afterCreateTenant.Name, afterCreateTenant.SourceDir, afterCreateTenant.File, types.MigrationTypeCallback, "abc", afterCreateTenant.Contents, afterCreateTenant.CheckSum, afterCreateTenant.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "abc", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.CreateTenant(types.Tenant{Name: "abc"}, "commit-sha", types.ActionApply, []types.Migration{m, afterCreateTenant}, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -1,10 +1,16 @@
 package db
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"syscall"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 )
 
 var isValidIdentifier = regexp.MustCompile(`^[A-Za-z0-9_-]+$`).MatchString
@@ -14,17 +20,41 @@ type dialect interface {
 	GetTenantInsertSQL() string
 	GetTenantSelectSQL() string
 	GetMigrationInsertSQL() string
+	GetMigrationUpdateSQL() string
 	GetMigrationSelectSQL() string
 	GetMigrationByIDSQL() string
 	GetCreateTenantsTableSQL() string
 	GetCreateMigrationsTableSQL() string
 	GetCreateSchemaSQL(string) string
+	GetRenameSchemaSQL(string, string) []string
+	GetDropSchemaSQL(string) []string
+	GetTenantDeleteSQL() string
+	GetAddColumnSQL(string, string, string) []string
 	GetCreateVersionsTableSQL() []string
 	GetVersionInsertSQL() string
 	GetVersionsSelectSQL() string
 	GetVersionsByFileSQL() string
 	GetVersionByIDSQL() string
+	GetCreateLocksTableSQL() string
+	GetLockSQL() string
+	GetUnlockSQL() string
+	GetLockHolderInsertSQL() string
+	GetLockHolderDeleteSQL() string
+	GetLockHolderSelectSQL() string
+	GetCreateJobsTableSQL() string
+	GetJobInsertSQL() string
+	GetJobUpdateSQL() string
+	GetJobByIDSQL() string
+	GetJobCancelSQL() string
+	GetStaleJobsFailSQL() string
+	GetLegacyTableExistsSQL(string, string) string
+	GetLegacyHistorySelectSQL(types.LegacyTool, string, string) string
+	GetStatementTimeoutSQL(time.Duration) []string
+	GetResetStatementTimeoutSQL() []string
 	LastInsertIDSupported() bool
+	TransactionalDDLSupported() bool
+	SplitStatements(string) []statement
+	IsTransientError(error) bool
 }
 
 // baseDialect struct is used to provide default dialect interface implementation
@@ -32,9 +62,9 @@ type baseDialect struct {
 }
 
 const (
-	selectVersionsSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id order by vid desc, mid asc"
+	selectVersionsSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id order by vid desc, mid asc"
 	selectMigrationsSQL      = "select name, source_dir as sd, filename, type, db_schema, created, contents, checksum from %v.%v order by name, source_dir"
-	selectTenantsSQL         = "select name from %v.%v"
+	selectTenantsSQL         = "select name, metadata from %v.%v"
 	createMigrationsTableSQL = `
 create table if not exists %v.%v (
   id serial primary key,
@@ -55,7 +85,35 @@ create table if not exists %v.%v (
   created timestamp default now()
 )
 `
-	createSchemaSQL = "create schema if not exists %v"
+	createLocksTableSQL = `
+create table if not exists %v.%v (
+  holder varchar(200) not null,
+  created timestamp default now()
+)
+`
+	createJobsTableSQL = `
+create table if not exists %v.%v (
+  id serial primary key,
+  state int not null,
+  version_name varchar(200) not null,
+  created timestamp default now(),
+  updated timestamp default now(),
+  migrations_total int not null default 0,
+  migrations_applied int not null default 0,
+  version_id int,
+  summary text,
+  error text,
+  cancel_requested int not null default 0
+)
+`
+	createSchemaSQL     = "create schema if not exists %v"
+	deleteLockHolderSQL = "delete from %v.%v"
+	selectLockHolderSQL = "select holder, created from %v.%v"
+	// legacy history tables are read from schemas of single schema migrations and from tenant schemas
+	legacyTableExistsSQL          = "select count(*) from information_schema.tables where table_schema = '%v' and lower(table_name) = lower('%v')"
+	selectFlywayHistorySQL        = "select version, description, script, checksum, success from %v.%v order by installed_rank"
+	selectLiquibaseHistorySQL     = "select id, description, filename, md5sum, exectype from %v.%v order by orderexecuted"
+	selectGolangMigrateHistorySQL = "select version, dirty from %v.%v"
 )
 
 // GetCreateTenantsTableSQL returns migrator's default create tenants table SQL statement.
@@ -70,6 +128,30 @@ func (bd *baseDialect) GetCreateMigrationsTableSQL() string {
 	return fmt.Sprintf(createMigrationsTableSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetCreateLocksTableSQL returns migrator's create locks table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateLocksTableSQL() string {
+	return fmt.Sprintf(createLocksTableSQL, migratorSchema, migratorLocksTable)
+}
+
+// GetCreateJobsTableSQL returns migrator's create jobs table SQL statement.
+// This SQL is used by both MySQL and PostgreSQL.
+func (bd *baseDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetLockHolderDeleteSQL returns SQL statement which removes information about previous holder of migration lock.
+// Locks table holds at most one row and the statement takes no parameters so it needs no dialect-specific placeholders.
+func (bd *baseDialect) GetLockHolderDeleteSQL() string {
+	return fmt.Sprintf(deleteLockHolderSQL, migratorSchema, migratorLocksTable)
+}
+
+// GetLockHolderSelectSQL returns SQL statement which returns holder of migration lock and since when it is held.
+// The statement takes no parameters so it needs no dialect-specific placeholders.
+func (bd *baseDialect) GetLockHolderSelectSQL() string {
+	return fmt.Sprintf(selectLockHolderSQL, migratorSchema, migratorLocksTable)
+}
+
 // GetTenantSelectSQL returns migrator's default tenant select SQL statement.
 // This SQL is used by all MySQL, PostgreSQL, and MS SQL.
 func (bd *baseDialect) GetTenantSelectSQL() string {
@@ -91,12 +173,43 @@ func (bd *baseDialect) GetCreateSchemaSQL(schema string) string {
 	return fmt.Sprintf(createSchemaSQL, schema)
 }
 
+// GetLegacyTableExistsSQL returns SQL statement which counts history tables of legacy migration tool in given schema.
+// It queries information_schema.tables and compares table names case-insensitively as MySQL on Windows and PostgreSQL fold unquoted names.
+func (bd *baseDialect) GetLegacyTableExistsSQL(schema, table string) string {
+	if !isValidIdentifier(schema) || !isValidIdentifier(table) {
+		panic(fmt.Sprintf("Schema or table name contains invalid characters: %v, %v", schema, table))
+	}
+	return fmt.Sprintf(legacyTableExistsSQL, schema, table)
+}
+
+// GetLegacyHistorySelectSQL returns SQL statement which reads history table of legacy migration tool in given schema.
+// Rows are returned in the order in which the legacy tool applied migrations (Flyway's installed_rank, Liquibase's orderexecuted), golang-migrate keeps a single row.
+func (bd *baseDialect) GetLegacyHistorySelectSQL(tool types.LegacyTool, schema, table string) string {
+	if !isValidIdentifier(schema) || !isValidIdentifier(table) {
+		panic(fmt.Sprintf("Schema or table name contains invalid characters: %v, %v", schema, table))
+	}
+	switch tool {
+	case types.LegacyToolLiquibase:
+		return fmt.Sprintf(selectLiquibaseHistorySQL, schema, table)
+	case types.LegacyToolGolangMigrate:
+		return fmt.Sprintf(selectGolangMigrateHistorySQL, schema, table)
+	default:
+		return fmt.Sprintf(selectFlywayHistorySQL, schema, table)
+	}
+}
+
 // GetVersionsSelectSQL returns select SQL statement that returns all versions
 // This SQL is used by both MySQL and PostgreSQL.
 func (bd *baseDialect) GetVersionsSelectSQL() string {
 	return fmt.Sprintf(selectVersionsSQL, migratorSchema, migratorVersionsTable, migratorSchema, migratorMigrationsTable)
 }
 
+// isConnectionError returns true when error was caused by broken DB connection,
+// transaction run on such connection was rolled back and can be safely run again
+func isConnectionError(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 // newDialect constructs dialect instance based on the passed Config
 func newDialect(config *config.Config) dialect {
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -84,7 +85,64 @@ func TestBaseDialectGetVersionsSelectSQL(t *testing.T) {
 
 	versionsSelectSQL := dialect.GetVersionsSelectSQL()
 
-	expected := "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id order by vid desc, mid asc"
+	expected := "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id order by vid desc, mid asc"
 
 	assert.Equal(t, expected, versionsSelectSQL)
 }
+
+func TestBaseDialectGetLockHolderSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	dialect := newDialect(config)
+
+	expected := `
+create table if not exists migrator.migrator_locks (
+  holder varchar(200) not null,
+  created timestamp default now()
+)
+`
+
+	assert.Equal(t, expected, dialect.GetCreateLocksTableSQL())
+	assert.Equal(t, "delete from migrator.migrator_locks", dialect.GetLockHolderDeleteSQL())
+	assert.Equal(t, "select holder, created from migrator.migrator_locks", dialect.GetLockHolderSelectSQL())
+}
+
+func TestBaseDialectGetCreateJobsTableSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	dialect := newDialect(config)
+
+	expected := `
+create table if not exists migrator.migrator_jobs (
+  id serial primary key,
+  state int not null,
+  version_name varchar(200) not null,
+  created timestamp default now(),
+  updated timestamp default now(),
+  migrations_total int not null default 0,
+  migrations_applied int not null default 0,
+  version_id int,
+  summary text,
+  error text,
+  cancel_requested int not null default 0
+)
+`
+
+	assert.Equal(t, expected, dialect.GetCreateJobsTableSQL())
+}
+
+func TestBaseDialectGetLegacyHistorySelectSQLError(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	dialect := newDialect(config)
+
+	assert.PanicsWithValue(t, "Schema or table name contains invalid characters: abc, flyway_schema_history; drop table users", func() {
+		dialect.GetLegacyHistorySelectSQL(types.LegacyToolFlyway, "abc", "flyway_schema_history; drop table users")
+	})
+	assert.PanicsWithValue(t, "Schema or table name contains invalid characters: abc', flyway_schema_history", func() {
+		dialect.GetLegacyTableExistsSQL("abc'", "flyway_schema_history")
+	})
+}
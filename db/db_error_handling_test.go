@@ -79,6 +79,31 @@ func TestInitCannotCreateMigratorMigrationsTable(t *testing.T) {
 	}
 }
 
+func TestInitCannotAddDownContentsColumn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not add down_contents column to migrations table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestInitCannotCreateMigratorVersionsTable(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
@@ -92,6 +117,7 @@ func TestInitCannotCreateMigratorVersionsTable(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
 	// create versions table is a script
 	mock.ExpectExec("begin").WillReturnError(errors.New("trouble maker"))
 
@@ -118,6 +144,7 @@ func TestInitCannotCreateMigratorTenantsTable(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
 	// create versions table is a script
 	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
@@ -132,6 +159,65 @@ func TestInitCannotCreateMigratorTenantsTable(t *testing.T) {
 	}
 }
 
+func TestInitCannotCreateMigratorLocksTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create locks table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestInitCannotCreateMigratorJobsTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, false}
+
+	mock.ExpectBegin()
+	// don't have to provide full SQL here - patterns at work
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnError(errors.New("trouble maker"))
+
+	initErr := connector.init()
+
+	assert.NotNil(t, initErr)
+	assert.Contains(t, initErr.Error(), "could not create jobs table: trouble maker")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestInitCannotCommitTransaction(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
@@ -145,8 +231,12 @@ func TestInitCannotCommitTransaction(t *testing.T) {
 	// don't have to provide full SQL here - patterns at work
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("begin").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectCommit().WillReturnError(errors.New("trouble maker"))
 
 	initErr := connector.init()
@@ -219,7 +309,7 @@ func TestCreateVersionTransactionBeginError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -247,7 +337,7 @@ func TestCreateVersionInsertVersionPreparedStatementError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Could not create prepared statement for version: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -279,7 +369,7 @@ func TestCreateVersionInsertMigrationPreparedStatementError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Could not create prepared statement for migration: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -311,8 +401,8 @@ func TestCreateVersionMigrationSQLError(t *testing.T) {
 	tenant1 := types.Migration{Name: fmt.Sprintf("%v.sql", t1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", t1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
 	migrationsToApply := []types.Migration{tenant1}
 
-	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed with error: trouble maker", tenant1.File), func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: trouble maker", tenant1.File), func() {
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -343,11 +433,11 @@ func TestCreateVersionInsertMigrationError(t *testing.T) {
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnError(errors.New("trouble maker"))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
 	assert.PanicsWithValue(t, "Failed to add migration entry: trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -378,12 +468,12 @@ func TestCreateVersionGetVersionError(t *testing.T) {
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
 	mock.ExpectQuery("select").WillReturnError(errors.New("get version trouble maker"))
 
 	assert.PanicsWithValue(t, "Could not query versions: get version trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -414,13 +504,13 @@ func TestCreateVersionVersionNotFound(t *testing.T) {
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"})
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"})
 	mock.ExpectQuery("select").WillReturnRows(rows)
 
 	assert.PanicsWithValue(t, "Version not found ID: 0", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -451,14 +541,14 @@ func TestCreateVersionMigrationsCommitError(t *testing.T) {
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
 	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -482,7 +572,7 @@ func TestCreateTenantTransactionBeginError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Could not start transaction: trouble maker tx.Begin()", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateTenant(types.Tenant{Name: "newtenant"}, "commit-sha", types.ActionApply, migrationsToApply, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -508,7 +598,7 @@ func TestCreateTenantCreateSchemaError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Create schema failed: trouble maker", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateTenant(types.Tenant{Name: "newtenant"}, "commit-sha", types.ActionApply, migrationsToApply, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -535,7 +625,7 @@ func TestCreateTenantInsertTenantPreparedStatementError(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1}
 
 	assert.PanicsWithValue(t, "Could not create prepared statement: trouble maker", func() {
-		connector.CreateTenant("newtenant", "commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateTenant(types.Tenant{Name: "newtenant"}, "commit-sha", types.ActionApply, migrationsToApply, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -557,7 +647,7 @@ func TestCreateTenantInsertTenantError(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectPrepare("insert into")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnError(errors.New("trouble maker"))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant, nil).WillReturnError(errors.New("trouble maker"))
 	mock.ExpectRollback()
 
 	t1 := time.Now().UnixNano()
@@ -565,7 +655,7 @@ func TestCreateTenantInsertTenantError(t *testing.T) {
 	migrationsToApply := []types.Migration{m1}
 
 	assert.PanicsWithValue(t, "Failed to add tenant entry: trouble maker", func() {
-		connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateTenant(types.Tenant{Name: tenant}, "commit-sha", types.ActionApply, migrationsToApply, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -591,21 +681,21 @@ func TestCreateTenantCommitError(t *testing.T) {
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant, nil).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
 	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit().WillReturnError(errors.New("tx trouble maker"))
 
 	assert.PanicsWithValue(t, "Could not commit transaction: tx trouble maker", func() {
-		connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+		connector.CreateTenant(types.Tenant{Name: tenant}, "commit-sha", types.ActionApply, migrationsToApply, false)
 	})
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -696,3 +786,33 @@ func TestGetDBMigrationByIDError(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestRollbackVersionDownMigrationError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602220000.sql", SourceDir: "public", File: "public/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc", DownContents: "drop table abc"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: "public"}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Rollback of version 1")
+	// migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("drop table abc").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	assert.PanicsWithValue(t, "SQL down migration public/201602220000.sql failed at statement 1 (line 1) with error: trouble maker", func() {
+		connector.RollbackVersion("Rollback of version 1", migrationsToRollback, false)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
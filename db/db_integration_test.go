@@ -83,7 +83,7 @@ func TestCreateVersion(t *testing.T) {
 
 			migrationsToApply := []types.Migration{public1, public2, public3, tenant1, tenant2, tenant3, public4, public5, tenant4}
 
-			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 
 			assert.NotNil(t, version)
 			assert.True(t, version.ID > 0)
@@ -125,7 +125,7 @@ func TestCreateVersionEmptyMigrationArray(t *testing.T) {
 
 			migrationsToApply := []types.Migration{}
 
-			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, false)
 			// empty migrations slice - no version created
 			assert.Nil(t, version)
 			assert.Equal(t, int32(0), results.MigrationsGrandTotal)
@@ -149,7 +149,7 @@ func TestGetTenantsSQLDefault(t *testing.T) {
 
 			tenantSelectSQL := connector.getTenantSelectSQL()
 
-			assert.Equal(t, "select name from migrator.migrator_tenants", tenantSelectSQL)
+			assert.Equal(t, "select name, metadata from migrator.migrator_tenants", tenantSelectSQL)
 		})
 	}
 }
@@ -178,7 +178,7 @@ func TestCreateTenant(t *testing.T) {
 
 			uniqueTenant := fmt.Sprintf("new_test_tenant_%v", time.Now().UnixNano())
 
-			results, version := connector.CreateTenant(uniqueTenant, "commit-sha", types.ActionApply, migrationsToApply, false)
+			results, version := connector.CreateTenant(types.Tenant{Name: uniqueTenant}, "commit-sha", types.ActionApply, migrationsToApply, false)
 
 			assert.NotNil(t, version)
 			assert.True(t, version.ID > 0)
@@ -323,3 +323,93 @@ func TestGetDBMigrationByIDNotFound(t *testing.T) {
 		})
 	}
 }
+
+func TestLockIntegration(t *testing.T) {
+	supportedDatabases := getSupportedDatabases()
+
+	for _, database := range supportedDatabases {
+		t.Run(database, func(t *testing.T) {
+			configFile := fmt.Sprintf("../test/migrator-%s.yaml", database)
+			config, err := config.FromFile(configFile)
+			assert.Nil(t, err)
+			config.LockTimeout = 1
+
+			connector := New(newTestContext(), config)
+			defer connector.Dispose()
+
+			unlock, err := connector.Lock()
+			assert.Nil(t, err)
+
+			// lock is held by a different DB session
+			_, err = connector.Lock()
+			assert.IsType(t, &LockHeldError{}, err)
+			assert.Equal(t, lockHolder(), err.(*LockHeldError).Holder)
+
+			unlock()
+
+			unlock, err = connector.Lock()
+			assert.Nil(t, err)
+			unlock()
+		})
+	}
+}
+
+func TestJobsIntegration(t *testing.T) {
+	supportedDatabases := getSupportedDatabases()
+
+	for _, database := range supportedDatabases {
+		t.Run(database, func(t *testing.T) {
+			configFile := fmt.Sprintf("../test/migrator-%s.yaml", database)
+			config, err := config.FromFile(configFile)
+			assert.Nil(t, err)
+
+			connector := New(newTestContext(), config)
+			defer connector.Dispose()
+
+			versionName := fmt.Sprintf("async-%v", time.Now().UnixNano())
+			job := connector.CreateJob(versionName)
+			assert.True(t, job.ID > 0)
+			assert.Equal(t, types.JobStateQueued, job.State)
+
+			job.State = types.JobStateRunning
+			job.MigrationsTotal = 3
+			job.MigrationsApplied = 1
+			err = connector.UpdateJob(job)
+			assert.Nil(t, err)
+
+			running, err := connector.GetJobByID(job.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, types.JobStateRunning, running.State)
+			assert.Equal(t, versionName, running.VersionName)
+			assert.Equal(t, int32(3), running.MigrationsTotal)
+			assert.Equal(t, int32(1), running.MigrationsApplied)
+			assert.Nil(t, running.Results)
+			assert.Nil(t, running.Error)
+			assert.False(t, running.CancelRequested)
+
+			cancelled, err := connector.CancelJob(job.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, types.JobStateRunning, cancelled.State)
+			assert.True(t, cancelled.CancelRequested)
+
+			versions := connector.GetVersions()
+			job.State = types.JobStateSucceeded
+			job.MigrationsApplied = 3
+			job.Results = &types.CreateResults{Summary: &types.Summary{VersionID: versions[0].ID, MigrationsGrandTotal: 3}, Version: &versions[0]}
+			err = connector.UpdateJob(job)
+			assert.Nil(t, err)
+
+			succeeded, err := connector.GetJobByID(job.ID)
+			assert.Nil(t, err)
+			assert.Equal(t, types.JobStateSucceeded, succeeded.State)
+			assert.Equal(t, int32(3), succeeded.Results.Summary.MigrationsGrandTotal)
+			assert.Equal(t, versions[0].ID, succeeded.Results.Version.ID)
+
+			_, err = connector.CancelJob(job.ID)
+			assert.Equal(t, fmt.Sprintf("job %v already finished with state: Succeeded", job.ID), err.Error())
+
+			_, err = connector.GetJobByID(-1)
+			assert.Equal(t, "job not found ID: -1", err.Error())
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// jobContext returns context used to store jobs, state of a job must be stored even when job was cancelled
+func jobContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// CreateJob creates new queued asynchronous job which creates version with passed name
+func (bc *baseConnector) CreateJob(versionName string) *types.Job {
+	bc.initOrPanic()
+
+	var jobID int64
+	jobInsertSQL := bc.dialect.GetJobInsertSQL()
+	if bc.dialect.LastInsertIDSupported() {
+		result, err := bc.db.ExecContext(bc.ctx, jobInsertSQL, types.JobStateQueued, versionName)
+		if err != nil {
+			panic(fmt.Sprintf("Could not create job: %v", err))
+		}
+		jobID, _ = result.LastInsertId()
+	} else {
+		if err := bc.db.QueryRowContext(bc.ctx, jobInsertSQL, types.JobStateQueued, versionName).Scan(&jobID); err != nil {
+			panic(fmt.Sprintf("Could not create job: %v", err))
+		}
+	}
+
+	created := graphql.Time{Time: time.Now()}
+	return &types.Job{ID: int32(jobID), State: types.JobStateQueued, VersionName: versionName, Created: created, Updated: created}
+}
+
+// UpdateJob stores state, progress, and results of passed job
+func (bc *baseConnector) UpdateJob(job *types.Job) error {
+	bc.initOrPanic()
+
+	versionID, summary, jobError, err := encodeJobResults(job)
+	if err != nil {
+		return err
+	}
+
+	jobUpdateSQL := bc.dialect.GetJobUpdateSQL()
+	if _, err := bc.db.ExecContext(jobContext(bc.ctx), jobUpdateSQL, job.State, job.MigrationsTotal, job.MigrationsApplied, versionID, summary, jobError, job.ID); err != nil {
+		return fmt.Errorf("could not update job: %v", err)
+	}
+
+	return nil
+}
+
+// GetJobByID returns job together with its results, job's version is read from versions table
+func (bc *baseConnector) GetJobByID(ID int32) (*types.Job, error) {
+	bc.initOrPanic()
+
+	var (
+		job             types.Job
+		created         time.Time
+		updated         time.Time
+		versionID       sql.NullInt32
+		summary         sql.NullString
+		jobError        sql.NullString
+		cancelRequested int
+	)
+
+	jobSelectSQL := bc.dialect.GetJobByIDSQL()
+	err := bc.db.QueryRowContext(jobContext(bc.ctx), jobSelectSQL, ID).Scan(&job.ID, &job.State, &job.VersionName, &created, &updated, &job.MigrationsTotal, &job.MigrationsApplied, &versionID, &summary, &jobError, &cancelRequested)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found ID: %v", ID)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Could not query job: %v", err))
+	}
+	job.Created = graphql.Time{Time: created}
+	job.Updated = graphql.Time{Time: updated}
+	job.CancelRequested = cancelRequested == 1
+
+	if err := decodeJobResults(&job, summary, jobError); err != nil {
+		return nil, err
+	}
+	if job.Results != nil && versionID.Valid {
+		// version can be nil when there were no migrations to apply
+		job.Results.Version, _ = bc.GetVersionByID(versionID.Int32)
+	}
+
+	return &job, nil
+}
+
+// CancelJob requests cancellation of queued or running job, the job is cancelled by the migrator which runs it
+func (bc *baseConnector) CancelJob(ID int32) (*types.Job, error) {
+	bc.initOrPanic()
+
+	result, err := bc.db.ExecContext(bc.ctx, bc.dialect.GetJobCancelSQL(), ID, types.JobStateQueued, types.JobStateRunning)
+	if err != nil {
+		panic(fmt.Sprintf("Could not cancel job: %v", err))
+	}
+
+	job, err := bc.GetJobByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("job %v already finished with state: %v", ID, job.State)
+	}
+
+	return job, nil
+}
+
+// FailStaleJobs marks queued and running jobs which were not updated for longer than staleAfter as failed with passed error,
+// running jobs store their progress periodically, stale jobs were orphaned by migrator which was stopped while running them
+// the time is compared using DB clock as job's updated column is set by DB
+func (bc *baseConnector) FailStaleJobs(staleAfter time.Duration, failure string) error {
+	bc.initOrPanic()
+
+	if _, err := bc.db.ExecContext(jobContext(bc.ctx), bc.dialect.GetStaleJobsFailSQL(), types.JobStateFailed, failure, types.JobStateQueued, types.JobStateRunning, int(staleAfter.Seconds())); err != nil {
+		return fmt.Errorf("could not fail stale jobs: %v", err)
+	}
+
+	return nil
+}
+
+// encodeJobResults returns job's version ID, JSON-encoded summary, and error which are stored in DB
+func encodeJobResults(job *types.Job) (sql.NullInt32, sql.NullString, sql.NullString, error) {
+	var (
+		versionID sql.NullInt32
+		summary   sql.NullString
+		jobError  sql.NullString
+	)
+	if job.Results != nil {
+		if job.Results.Version != nil {
+			versionID = sql.NullInt32{Int32: job.Results.Version.ID, Valid: true}
+		}
+		if job.Results.Summary != nil {
+			encoded, err := json.Marshal(job.Results.Summary)
+			if err != nil {
+				return versionID, summary, jobError, fmt.Errorf("could not encode job summary: %v", err)
+			}
+			summary = sql.NullString{String: string(encoded), Valid: true}
+		}
+	}
+	if job.Error != nil {
+		jobError = sql.NullString{String: *job.Error, Valid: true}
+	}
+	return versionID, summary, jobError, nil
+}
+
+// decodeJobResults sets job's results (without version) and error read from DB
+func decodeJobResults(job *types.Job, summary sql.NullString, jobError sql.NullString) error {
+	if summary.Valid {
+		job.Results = &types.CreateResults{Summary: &types.Summary{}}
+		if err := json.Unmarshal([]byte(summary.String), job.Results.Summary); err != nil {
+			return fmt.Errorf("could not decode job summary: %v", err)
+		}
+	}
+	if jobError.Valid {
+		job.Error = &jobError.String
+	}
+	return nil
+}
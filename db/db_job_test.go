@@ -0,0 +1,231 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery(regexp.QuoteMeta("insert into migrator.migrator_jobs (state, version_name) values ($1, $2) returning id")).WithArgs(types.JobStateQueued, "commit-sha").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+
+	job := connector.CreateJob("commit-sha")
+
+	assert.Equal(t, int32(12), job.ID)
+	assert.Equal(t, types.JobStateQueued, job.State)
+	assert.Equal(t, "commit-sha", job.VersionName)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateJobLastInsertID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectExec(regexp.QuoteMeta("insert into migrator.migrator_jobs (state, version_name) values (?, ?)")).WithArgs(types.JobStateQueued, "commit-sha").WillReturnResult(sqlmock.NewResult(13, 1))
+
+	job := connector.CreateJob("commit-sha")
+
+	assert.Equal(t, int32(13), job.ID)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateJobError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery("insert into migrator.migrator_jobs").WillReturnError(errors.New("trouble maker"))
+
+	assert.PanicsWithValue(t, "Could not create job: trouble maker", func() {
+		connector.CreateJob("commit-sha")
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUpdateJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	results := &types.CreateResults{Summary: &types.Summary{VersionID: 3, Tenants: 2}, Version: &types.Version{ID: 3}}
+	job := &types.Job{ID: 12, State: types.JobStateSucceeded, MigrationsTotal: 5, MigrationsApplied: 5, Results: results}
+
+	mock.ExpectExec(regexp.QuoteMeta("update migrator.migrator_jobs set state = $1")).WithArgs(types.JobStateSucceeded, 5, 5, 3, sqlmock.AnyArg(), nil, 12).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = connector.UpdateJob(job)
+	assert.Nil(t, err)
+
+	jobError := "trouble maker"
+	job = &types.Job{ID: 12, State: types.JobStateFailed, MigrationsTotal: 5, MigrationsApplied: 2, Error: &jobError}
+
+	mock.ExpectExec(regexp.QuoteMeta("update migrator.migrator_jobs set state = $1")).WithArgs(types.JobStateFailed, 5, 2, nil, nil, "trouble maker", 12).WillReturnError(errors.New("connection lost"))
+
+	err = connector.UpdateJob(job)
+	assert.Equal(t, "could not update job: connection lost", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetJobByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	created := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	updated := time.Date(2016, 02, 22, 16, 42, 1, 123, time.UTC)
+	columns := []string{"id", "state", "version_name", "created", "updated", "migrations_total", "migrations_applied", "version_id", "summary", "error", "cancel_requested"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from migrator.migrator_jobs where id = $1")).WithArgs(12).WillReturnRows(sqlmock.NewRows(columns).AddRow(12, types.JobStateFailed, "commit-sha", created, updated, 5, 2, nil, nil, "trouble maker", 0))
+
+	job, err := connector.GetJobByID(12)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(12), job.ID)
+	assert.Equal(t, types.JobStateFailed, job.State)
+	assert.Equal(t, "commit-sha", job.VersionName)
+	assert.Equal(t, created, job.Created.Time)
+	assert.Equal(t, updated, job.Updated.Time)
+	assert.Equal(t, int32(5), job.MigrationsTotal)
+	assert.Equal(t, int32(2), job.MigrationsApplied)
+	assert.Nil(t, job.Results)
+	assert.Equal(t, "trouble maker", *job.Error)
+	assert.False(t, job.CancelRequested)
+
+	mock.ExpectQuery("select id, state").WithArgs(13).WillReturnRows(sqlmock.NewRows(columns).AddRow(13, types.JobStateSucceeded, "commit-sha", created, updated, 5, 5, nil, `{"tenants":2,"migrationsGrandTotal":5}`, nil, 0))
+
+	job, err = connector.GetJobByID(13)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateSucceeded, job.State)
+	assert.Nil(t, job.Error)
+	assert.Equal(t, int32(2), job.Results.Summary.Tenants)
+	assert.Equal(t, int32(5), job.Results.Summary.MigrationsGrandTotal)
+	assert.Nil(t, job.Results.Version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetJobByIDNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery("select id, state").WithArgs(14).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	job, err := connector.GetJobByID(14)
+	assert.Nil(t, job)
+	assert.Equal(t, "job not found ID: 14", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	created := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	columns := []string{"id", "state", "version_name", "created", "updated", "migrations_total", "migrations_applied", "version_id", "summary", "error", "cancel_requested"}
+
+	mock.ExpectExec(regexp.QuoteMeta("update migrator.migrator_jobs set cancel_requested = 1, updated = current_timestamp where id = $1 and state in ($2, $3)")).WithArgs(12, types.JobStateQueued, types.JobStateRunning).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("select id, state").WithArgs(12).WillReturnRows(sqlmock.NewRows(columns).AddRow(12, types.JobStateRunning, "commit-sha", created, created, 5, 2, nil, nil, nil, 1))
+
+	job, err := connector.CancelJob(12)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateRunning, job.State)
+	assert.True(t, job.CancelRequested)
+
+	mock.ExpectExec("update migrator.migrator_jobs set cancel_requested").WithArgs(13, types.JobStateQueued, types.JobStateRunning).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select id, state").WithArgs(13).WillReturnRows(sqlmock.NewRows(columns).AddRow(13, types.JobStateSucceeded, "commit-sha", created, created, 5, 5, nil, nil, nil, 0))
+
+	job, err = connector.CancelJob(13)
+	assert.Nil(t, job)
+	assert.Equal(t, "job 13 already finished with state: Succeeded", err.Error())
+
+	mock.ExpectExec("update migrator.migrator_jobs set cancel_requested").WithArgs(14, types.JobStateQueued, types.JobStateRunning).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select id, state").WithArgs(14).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	job, err = connector.CancelJob(14)
+	assert.Nil(t, job)
+	assert.Equal(t, "job not found ID: 14", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFailStaleJobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectExec(regexp.QuoteMeta("update migrator.migrator_jobs set state = $1, error = $2, updated = current_timestamp where state in ($3, $4) and updated < current_timestamp - make_interval(secs => $5)")).WithArgs(types.JobStateFailed, "job orphaned", types.JobStateQueued, types.JobStateRunning, 60).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = connector.FailStaleJobs(time.Minute, "job orphaned")
+	assert.Nil(t, err)
+
+	mock.ExpectExec("update migrator.migrator_jobs set state").WillReturnError(errors.New("trouble maker"))
+
+	err = connector.FailStaleJobs(time.Minute, "job orphaned")
+	assert.Equal(t, "could not fail stale jobs: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// liquibaseSucceeded returns true for Liquibase exec types of changesets which were run or marked as run
+func liquibaseSucceeded(execType string) bool {
+	return execType == "EXECUTED" || execType == "RERAN" || execType == "MARK_RAN"
+}
+
+// GetLegacyHistory reads history table of legacy migration tool from passed schemas, schemas without the table are skipped
+func (bc *baseConnector) GetLegacyHistory(tool types.LegacyTool, table string, schemas []string) []types.LegacyHistoryEntry {
+	bc.initOrPanic()
+
+	entries := []types.LegacyHistoryEntry{}
+	for _, schema := range schemas {
+		var count int
+		if err := bc.db.QueryRowContext(bc.ctx, bc.dialect.GetLegacyTableExistsSQL(schema, table)).Scan(&count); err != nil {
+			panic(fmt.Sprintf("Could not check if %v history table exists in %v: %v", tool, schema, err.Error()))
+		}
+		if count == 0 {
+			common.LogInfo(bc.ctx, "%v history table %v not found in %v, skipping", tool, table, schema)
+			continue
+		}
+		entries = append(entries, bc.readLegacyHistory(tool, schema, table)...)
+	}
+	return entries
+}
+
+// readLegacyHistory reads all entries of history table of legacy migration tool stored in given schema
+func (bc *baseConnector) readLegacyHistory(tool types.LegacyTool, schema, table string) []types.LegacyHistoryEntry {
+	rows, err := bc.db.QueryContext(bc.ctx, bc.dialect.GetLegacyHistorySelectSQL(tool, schema, table))
+	if err != nil {
+		panic(fmt.Sprintf("Could not query %v history in %v: %v", tool, schema, err.Error()))
+	}
+	defer rows.Close()
+
+	entries := []types.LegacyHistoryEntry{}
+	for rows.Next() {
+		entry := types.LegacyHistoryEntry{Schema: schema}
+		switch tool {
+		case types.LegacyToolLiquibase:
+			var description, checksum sql.NullString
+			var execType string
+			err = rows.Scan(&entry.Version, &description, &entry.Script, &checksum, &execType)
+			entry.Description = description.String
+			entry.CheckSum = checksum.String
+			entry.Success = liquibaseSucceeded(execType)
+		case types.LegacyToolGolangMigrate:
+			var version int64
+			var dirty bool
+			err = rows.Scan(&version, &dirty)
+			entry.Version = strconv.FormatInt(version, 10)
+			entry.Success = !dirty
+		default:
+			var version, script, checksum sql.NullString
+			err = rows.Scan(&version, &entry.Description, &script, &checksum, &entry.Success)
+			entry.Version = version.String
+			entry.Script = script.String
+			entry.CheckSum = checksum.String
+		}
+		if err != nil {
+			panic(fmt.Sprintf("Could not read %v history in %v: %v", tool, schema, err.Error()))
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLegacyHistoryFlyway(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	// history table does not exist in public schema
+	mock.ExpectQuery(regexp.QuoteMeta("select count(*) from information_schema.tables where table_schema = 'public' and lower(table_name) = lower('flyway_schema_history')")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("table_schema = 'abc'")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"version", "description", "script", "checksum", "success"}).
+		AddRow("1", "<< Flyway Baseline >>", "<< Flyway Baseline >>", nil, true).
+		AddRow("1.1", "create users", "V1_1__create_users.sql", -1234567, true).
+		AddRow(nil, "users view", "R__users_view.sql", 7654321, false)
+	mock.ExpectQuery(regexp.QuoteMeta("select version, description, script, checksum, success from abc.flyway_schema_history order by installed_rank")).WillReturnRows(rows)
+
+	entries := connector.GetLegacyHistory(types.LegacyToolFlyway, "flyway_schema_history", []string{"public", "abc"})
+
+	assert.Len(t, entries, 3)
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Version: "1", Description: "<< Flyway Baseline >>", Script: "<< Flyway Baseline >>", Success: true}, entries[0])
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Version: "1.1", Description: "create users", Script: "V1_1__create_users.sql", CheckSum: "-1234567", Success: true}, entries[1])
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Description: "users view", Script: "R__users_view.sql", CheckSum: "7654321", Success: false}, entries[2])
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetLegacyHistoryLiquibase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery(regexp.QuoteMeta("lower(table_name) = lower('DATABASECHANGELOG')")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"id", "description", "filename", "md5sum", "exectype"}).
+		AddRow("1", "sql", "db/changelog/001_users.sql", "9:a1b2", "EXECUTED").
+		AddRow("2", nil, "db/changelog/002_orders.sql", nil, "FAILED")
+	mock.ExpectQuery(regexp.QuoteMeta("select id, description, filename, md5sum, exectype from public.DATABASECHANGELOG order by orderexecuted")).WillReturnRows(rows)
+
+	entries := connector.GetLegacyHistory(types.LegacyToolLiquibase, types.LegacyToolLiquibase.HistoryTable(), []string{"public"})
+
+	assert.Equal(t, []types.LegacyHistoryEntry{
+		{Schema: "public", Version: "1", Description: "sql", Script: "db/changelog/001_users.sql", CheckSum: "9:a1b2", Success: true},
+		{Schema: "public", Version: "2", Script: "db/changelog/002_orders.sql", Success: false},
+	}, entries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetLegacyHistoryGolangMigrate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery(regexp.QuoteMeta("lower(table_name) = lower('schema_migrations')")).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("select version, dirty from abc.schema_migrations")).WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(201602160003, true))
+
+	entries := connector.GetLegacyHistory(types.LegacyToolGolangMigrate, "schema_migrations", []string{"abc"})
+
+	assert.Equal(t, []types.LegacyHistoryEntry{{Schema: "abc", Version: "201602160003", Success: false}}, entries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
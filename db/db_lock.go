@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+)
+
+// lockPollInterval is how often migrator retries to acquire migration lock held by another migrator
+var lockPollInterval = time.Second
+
+// LockHeldError is returned when migration lock could not be acquired within lock timeout
+type LockHeldError struct {
+	Holder string
+	Since  time.Time
+}
+
+func (e *LockHeldError) since() string {
+	if e.Since.IsZero() {
+		return "unknown"
+	}
+	return e.Since.Format(time.RFC3339)
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("another migration is in progress (holder: %v, since: %v)", e.Holder, e.since())
+}
+
+// Extensions returns details of the lock which are added to GraphQL error
+func (e *LockHeldError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":   "MIGRATION_IN_PROGRESS",
+		"holder": e.Holder,
+		"since":  e.since(),
+	}
+}
+
+// lockHolder returns identifier of migrator process which holds migration lock
+func lockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%v:%v", hostname, os.Getpid())
+}
+
+// Lock acquires distributed migration lock which prevents migrator replicas from running migrations concurrently
+// lock is held by a dedicated DB session until returned unlock function is called
+// if lock is not acquired within lock timeout LockHeldError is returned
+func (bc *baseConnector) Lock() (func(), error) {
+	bc.initOrPanic()
+
+	conn, err := bc.db.Conn(bc.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not obtain DB connection for migration lock: %v", err)
+	}
+
+	deadline := time.Now().Add(bc.config.GetLockTimeout())
+	for {
+		var acquired int
+		if err := conn.QueryRowContext(bc.ctx, bc.dialect.GetLockSQL()).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not acquire migration lock: %v", err)
+		}
+		if acquired == 1 {
+			break
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			lockErr := bc.readLockHolder(conn)
+			conn.Close()
+			return nil, lockErr
+		}
+		if wait > lockPollInterval {
+			wait = lockPollInterval
+		}
+		select {
+		case <-bc.ctx.Done():
+			conn.Close()
+			return nil, bc.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	holder := lockHolder()
+	if _, err := conn.ExecContext(bc.ctx, bc.dialect.GetLockHolderDeleteSQL()); err != nil {
+		common.LogError(bc.ctx, "Could not remove previous holder of migration lock: %v", err)
+	}
+	if _, err := conn.ExecContext(bc.ctx, bc.dialect.GetLockHolderInsertSQL(), holder); err != nil {
+		common.LogError(bc.ctx, "Could not record holder of migration lock: %v", err)
+	}
+	common.LogInfo(bc.ctx, "Acquired migration lock, holder: %v", holder)
+
+	unlock := func() {
+		// lock must be released even when the request was cancelled
+		ctx := context.WithoutCancel(bc.ctx)
+		if _, err := conn.ExecContext(ctx, bc.dialect.GetLockHolderDeleteSQL()); err != nil {
+			common.LogError(bc.ctx, "Could not remove holder of migration lock: %v", err)
+		}
+		if _, err := conn.ExecContext(ctx, bc.dialect.GetUnlockSQL()); err != nil {
+			common.LogError(bc.ctx, "Could not release migration lock, closing DB session: %v", err)
+			// session-level lock is released when session ends, bad connection is closed instead of being returned to the pool
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+		common.LogInfo(bc.ctx, "Released migration lock, holder: %v", holder)
+	}
+
+	return unlock, nil
+}
+
+// readLockHolder returns LockHeldError with holder of migration lock and since when it is held
+func (bc *baseConnector) readLockHolder(conn *sql.Conn) error {
+	lockErr := &LockHeldError{Holder: "unknown"}
+	var (
+		holder string
+		since  time.Time
+	)
+	if err := conn.QueryRowContext(bc.ctx, bc.dialect.GetLockHolderSelectSQL()).Scan(&holder, &since); err != nil {
+		if err != sql.ErrNoRows {
+			common.LogError(bc.ctx, "Could not read holder of migration lock: %v", err)
+		}
+		return lockErr
+	}
+	lockErr.Holder = holder
+	lockErr.Since = since
+	return lockErr
+}
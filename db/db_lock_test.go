@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery(regexp.QuoteMeta("pg_try_advisory_lock(hashtext('migrator'))")).WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+	mock.ExpectExec("delete from migrator.migrator_locks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("insert into migrator.migrator_locks (holder) values ($1)")).WithArgs(lockHolder()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, err)
+
+	mock.ExpectExec("delete from migrator.migrator_locks").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("pg_advisory_unlock(hashtext('migrator'))")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	unlock()
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockHeldByAnotherMigrator(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.LockTimeout = 1
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	defaultLockPollInterval := lockPollInterval
+	lockPollInterval = 10 * time.Second
+	defer func() { lockPollInterval = defaultLockPollInterval }()
+
+	since := time.Date(2016, 02, 22, 16, 41, 1, 123, time.UTC)
+	// 1st attempt fails, migrator waits until lock timeout and tries again
+	mock.ExpectQuery("pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+	mock.ExpectQuery("pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+	mock.ExpectQuery("select holder, created from migrator.migrator_locks").WillReturnRows(sqlmock.NewRows([]string{"holder", "created"}).AddRow("migrator-1:42", since))
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, unlock)
+	assert.Equal(t, "another migration is in progress (holder: migrator-1:42, since: 2016-02-22T16:41:01Z)", err.Error())
+	assert.Equal(t, &LockHeldError{Holder: "migrator-1:42", Since: since}, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockCancelledWhileWaiting(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.LockTimeout = 60
+	dialect := newDialect(config)
+	ctx, cancel := context.WithCancel(newTestContext())
+	connector := baseConnector{ctx, config, dialect, db, true}
+
+	mock.ExpectQuery("pg_try_advisory_lock").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(0))
+
+	// request is cancelled while migrator waits for the lock
+	time.AfterFunc(50*time.Millisecond, cancel)
+	started := time.Now()
+	unlock, err := connector.Lock()
+	assert.Nil(t, unlock)
+	assert.Equal(t, context.Canceled, err)
+	assert.Less(t, time.Since(started), 10*time.Second)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	mock.ExpectQuery("get_lock").WillReturnError(errors.New("trouble maker"))
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, unlock)
+	assert.Equal(t, "could not acquire migration lock: trouble maker", err.Error())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLockHeldErrorUnknownHolder(t *testing.T) {
+	err := &LockHeldError{Holder: "unknown"}
+	assert.Equal(t, "another migration is in progress (holder: unknown, since: unknown)", err.Error())
+	assert.Equal(t, map[string]interface{}{"code": "MIGRATION_IN_PROGRESS", "holder": "unknown", "since": "unknown"}, err.Extensions())
+}
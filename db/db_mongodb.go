@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"strings"
 	"time"
@@ -88,6 +89,16 @@ func (mc *mongoDBConnector) createCollections() error {
 		return fmt.Errorf("failed to create migrations index: %v", err)
 	}
 
+	// Create locks collection, expired lock documents are removed by MongoDB
+	locksCol := mc.db.Collection(migratorLocksTable)
+	_, err = locksCol.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create locks index: %v", err)
+	}
+
 	return nil
 }
 
@@ -118,7 +129,7 @@ func (mc *mongoDBConnector) GetTenants() []types.Tenant {
 			continue
 		}
 		if name, ok := doc[fieldName].(string); ok {
-			tenants = append(tenants, types.Tenant{Name: name})
+			tenants = append(tenants, types.Tenant{Name: name, Metadata: mc.readTenantMetadata(doc)})
 		}
 	}
 
@@ -282,14 +293,17 @@ func (mc *mongoDBConnector) GetAppliedMigrations() []types.DBMigration {
 	return migrations
 }
 
-func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Action, migrations []types.Migration, tenantMigrations map[string][]types.Migration, dryRun bool) (*types.Summary, *types.Version) {
 	if err := mc.init(); err != nil {
 		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
 		return nil, nil
 	}
 
 	startTime := time.Now()
-	tenants := mc.GetTenants()
+	if tenantMigrations == nil {
+		tenantMigrations = allTenantsMigrations(mc.GetTenants(), migrations)
+	}
+	tenants, pendingInTenants := pendingTenantMigrations(tenantMigrations)
 
 	summary := &types.Summary{
 		StartedAt: graphql.Time{Time: startTime},
@@ -297,40 +311,34 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 	}
 
 	if dryRun {
-		mc.computeSummary(summary, migrations, tenants)
+		mc.computeSummary(summary, migrations, tenants, pendingInTenants)
 		summary.Duration = time.Since(startTime).Seconds()
 		return summary, nil
 	}
 
 	// Create version
-	versionsCol := mc.db.Collection(migratorVersionsTable)
-	versionID := mc.getNextSequence("version_id")
-	versionDoc := bson.M{
-		"_id":     versionID,
-		"name":    versionName,
-		"created": time.Now(),
-	}
-	_, err := versionsCol.InsertOne(mc.ctx, versionDoc)
+	version, err := mc.insertVersion(versionName)
 	if err != nil {
 		common.LogError(mc.ctx, "Failed to create version: %v", err)
 		return nil, nil
 	}
+	versionID := version.ID
 
-	version := &types.Version{
-		ID:      versionID,
-		Name:    versionName,
-		Created: graphql.Time{Time: time.Now()},
-	}
+	migrations, callbacks := splitCallbacks(migrations)
+	migrated := migratedTenants(tenants, pendingInTenants, migrations)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackBeforeVersion, nil)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackBeforeEachTenant, migrated)
 
 	// Apply migrations
 	for _, migration := range migrations {
-		if migration.MigrationType == types.MigrationTypeSingleMigration || migration.MigrationType == types.MigrationTypeSingleScript {
+		if !isTenantMigration(migration) {
 			// Use source directory as database name (consistent with SQL implementations)
 			dbName := migration.SourceDir
 			if action == types.ActionApply {
 				mc.executeMigration(migration, dbName)
 			}
 			mc.recordMigration(versionID, migration, dbName, version)
+			common.GetProgress(mc.ctx).AddApplied(1)
 			if migration.MigrationType == types.MigrationTypeSingleMigration {
 				summary.SingleMigrations++
 			} else {
@@ -338,10 +346,19 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 			}
 		} else {
 			for _, tenant := range tenants {
+				if !pendingInTenants[tenant][migration.File] {
+					continue
+				}
 				if action == types.ActionApply {
-					mc.executeMigration(migration, tenant.Name)
+					mc.executeMigration(migration, tenant)
+				}
+				mc.recordMigration(versionID, migration, tenant, version)
+				common.GetProgress(mc.ctx).AddApplied(1)
+				if migration.MigrationType == types.MigrationTypeTenantMigration {
+					summary.TenantMigrationsTotal++
+				} else {
+					summary.TenantScriptsTotal++
 				}
-				mc.recordMigration(versionID, migration, tenant.Name, version)
 			}
 			if migration.MigrationType == types.MigrationTypeTenantMigration {
 				summary.TenantMigrations++
@@ -351,8 +368,10 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 		}
 	}
 
-	summary.TenantMigrationsTotal = summary.TenantMigrations * summary.Tenants
-	summary.TenantScriptsTotal = summary.TenantScripts * summary.Tenants
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackAfterEachTenant, migrated)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackAfterCreateTenant, tenants)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackAfterVersion, nil)
+
 	summary.MigrationsGrandTotal = summary.SingleMigrations + summary.TenantMigrationsTotal
 	summary.ScriptsGrandTotal = summary.SingleScripts + summary.TenantScriptsTotal
 	summary.Duration = time.Since(startTime).Seconds()
@@ -361,7 +380,7 @@ func (mc *mongoDBConnector) CreateVersion(versionName string, action types.Actio
 	return summary, version
 }
 
-func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
+func (mc *mongoDBConnector) CreateTenant(tenant types.Tenant, versionName string, action types.Action, migrations []types.Migration, dryRun bool) (*types.Summary, *types.Version) {
 	if err := mc.init(); err != nil {
 		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
 		return nil, nil
@@ -378,7 +397,7 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 		for _, migration := range migrations {
 			if migration.MigrationType == types.MigrationTypeTenantMigration {
 				summary.TenantMigrations++
-			} else if migration.MigrationType == types.MigrationTypeTenantScript {
+			} else if migration.MigrationType == types.MigrationTypeTenantScript || migration.MigrationType == types.MigrationTypeTenantRepeatable {
 				summary.TenantScripts++
 			}
 		}
@@ -394,7 +413,11 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 	collectionName := mc.getTenantCollectionName()
 	fieldName := mc.getTenantFieldName()
 	tenantsCol := mc.db.Collection(collectionName)
+	tenantName := tenant.Name
 	tenantDoc := bson.M{fieldName: tenantName, "created": time.Now()}
+	if len(tenant.Metadata) > 0 {
+		tenantDoc[tenantMetadataColumn] = map[string]string(tenant.Metadata)
+	}
 	_, err := tenantsCol.InsertOne(mc.ctx, tenantDoc)
 	if err != nil {
 		common.LogError(mc.ctx, "Failed to create tenant: %v", err)
@@ -402,28 +425,21 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 	}
 
 	// Create version
-	versionsCol := mc.db.Collection(migratorVersionsTable)
-	versionID := mc.getNextSequence("version_id")
-	versionDoc := bson.M{
-		"_id":     versionID,
-		"name":    versionName,
-		"created": time.Now(),
-	}
-	_, err = versionsCol.InsertOne(mc.ctx, versionDoc)
+	version, err := mc.insertVersion(versionName)
 	if err != nil {
 		common.LogError(mc.ctx, "Failed to create version: %v", err)
 		return nil, nil
 	}
+	versionID := version.ID
 
-	version := &types.Version{
-		ID:      versionID,
-		Name:    versionName,
-		Created: graphql.Time{Time: time.Now()},
-	}
+	migrations, callbacks := splitCallbacks(migrations)
+	tenants, pendingInTenants := pendingTenantMigrations(map[string][]types.Migration{tenantName: migrations})
+	migrated := migratedTenants(tenants, pendingInTenants, migrations)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackBeforeEachTenant, migrated)
 
 	// Apply tenant migrations
 	for _, migration := range migrations {
-		if migration.MigrationType == types.MigrationTypeTenantMigration || migration.MigrationType == types.MigrationTypeTenantScript {
+		if isTenantMigration(migration) {
 			if action == types.ActionApply {
 				mc.executeMigration(migration, tenantName)
 			}
@@ -436,6 +452,9 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 		}
 	}
 
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackAfterEachTenant, migrated)
+	mc.applyCallbacks(versionID, version, action, callbacks, types.CallbackAfterCreateTenant, tenants)
+
 	summary.TenantMigrationsTotal = summary.TenantMigrations
 	summary.TenantScriptsTotal = summary.TenantScripts
 	summary.MigrationsGrandTotal = summary.TenantMigrationsTotal
@@ -446,6 +465,493 @@ func (mc *mongoDBConnector) CreateTenant(tenantName string, versionName string,
 	return summary, version
 }
 
+func (mc *mongoDBConnector) DeleteTenant(tenantName string, versionName string, mode types.DeleteTenantMode, dryRun bool) (*types.Summary, *types.Version) {
+	if err := mc.init(); err != nil {
+		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
+		return nil, nil
+	}
+
+	startTime := time.Now()
+
+	summary := &types.Summary{
+		StartedAt:      graphql.Time{Time: startTime},
+		TenantsDeleted: 1,
+	}
+
+	if dryRun {
+		summary.Duration = time.Since(startTime).Seconds()
+		return summary, nil
+	}
+
+	// executed operations are recorded in tenant deletion entry
+	var operations []string
+
+	// Archive or drop tenant database
+	tenantDB := mc.client.Database(tenantName)
+	switch mode {
+	case types.DeleteTenantModeArchive:
+		archivedDB := fmt.Sprintf("%v_archived_%v", tenantName, startTime.UTC().Format("20060102150405"))
+		collections, err := tenantDB.ListCollectionNames(mc.ctx, bson.M{})
+		if err != nil {
+			common.LogError(mc.ctx, "Failed to list tenant collections: %v", err)
+			return nil, nil
+		}
+		for _, collection := range collections {
+			from := fmt.Sprintf("%v.%v", tenantName, collection)
+			to := fmt.Sprintf("%v.%v", archivedDB, collection)
+			command := bson.D{{Key: "renameCollection", Value: from}, {Key: "to", Value: to}}
+			if err := mc.client.Database("admin").RunCommand(mc.ctx, command).Err(); err != nil {
+				common.LogError(mc.ctx, "Failed to archive tenant collection %v: %v", from, err)
+				return nil, nil
+			}
+			operations = append(operations, fmt.Sprintf("renameCollection %v to %v", from, to))
+		}
+	case types.DeleteTenantModeDrop:
+		if err := tenantDB.Drop(mc.ctx); err != nil {
+			common.LogError(mc.ctx, "Failed to drop tenant database: %v", err)
+			return nil, nil
+		}
+		operations = append(operations, fmt.Sprintf("dropDatabase %v", tenantName))
+	}
+
+	// Remove tenant
+	collectionName := mc.getTenantCollectionName()
+	fieldName := mc.getTenantFieldName()
+	tenantsCol := mc.db.Collection(collectionName)
+	if _, err := tenantsCol.DeleteOne(mc.ctx, bson.M{fieldName: tenantName}); err != nil {
+		common.LogError(mc.ctx, "Failed to remove tenant: %v", err)
+		return nil, nil
+	}
+	operations = append(operations, fmt.Sprintf("deleteOne %v from %v", tenantName, collectionName))
+
+	// Create version
+	version, err := mc.insertVersion(versionName)
+	if err != nil {
+		common.LogError(mc.ctx, "Failed to create version: %v", err)
+		return nil, nil
+	}
+
+	deletion := types.Migration{Name: mode.String(), MigrationType: types.MigrationTypeTenantDeletion, Contents: strings.Join(operations, "\n")}
+	mc.recordMigration(version.ID, deletion, tenantName, version)
+
+	summary.Duration = time.Since(startTime).Seconds()
+	summary.VersionID = version.ID
+
+	return summary, version
+}
+
+func (mc *mongoDBConnector) RollbackVersion(versionName string, migrations []types.DBMigration, dryRun bool) (*types.Summary, *types.Version) {
+	if err := mc.init(); err != nil {
+		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
+		return nil, nil
+	}
+
+	startTime := time.Now()
+
+	summary := &types.Summary{
+		StartedAt: graphql.Time{Time: startTime},
+	}
+
+	tenants := map[string]bool{}
+	for _, m := range migrations {
+		if m.MigrationType == types.MigrationTypeTenantMigration {
+			tenants[m.Schema] = true
+		}
+	}
+	summary.Tenants = int32(len(tenants))
+	summary.MigrationsRolledBack = int32(len(migrations))
+
+	if dryRun {
+		summary.Duration = time.Since(startTime).Seconds()
+		return summary, nil
+	}
+
+	// Create version
+	version, err := mc.insertVersion(versionName)
+	if err != nil {
+		common.LogError(mc.ctx, "Failed to create version: %v", err)
+		return nil, nil
+	}
+
+	// Apply down migrations and record them as rollback entries
+	for _, m := range migrations {
+		rollback := m.Migration
+		rollback.MigrationType = types.MigrationTypeRollback
+		rollback.Contents = m.DownContents
+		rollback.DownContents = ""
+		mc.executeMigration(rollback, m.Schema)
+		mc.recordMigration(version.ID, rollback, m.Schema, version)
+	}
+
+	summary.Duration = time.Since(startTime).Seconds()
+	summary.VersionID = version.ID
+
+	return summary, version
+}
+
+func (mc *mongoDBConnector) RepairMigrations(versionName string, mismatches []types.CheckSumMismatch, dryRun bool) (*types.Summary, *types.Version) {
+	if err := mc.init(); err != nil {
+		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
+		return nil, nil
+	}
+
+	startTime := time.Now()
+
+	summary := &types.Summary{
+		StartedAt:          graphql.Time{Time: startTime},
+		MigrationsRepaired: int32(len(mismatches)),
+	}
+
+	if dryRun {
+		summary.Duration = time.Since(startTime).Seconds()
+		return summary, nil
+	}
+
+	// Create version
+	version, err := mc.insertVersion(versionName)
+	if err != nil {
+		common.LogError(mc.ctx, "Failed to create version: %v", err)
+		return nil, nil
+	}
+
+	// Update applied migrations and record repair entries storing replaced contents and checksum
+	col := mc.db.Collection(migratorMigrationsTable)
+	for _, m := range mismatches {
+		filter := bson.M{
+			"filename": m.SourceMigration.File,
+			"type":     bson.M{"$in": []int{int(types.MigrationTypeSingleMigration), int(types.MigrationTypeTenantMigration)}},
+		}
+		update := bson.M{"$set": bson.M{"contents": m.SourceMigration.Contents, "checksum": m.SourceMigration.CheckSum}}
+		if _, err := col.UpdateMany(mc.ctx, filter, update); err != nil {
+			common.LogError(mc.ctx, "Failed to repair migration %v: %v", m.SourceMigration.File, err)
+			continue
+		}
+		repair := m.SourceMigration
+		repair.MigrationType = types.MigrationTypeRepair
+		repair.Contents = m.AppliedContents
+		repair.CheckSum = m.AppliedCheckSum
+		repair.DownContents = ""
+		mc.recordMigration(version.ID, repair, migratorSchema, version)
+	}
+
+	summary.Duration = time.Since(startTime).Seconds()
+	summary.VersionID = version.ID
+
+	return summary, version
+}
+
+// GetLegacyHistory reads history collection of legacy migration tool from passed databases, databases without the collection are skipped
+func (mc *mongoDBConnector) GetLegacyHistory(tool types.LegacyTool, table string, schemas []string) []types.LegacyHistoryEntry {
+	if err := mc.init(); err != nil {
+		common.LogError(mc.ctx, "Failed to initialize MongoDB: %v", err)
+		return []types.LegacyHistoryEntry{}
+	}
+
+	// field by which history entries are sorted
+	sortField := map[types.LegacyTool]string{
+		types.LegacyToolFlyway:        "installed_rank",
+		types.LegacyToolLiquibase:     "orderExecuted",
+		types.LegacyToolGolangMigrate: "version",
+	}[tool]
+
+	entries := []types.LegacyHistoryEntry{}
+	for _, schema := range schemas {
+		targetDB := mc.client.Database(schema)
+		names, err := targetDB.ListCollectionNames(mc.ctx, bson.M{"name": table})
+		if err != nil {
+			common.LogError(mc.ctx, "Failed to check if %v history collection exists in %v: %v", tool, schema, err)
+			continue
+		}
+		if len(names) == 0 {
+			common.LogInfo(mc.ctx, "%v history collection %v not found in %v, skipping", tool, table, schema)
+			continue
+		}
+
+		cursor, err := targetDB.Collection(table).Find(mc.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: sortField, Value: 1}}))
+		if err != nil {
+			common.LogError(mc.ctx, "Failed to get %v history in %v: %v", tool, schema, err)
+			continue
+		}
+		for cursor.Next(mc.ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				continue
+			}
+			entries = append(entries, mc.docToLegacyHistoryEntry(tool, schema, doc))
+		}
+		cursor.Close(mc.ctx)
+	}
+
+	return entries
+}
+
+// docToLegacyHistoryEntry converts document of Flyway, Liquibase (liquibase-mongodb), or golang-migrate history collection
+func (mc *mongoDBConnector) docToLegacyHistoryEntry(tool types.LegacyTool, schema string, doc bson.M) types.LegacyHistoryEntry {
+	str := func(key string) string {
+		if v, ok := doc[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	boolean := func(key string) bool {
+		b, _ := doc[key].(bool)
+		return b
+	}
+
+	entry := types.LegacyHistoryEntry{Schema: schema}
+	switch tool {
+	case types.LegacyToolLiquibase:
+		entry.Version = str("id")
+		entry.Description = str("description")
+		entry.Script = str("fileName")
+		entry.CheckSum = str("md5sum")
+		entry.Success = liquibaseSucceeded(str("execType"))
+	case types.LegacyToolGolangMigrate:
+		entry.Version = str("version")
+		entry.Success = !boolean("dirty")
+	default:
+		entry.Version = str("version")
+		entry.Description = str("description")
+		entry.Script = str("script")
+		entry.CheckSum = str("checksum")
+		entry.Success = boolean("success")
+	}
+	return entry
+}
+
+// Lock acquires distributed migration lock by inserting lock document which expires after lock TTL
+// the lock document is refreshed until returned unlock function is called, expired lock document can be taken over
+// if lock is not acquired within lock timeout LockHeldError is returned
+func (mc *mongoDBConnector) Lock() (func(), error) {
+	if err := mc.init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize MongoDB: %v", err)
+	}
+
+	col := mc.db.Collection(migratorLocksTable)
+	holder := lockHolder()
+	ttl := mc.config.GetLockTTL()
+
+	deadline := time.Now().Add(mc.config.GetLockTimeout())
+	for {
+		acquired, err := mc.tryLock(col, holder, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("could not acquire migration lock: %v", err)
+		}
+		if acquired {
+			break
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, mc.readLockHolder(col)
+		}
+		if wait > lockPollInterval {
+			wait = lockPollInterval
+		}
+		select {
+		case <-mc.ctx.Done():
+			return nil, mc.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	common.LogInfo(mc.ctx, "Acquired migration lock, holder: %v", holder)
+
+	// refresh lock document so that it doesn't expire while migrations are running
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				filter := bson.M{"_id": migrationLockName, "holder": holder}
+				update := bson.M{"$set": bson.M{"expiresAt": time.Now().Add(ttl)}}
+				if _, err := col.UpdateOne(mc.ctx, filter, update); err != nil {
+					common.LogError(mc.ctx, "Could not refresh migration lock: %v", err)
+				}
+			}
+		}
+	}()
+
+	unlock := func() {
+		close(done)
+		if _, err := col.DeleteOne(context.WithoutCancel(mc.ctx), bson.M{"_id": migrationLockName, "holder": holder}); err != nil {
+			common.LogError(mc.ctx, "Could not release migration lock: %v", err)
+		}
+		common.LogInfo(mc.ctx, "Released migration lock, holder: %v", holder)
+	}
+
+	return unlock, nil
+}
+
+// tryLock inserts lock document or takes over expired one, returns true when lock was acquired
+func (mc *mongoDBConnector) tryLock(col *mongo.Collection, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	lock := bson.M{"holder": holder, "since": now, "expiresAt": now.Add(ttl)}
+
+	filter := bson.M{"_id": migrationLockName, "expiresAt": bson.M{"$lt": now}}
+	_, err := col.UpdateOne(mc.ctx, filter, bson.M{"$set": lock}, options.Update().SetUpsert(true))
+	if err == nil {
+		return true, nil
+	}
+	// lock document which has not expired yet exists, upsert fails with duplicate key error
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// readLockHolder returns LockHeldError with holder of migration lock and since when it is held
+func (mc *mongoDBConnector) readLockHolder(col *mongo.Collection) error {
+	lockErr := &LockHeldError{Holder: "unknown"}
+	var doc bson.M
+	if err := col.FindOne(mc.ctx, bson.M{"_id": migrationLockName}).Decode(&doc); err != nil {
+		return lockErr
+	}
+	if holder, ok := doc["holder"].(string); ok {
+		lockErr.Holder = holder
+	}
+	lockErr.Since = mc.convertToTime(doc["since"])
+	return lockErr
+}
+
+// CreateJob creates new queued asynchronous job which creates version with passed name
+func (mc *mongoDBConnector) CreateJob(versionName string) *types.Job {
+	if err := mc.init(); err != nil {
+		panic(fmt.Sprintf("Failed to initialize MongoDB: %v", err))
+	}
+
+	created := time.Now()
+	jobID := mc.getNextSequence("job_id")
+	doc := bson.M{
+		"_id":                jobID,
+		"state":              int(types.JobStateQueued),
+		"version_name":       versionName,
+		"created":            created,
+		"updated":            created,
+		"migrations_total":   0,
+		"migrations_applied": 0,
+	}
+	if _, err := mc.db.Collection(migratorJobsTable).InsertOne(mc.ctx, doc); err != nil {
+		panic(fmt.Sprintf("Could not create job: %v", err))
+	}
+
+	return &types.Job{ID: jobID, State: types.JobStateQueued, VersionName: versionName, Created: graphql.Time{Time: created}, Updated: graphql.Time{Time: created}}
+}
+
+// UpdateJob stores state, progress, and results of passed job
+func (mc *mongoDBConnector) UpdateJob(job *types.Job) error {
+	if err := mc.init(); err != nil {
+		return err
+	}
+
+	versionID, summary, jobError, err := encodeJobResults(job)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"state":              int(job.State),
+		"updated":            time.Now(),
+		"migrations_total":   job.MigrationsTotal,
+		"migrations_applied": job.MigrationsApplied,
+		"version_id":         nil,
+		"summary":            nil,
+		"error":              nil,
+	}
+	if versionID.Valid {
+		update["version_id"] = versionID.Int32
+	}
+	if summary.Valid {
+		update["summary"] = summary.String
+	}
+	if jobError.Valid {
+		update["error"] = jobError.String
+	}
+	if _, err := mc.db.Collection(migratorJobsTable).UpdateOne(jobContext(mc.ctx), bson.M{"_id": job.ID}, bson.M{"$set": update}); err != nil {
+		return fmt.Errorf("could not update job: %v", err)
+	}
+
+	return nil
+}
+
+// GetJobByID returns job together with its results
+func (mc *mongoDBConnector) GetJobByID(ID int32) (*types.Job, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	if err := mc.db.Collection(migratorJobsTable).FindOne(jobContext(mc.ctx), bson.M{"_id": ID}).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("job not found ID: %v", ID)
+	}
+
+	job := &types.Job{
+		ID:                doc["_id"].(int32),
+		State:             types.JobState(doc["state"].(int32)),
+		VersionName:       doc["version_name"].(string),
+		Created:           graphql.Time{Time: mc.convertToTime(doc["created"])},
+		Updated:           graphql.Time{Time: mc.convertToTime(doc["updated"])},
+		MigrationsTotal:   doc["migrations_total"].(int32),
+		MigrationsApplied: doc["migrations_applied"].(int32),
+	}
+	if cancelRequested, ok := doc["cancel_requested"].(bool); ok {
+		job.CancelRequested = cancelRequested
+	}
+
+	summary, hasSummary := doc["summary"].(string)
+	jobError, hasError := doc["error"].(string)
+	if err := decodeJobResults(job, sql.NullString{String: summary, Valid: hasSummary}, sql.NullString{String: jobError, Valid: hasError}); err != nil {
+		return nil, err
+	}
+	if versionID, ok := doc["version_id"].(int32); ok && job.Results != nil {
+		job.Results.Version, _ = mc.GetVersionByID(versionID)
+	}
+
+	return job, nil
+}
+
+// CancelJob requests cancellation of queued or running job, the job is cancelled by the migrator which runs it
+func (mc *mongoDBConnector) CancelJob(ID int32) (*types.Job, error) {
+	if err := mc.init(); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"_id": ID, "state": bson.M{"$in": []int{int(types.JobStateQueued), int(types.JobStateRunning)}}}
+	update := bson.M{"$set": bson.M{"cancel_requested": true, "updated": time.Now()}}
+	result, err := mc.db.Collection(migratorJobsTable).UpdateOne(mc.ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("could not cancel job: %v", err)
+	}
+
+	job, err := mc.GetJobByID(ID)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("job %v already finished with state: %v", ID, job.State)
+	}
+
+	return job, nil
+}
+
+// FailStaleJobs marks queued and running jobs which were not updated for longer than staleAfter as failed with passed error
+func (mc *mongoDBConnector) FailStaleJobs(staleAfter time.Duration, failure string) error {
+	if err := mc.init(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	filter := bson.M{"state": bson.M{"$in": []int{int(types.JobStateQueued), int(types.JobStateRunning)}}, "updated": bson.M{"$lt": now.Add(-staleAfter)}}
+	update := bson.M{"$set": bson.M{"state": int(types.JobStateFailed), "error": failure, "updated": now}}
+	if _, err := mc.db.Collection(migratorJobsTable).UpdateMany(jobContext(mc.ctx), filter, update); err != nil {
+		return fmt.Errorf("could not fail stale jobs: %v", err)
+	}
+
+	return nil
+}
+
 func (mc *mongoDBConnector) HealthCheck() error {
 	if mc.client == nil {
 		return mc.init()
@@ -455,7 +961,7 @@ func (mc *mongoDBConnector) HealthCheck() error {
 
 func (mc *mongoDBConnector) Dispose() {
 	if mc.client != nil {
-		mc.client.Disconnect(mc.ctx)
+		mc.client.Disconnect(context.WithoutCancel(mc.ctx))
 	}
 }
 
@@ -477,6 +983,21 @@ func (mc *mongoDBConnector) getTenantCollectionName() string {
 	return migratorTenantsTable
 }
 
+// readTenantMetadata reads tenant metadata stored in metadata subdocument, values which are not strings are converted to strings
+func (mc *mongoDBConnector) readTenantMetadata(doc bson.M) types.TenantMetadata {
+	metadata := types.TenantMetadata{}
+	if m, ok := doc[tenantMetadataColumn].(bson.M); ok {
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				metadata[k] = s
+			} else {
+				metadata[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	return metadata
+}
+
 func (mc *mongoDBConnector) getTenantFieldName() string {
 	// Check if custom tenant select is configured
 	// Format: "collection_name" or "collection_name.field_name"
@@ -501,15 +1022,47 @@ func (mc *mongoDBConnector) convertToTime(v interface{}) time.Time {
 	}
 }
 
+// applyCallbacks executes callbacks of passed event and records them in the version
+// version callbacks are executed in the database named after their source dir, tenant callbacks in passed tenants
+func (mc *mongoDBConnector) applyCallbacks(versionID int32, version *types.Version, action types.Action, callbacks []types.Migration, event types.CallbackEvent, tenants []string) {
+	for _, callback := range callbacks {
+		if callback.CallbackEvent() != event {
+			continue
+		}
+		dbNames := []string{callback.SourceDir}
+		if event.IsTenant() {
+			dbNames = tenants
+		}
+		for _, dbName := range dbNames {
+			if action == types.ActionApply {
+				mc.executeMigration(callback, dbName)
+			}
+			mc.recordMigration(versionID, callback, dbName, version)
+		}
+	}
+}
+
 func (mc *mongoDBConnector) executeMigration(migration types.Migration, dbName string) {
 	targetDB := mc.client.Database(dbName)
 
-	// Replace schema placeholder
+	// MongoDB has no session level statement timeout, the timeout is applied to the context of commands
+	ctx := mc.ctx
+	if timeout := migrationTimeout(migration, mc.config); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(mc.ctx, timeout)
+		defer cancel()
+	}
+
+	// Render template and replace schema placeholder
 	schemaPlaceHolder := mc.config.SchemaPlaceHolder
 	if schemaPlaceHolder == "" {
 		schemaPlaceHolder = defaultSchemaPlaceHolder
 	}
-	contents := strings.ReplaceAll(migration.Contents, schemaPlaceHolder, dbName)
+	var metadata types.TenantMetadata
+	if usesTenantMetadata(mc.config, migration, migration.Contents) {
+		metadata = tenantsMetadata(mc.GetTenants())[dbName]
+	}
+	contents := strings.ReplaceAll(renderMigration(mc.config, migration, migration.Contents, dbName, metadata), schemaPlaceHolder, dbName)
 
 	// Parse and execute JavaScript-like MongoDB commands
 	// This handles common patterns like db.collection.insertOne(), db.collection.createIndex(), etc.
@@ -520,14 +1073,14 @@ func (mc *mongoDBConnector) executeMigration(migration types.Migration, dbName s
 			continue
 		}
 
-		if err := mc.executeMongoDBCommand(targetDB, line); err != nil {
+		if err := mc.executeMongoDBCommand(ctx, targetDB, line); err != nil {
 			common.LogError(mc.ctx, "Failed to execute command in migration %s (database %s): %v", migration.File, dbName, err)
 		}
 	}
 }
 
 // executeMongoDBCommand parses and executes a MongoDB command
-func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, command string) error {
+func (mc *mongoDBConnector) executeMongoDBCommand(ctx context.Context, targetDB *mongo.Database, command string) error {
 	command = strings.TrimSpace(command)
 
 	// Match pattern: db.collectionName.operation(...) or db.getSiblingDB('dbname').collectionName.operation(...)
@@ -586,13 +1139,13 @@ func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, comm
 	// Handle different operations
 	switch operation {
 	case "insertOne":
-		return mc.handleInsertOne(col, rest[opEnd:])
+		return mc.handleInsertOne(ctx, col, rest[opEnd:])
 	case "createIndex":
-		return mc.handleCreateIndex(col, rest[opEnd:])
+		return mc.handleCreateIndex(ctx, col, rest[opEnd:])
 	case "updateMany":
-		return mc.handleUpdateMany(col, rest[opEnd:])
+		return mc.handleUpdateMany(ctx, col, rest[opEnd:])
 	case "updateOne":
-		return mc.handleUpdateOne(col, rest[opEnd:])
+		return mc.handleUpdateOne(ctx, col, rest[opEnd:])
 	default:
 		common.LogWarn(mc.ctx, "Unsupported operation: %s", operation)
 		return nil
@@ -600,7 +1153,7 @@ func (mc *mongoDBConnector) executeMongoDBCommand(targetDB *mongo.Database, comm
 }
 
 // handleInsertOne executes insertOne operation
-func (mc *mongoDBConnector) handleInsertOne(col *mongo.Collection, args string) error {
+func (mc *mongoDBConnector) handleInsertOne(ctx context.Context, col *mongo.Collection, args string) error {
 	// Extract JSON document from insertOne({...})
 	start := strings.Index(args, "{")
 	end := strings.LastIndex(args, "}")
@@ -619,12 +1172,12 @@ func (mc *mongoDBConnector) handleInsertOne(col *mongo.Collection, args string)
 		return fmt.Errorf("failed to parse document: %v", err)
 	}
 
-	_, err := col.InsertOne(mc.ctx, doc)
+	_, err := col.InsertOne(ctx, doc)
 	return err
 }
 
 // handleCreateIndex executes createIndex operation
-func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string) error {
+func (mc *mongoDBConnector) handleCreateIndex(ctx context.Context, col *mongo.Collection, args string) error {
 	// Extract index spec and options from createIndex({...}, {...})
 	start := strings.Index(args, "{")
 	if start == -1 {
@@ -680,7 +1233,7 @@ func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string
 		}
 	}
 
-	_, err := col.Indexes().CreateOne(mc.ctx, mongo.IndexModel{
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    keys,
 		Options: opts,
 	})
@@ -688,17 +1241,17 @@ func (mc *mongoDBConnector) handleCreateIndex(col *mongo.Collection, args string
 }
 
 // handleUpdateMany executes updateMany operation
-func (mc *mongoDBConnector) handleUpdateMany(col *mongo.Collection, args string) error {
-	return mc.handleUpdate(col, args, true)
+func (mc *mongoDBConnector) handleUpdateMany(ctx context.Context, col *mongo.Collection, args string) error {
+	return mc.handleUpdate(ctx, col, args, true)
 }
 
 // handleUpdateOne executes updateOne operation
-func (mc *mongoDBConnector) handleUpdateOne(col *mongo.Collection, args string) error {
-	return mc.handleUpdate(col, args, false)
+func (mc *mongoDBConnector) handleUpdateOne(ctx context.Context, col *mongo.Collection, args string) error {
+	return mc.handleUpdate(ctx, col, args, false)
 }
 
 // handleUpdate executes update operations (updateOne or updateMany)
-func (mc *mongoDBConnector) handleUpdate(col *mongo.Collection, args string, many bool) error {
+func (mc *mongoDBConnector) handleUpdate(ctx context.Context, col *mongo.Collection, args string, many bool) error {
 	// Extract filter and update documents from updateMany({filter}, {update}, {options})
 	start := strings.Index(args, "{")
 	if start == -1 {
@@ -778,10 +1331,10 @@ func (mc *mongoDBConnector) handleUpdate(col *mongo.Collection, args string, man
 
 	// Execute update
 	if many {
-		_, err := col.UpdateMany(mc.ctx, filter, update)
+		_, err := col.UpdateMany(ctx, filter, update)
 		return err
 	}
-	_, err := col.UpdateOne(mc.ctx, filter, update)
+	_, err := col.UpdateOne(ctx, filter, update)
 	return err
 }
 
@@ -847,21 +1400,43 @@ func (mc *mongoDBConnector) jsToJSON(js string) string {
 	return builder.String()
 }
 
+// insertVersion creates new version document
+func (mc *mongoDBConnector) insertVersion(versionName string) (*types.Version, error) {
+	versionsCol := mc.db.Collection(migratorVersionsTable)
+	versionID := mc.getNextSequence("version_id")
+	versionDoc := bson.M{
+		"_id":     versionID,
+		"name":    versionName,
+		"created": time.Now(),
+	}
+	if _, err := versionsCol.InsertOne(mc.ctx, versionDoc); err != nil {
+		return nil, err
+	}
+
+	version := &types.Version{
+		ID:      versionID,
+		Name:    versionName,
+		Created: graphql.Time{Time: time.Now()},
+	}
+	return version, nil
+}
+
 func (mc *mongoDBConnector) recordMigration(versionID int32, migration types.Migration, schema string, version *types.Version) {
 	col := mc.db.Collection(migratorMigrationsTable)
 	migrationID := mc.getNextSequence("migration_id")
 
 	doc := bson.M{
-		"_id":        migrationID,
-		"name":       migration.Name,
-		"source_dir": migration.SourceDir,
-		"filename":   migration.File,
-		"type":       int(migration.MigrationType),
-		"db_schema":  schema,
-		"created":    time.Now(),
-		"contents":   migration.Contents,
-		"checksum":   migration.CheckSum,
-		"version_id": versionID,
+		"_id":           migrationID,
+		"name":          migration.Name,
+		"source_dir":    migration.SourceDir,
+		"filename":      migration.File,
+		"type":          int(migration.MigrationType),
+		"db_schema":     schema,
+		"created":       time.Now(),
+		"contents":      migration.Contents,
+		"checksum":      migration.CheckSum,
+		"down_contents": migration.DownContents,
+		"version_id":    versionID,
 	}
 
 	_, err := col.InsertOne(mc.ctx, doc)
@@ -895,6 +1470,8 @@ func (mc *mongoDBConnector) getNextSequence(name string) int32 {
 }
 
 func (mc *mongoDBConnector) docToDBMigration(doc bson.M) types.DBMigration {
+	// down_contents is not present in migrations recorded by older versions of migrator
+	downContents, _ := doc["down_contents"].(string)
 	return types.DBMigration{
 		Migration: types.Migration{
 			Name:          doc["name"].(string),
@@ -903,6 +1480,7 @@ func (mc *mongoDBConnector) docToDBMigration(doc bson.M) types.DBMigration {
 			MigrationType: types.MigrationType(doc["type"].(int32)),
 			Contents:      doc["contents"].(string),
 			CheckSum:      doc["checksum"].(string),
+			DownContents:  downContents,
 		},
 		ID:      doc["_id"].(int32),
 		Schema:  doc["db_schema"].(string),
@@ -910,21 +1488,27 @@ func (mc *mongoDBConnector) docToDBMigration(doc bson.M) types.DBMigration {
 	}
 }
 
-func (mc *mongoDBConnector) computeSummary(summary *types.Summary, migrations []types.Migration, tenants []types.Tenant) {
+func (mc *mongoDBConnector) computeSummary(summary *types.Summary, migrations []types.Migration, tenants []string, pendingInTenants map[string]map[string]bool) {
 	for _, migration := range migrations {
+		var schemas int32
+		for _, tenant := range tenants {
+			if pendingInTenants[tenant][migration.File] {
+				schemas++
+			}
+		}
 		switch migration.MigrationType {
 		case types.MigrationTypeSingleMigration:
 			summary.SingleMigrations++
-		case types.MigrationTypeSingleScript:
+		case types.MigrationTypeSingleScript, types.MigrationTypeSingleRepeatable:
 			summary.SingleScripts++
 		case types.MigrationTypeTenantMigration:
 			summary.TenantMigrations++
-		case types.MigrationTypeTenantScript:
+			summary.TenantMigrationsTotal += schemas
+		case types.MigrationTypeTenantScript, types.MigrationTypeTenantRepeatable:
 			summary.TenantScripts++
+			summary.TenantScriptsTotal += schemas
 		}
 	}
-	summary.TenantMigrationsTotal = summary.TenantMigrations * int32(len(tenants))
-	summary.TenantScriptsTotal = summary.TenantScripts * int32(len(tenants))
 	summary.MigrationsGrandTotal = summary.SingleMigrations + summary.TenantMigrationsTotal
 	summary.ScriptsGrandTotal = summary.SingleScripts + summary.TenantScriptsTotal
 }
@@ -19,9 +19,9 @@ func TestMongoDBGetTenants(t *testing.T) {
 	defer connector.Dispose()
 
 	// Create test tenants
-	connector.CreateTenant("abc", "test-tenant-abc", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("def", "test-tenant-def", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("xyz", "test-tenant-xyz", types.ActionSync, []types.Migration{}, false)
+	connector.CreateTenant(types.Tenant{Name: "abc"}, "test-tenant-abc", types.ActionSync, []types.Migration{}, false)
+	connector.CreateTenant(types.Tenant{Name: "def"}, "test-tenant-def", types.ActionSync, []types.Migration{}, false)
+	connector.CreateTenant(types.Tenant{Name: "xyz"}, "test-tenant-xyz", types.ActionSync, []types.Migration{}, false)
 
 	tenants := connector.GetTenants()
 
@@ -40,8 +40,8 @@ func TestMongoDBCreateVersion(t *testing.T) {
 	defer connector.Dispose()
 
 	// Create test tenants
-	connector.CreateTenant("tenant1", "test-tenant-1", types.ActionSync, []types.Migration{}, false)
-	connector.CreateTenant("tenant2", "test-tenant-2", types.ActionSync, []types.Migration{}, false)
+	connector.CreateTenant(types.Tenant{Name: "tenant1"}, "test-tenant-1", types.ActionSync, []types.Migration{}, false)
+	connector.CreateTenant(types.Tenant{Name: "tenant2"}, "test-tenant-2", types.ActionSync, []types.Migration{}, false)
 
 	tenants := connector.GetTenants()
 	noOfTenants := len(tenants)
@@ -68,7 +68,7 @@ func TestMongoDBCreateVersion(t *testing.T) {
 
 	migrationsToApply := []types.Migration{ref1, ref2, config1, tenant1, tenant2}
 
-	results, version := connector.CreateVersion("commit-sha-mongo", types.ActionApply, migrationsToApply, false)
+	results, version := connector.CreateVersion("commit-sha-mongo", types.ActionApply, migrationsToApply, nil, false)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
@@ -98,7 +98,7 @@ func TestMongoDBScripts(t *testing.T) {
 	testTenant := fmt.Sprintf("scripttenant%d", time.Now().UnixNano())
 	m1 := time.Now().UnixNano()
 	tenantMigration := types.Migration{Name: fmt.Sprintf("%v.js", m1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.js", m1), MigrationType: types.MigrationTypeTenantMigration, Contents: "db.settings.insertOne({k: 999, v: '999'})"}
-	connector.CreateTenant(testTenant, "test-tenant-scripts", types.ActionApply, []types.Migration{tenantMigration}, false)
+	connector.CreateTenant(types.Tenant{Name: testTenant}, "test-tenant-scripts", types.ActionApply, []types.Migration{tenantMigration}, false)
 
 	tenants := connector.GetTenants()
 	noOfTenants := len(tenants)
@@ -114,7 +114,7 @@ func TestMongoDBScripts(t *testing.T) {
 
 	scriptsToApply := []types.Migration{singleScript, tenantScript}
 
-	results, version := connector.CreateVersion("test-scripts", types.ActionApply, scriptsToApply, false)
+	results, version := connector.CreateVersion("test-scripts", types.ActionApply, scriptsToApply, nil, false)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.SingleScripts)
@@ -143,7 +143,7 @@ func TestMongoDBCreateTenant(t *testing.T) {
 	migrationsToApply := []types.Migration{tenant1, tenant2}
 
 	newTenantName := fmt.Sprintf("newtenant%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(newTenantName, "create-tenant-version", types.ActionApply, migrationsToApply, false)
+	results, version := connector.CreateTenant(types.Tenant{Name: newTenantName}, "create-tenant-version", types.ActionApply, migrationsToApply, false)
 
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
@@ -186,7 +186,7 @@ func TestMongoDBCustomTenantCollection(t *testing.T) {
 
 	// Create tenant in custom collection
 	tenantName := fmt.Sprintf("custom_tenant_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-custom-collection", types.ActionSync, []types.Migration{}, false)
+	results, version := connector.CreateTenant(types.Tenant{Name: tenantName}, "test-custom-collection", types.ActionSync, []types.Migration{}, false)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
@@ -211,7 +211,7 @@ func TestMongoDBCustomTenantCollectionAndField(t *testing.T) {
 
 	// Create tenant in custom collection with custom field
 	tenantName := fmt.Sprintf("org_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-custom-field", types.ActionSync, []types.Migration{}, false)
+	results, version := connector.CreateTenant(types.Tenant{Name: tenantName}, "test-custom-field", types.ActionSync, []types.Migration{}, false)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
@@ -236,7 +236,7 @@ func TestMongoDBBackwardCompatibilityTenantSelectSQL(t *testing.T) {
 
 	// Create tenant using old config field names
 	tenantName := fmt.Sprintf("legacy_tenant_%d", time.Now().UnixNano())
-	results, version := connector.CreateTenant(tenantName, "test-legacy-config", types.ActionSync, []types.Migration{}, false)
+	results, version := connector.CreateTenant(types.Tenant{Name: tenantName}, "test-legacy-config", types.ActionSync, []types.Migration{}, false)
 
 	assert.NotNil(t, version)
 	assert.Equal(t, int32(1), results.Tenants)
@@ -245,3 +245,66 @@ func TestMongoDBBackwardCompatibilityTenantSelectSQL(t *testing.T) {
 	tenants := connector.GetTenants()
 	assert.Contains(t, tenants, types.Tenant{Name: tenantName})
 }
+
+func TestMongoDBLock(t *testing.T) {
+	configFile := "../test/migrator-mongodb.yaml"
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+	config.LockTimeout = 1
+
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	unlock, err := connector.Lock()
+	assert.Nil(t, err)
+
+	_, err = connector.Lock()
+	assert.IsType(t, &LockHeldError{}, err)
+	assert.Equal(t, lockHolder(), err.(*LockHeldError).Holder)
+
+	unlock()
+
+	unlock, err = connector.Lock()
+	assert.Nil(t, err)
+	unlock()
+}
+
+func TestMongoDBJobs(t *testing.T) {
+	configFile := "../test/migrator-mongodb.yaml"
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	connector := New(newTestContext(), config)
+	defer connector.Dispose()
+
+	versionName := fmt.Sprintf("async-%v", time.Now().UnixNano())
+	job := connector.CreateJob(versionName)
+	assert.True(t, job.ID > 0)
+
+	cancelled, err := connector.CancelJob(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateQueued, cancelled.State)
+	assert.True(t, cancelled.CancelRequested)
+
+	jobError := "trouble maker"
+	job.State = types.JobStateFailed
+	job.MigrationsTotal = 3
+	job.MigrationsApplied = 1
+	job.Error = &jobError
+	err = connector.UpdateJob(job)
+	assert.Nil(t, err)
+
+	failed, err := connector.GetJobByID(job.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, types.JobStateFailed, failed.State)
+	assert.Equal(t, versionName, failed.VersionName)
+	assert.Equal(t, int32(1), failed.MigrationsApplied)
+	assert.Equal(t, "trouble maker", *failed.Error)
+	assert.Nil(t, failed.Results)
+
+	_, err = connector.CancelJob(job.ID)
+	assert.Equal(t, fmt.Sprintf("job %v already finished with state: Failed", job.ID), err.Error())
+
+	_, err = connector.GetJobByID(-1)
+	assert.Equal(t, "job not found ID: -1", err.Error())
+}
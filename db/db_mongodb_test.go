@@ -95,6 +95,25 @@ func TestMongoDBDocToDBMigration(t *testing.T) {
 	assert.Equal(t, now, migration.Created.Time)
 }
 
+func TestMongoDBDocToLegacyHistoryEntry(t *testing.T) {
+	config := &config.Config{
+		Driver:     "mongodb",
+		DataSource: "mongodb://localhost:27017",
+	}
+
+	connector := newMongoDBConnector(context.Background(), config)
+	mongoConnector := connector.(*mongoDBConnector)
+
+	flyway := bson.M{"installed_rank": int32(2), "version": "1.1", "description": "create users", "script": "V1_1__create_users.js", "checksum": int32(-1234567), "success": true}
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Version: "1.1", Description: "create users", Script: "V1_1__create_users.js", CheckSum: "-1234567", Success: true}, mongoConnector.docToLegacyHistoryEntry(types.LegacyToolFlyway, "abc", flyway))
+
+	liquibase := bson.M{"id": "1", "fileName": "changelog/001_users.json", "md5sum": "9:a1b2", "execType": "MARK_RAN"}
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Version: "1", Script: "changelog/001_users.json", CheckSum: "9:a1b2", Success: true}, mongoConnector.docToLegacyHistoryEntry(types.LegacyToolLiquibase, "abc", liquibase))
+
+	golangMigrate := bson.M{"version": int64(3), "dirty": true}
+	assert.Equal(t, types.LegacyHistoryEntry{Schema: "abc", Version: "3", Success: false}, mongoConnector.docToLegacyHistoryEntry(types.LegacyToolGolangMigrate, "abc", golangMigrate))
+}
+
 func TestMongoDBComputeSummary(t *testing.T) {
 	config := &config.Config{
 		Driver:     "mongodb",
@@ -110,13 +129,13 @@ func TestMongoDBComputeSummary(t *testing.T) {
 	}
 
 	migrations := []types.Migration{
-		{MigrationType: types.MigrationTypeSingleMigration},
-		{MigrationType: types.MigrationTypeSingleMigration},
-		{MigrationType: types.MigrationTypeTenantMigration},
-		{MigrationType: types.MigrationTypeTenantMigration},
-		{MigrationType: types.MigrationTypeTenantMigration},
-		{MigrationType: types.MigrationTypeSingleScript},
-		{MigrationType: types.MigrationTypeTenantScript},
+		{File: "s1", MigrationType: types.MigrationTypeSingleMigration},
+		{File: "s2", MigrationType: types.MigrationTypeSingleMigration},
+		{File: "t1", MigrationType: types.MigrationTypeTenantMigration},
+		{File: "t2", MigrationType: types.MigrationTypeTenantMigration},
+		{File: "t3", MigrationType: types.MigrationTypeTenantMigration},
+		{File: "ss1", MigrationType: types.MigrationTypeSingleScript},
+		{File: "ts1", MigrationType: types.MigrationTypeTenantScript},
 	}
 
 	tenants := []types.Tenant{
@@ -125,7 +144,8 @@ func TestMongoDBComputeSummary(t *testing.T) {
 		{Name: "tenant3"},
 	}
 
-	mongoConnector.computeSummary(summary, migrations, tenants)
+	tenantNames, pendingInTenants := pendingTenantMigrations(allTenantsMigrations(tenants, migrations))
+	mongoConnector.computeSummary(summary, migrations, tenantNames, pendingInTenants)
 
 	assert.Equal(t, int32(2), summary.SingleMigrations)
 	assert.Equal(t, int32(3), summary.TenantMigrations)
@@ -137,6 +157,38 @@ func TestMongoDBComputeSummary(t *testing.T) {
 	assert.Equal(t, int32(4), summary.ScriptsGrandTotal)     // 1 + 3
 }
 
+func TestMongoDBComputeSummaryTenantMigrations(t *testing.T) {
+	config := &config.Config{
+		Driver:     "mongodb",
+		DataSource: "mongodb://localhost:27017",
+	}
+
+	connector := newMongoDBConnector(context.Background(), config)
+	mongoConnector := connector.(*mongoDBConnector)
+
+	summary := &types.Summary{
+		StartedAt: graphql.Time{Time: time.Now()},
+		Tenants:   2,
+	}
+
+	t1 := types.Migration{File: "t1", MigrationType: types.MigrationTypeTenantMigration}
+	t2 := types.Migration{File: "t2", MigrationType: types.MigrationTypeTenantMigration}
+	migrations := []types.Migration{t1, t2}
+
+	// t1 is pending only in tenant1
+	tenantMigrations := map[string][]types.Migration{
+		"tenant1": {t1, t2},
+		"tenant2": {t2},
+	}
+
+	tenantNames, pendingInTenants := pendingTenantMigrations(tenantMigrations)
+	mongoConnector.computeSummary(summary, migrations, tenantNames, pendingInTenants)
+
+	assert.Equal(t, int32(2), summary.TenantMigrations)
+	assert.Equal(t, int32(3), summary.TenantMigrationsTotal)
+	assert.Equal(t, int32(3), summary.MigrationsGrandTotal)
+}
+
 func TestMongoDBSchemaPlaceholderDefault(t *testing.T) {
 	config := &config.Config{
 		Driver:     "mongodb",
@@ -1,9 +1,11 @@
 package db
 
 import (
+	"errors"
 	"fmt"
-	// blank import for MSSQL driver
-	_ "github.com/microsoft/go-mssqldb"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
 )
 
 type msSQLDialect struct {
@@ -11,12 +13,14 @@ type msSQLDialect struct {
 }
 
 const (
-	insertMigrationMSSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)"
-	insertTenantMSSQLDialectSQL         = "insert into %v.%v (name) values (@p1)"
+	insertMigrationMSSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)"
+	insertTenantMSSQLDialectSQL         = "insert into %v.%v (name, metadata) values (@p1, @p2)"
+	deleteTenantMSSQLDialectSQL         = "delete from %v.%v where name = @p1"
+	updateMigrationMSSQLDialectSQL      = "update %v.%v set contents = @p1, checksum = @p2 where filename = @p3 and type in (@p4, @p5)"
 	insertVersionMSSQLSQLDialectSQL     = "insert into %v.%v (name) output inserted.id values (@p1)"
-	selectVersionsByFileMSSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
-	selectVersionByIDMSSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
-	selectMigrationByIDMSSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = @p1"
+	selectVersionsByFileMSSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = @p1) order by vid desc, mid asc"
+	selectVersionByIDMSSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc"
+	selectMigrationByIDMSSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = @p1"
 	createTenantsTableMSSQLDialectSQL   = `
 IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
 BEGIN
@@ -42,12 +46,33 @@ BEGIN
 		checksum varchar(64)
   );
 END
+`
+	addColumnMSSQLDialectSQL = `
+IF COL_LENGTH('%v.%v', '%v') IS NULL
+BEGIN
+  alter table [%v].%v add %v %v;
+END
 `
 	createSchemaMSSQLDialectSQL = `
 IF NOT EXISTS (select * from information_schema.schemata where schema_name = '%v')
 BEGIN
   EXEC sp_executesql N'create schema %v';
 END
+`
+	renameSchemaMSSQLDialectSQL = `
+EXEC sp_executesql N'create schema %v';
+declare @sql nvarchar(max) = N'';
+select @sql = @sql + N'alter schema [%v] transfer [%v].' + quotename(name) + N';' from sys.objects where schema_id = schema_id('%v') and parent_object_id = 0;
+EXEC sp_executesql @sql;
+EXEC sp_executesql N'drop schema %v';
+`
+	dropSchemaMSSQLDialectSQL = `
+declare @sql nvarchar(max) = N'';
+select @sql = @sql + N'alter table ' + quotename(object_schema_name(parent_object_id)) + N'.' + quotename(object_name(parent_object_id)) + N' drop constraint ' + quotename(name) + N';' from sys.foreign_keys where referenced_object_id in (select object_id from sys.tables where schema_id = schema_id('%v'));
+select @sql = @sql + N'drop view [%v].' + quotename(name) + N';' from sys.views where schema_id = schema_id('%v');
+select @sql = @sql + N'drop table [%v].' + quotename(name) + N';' from sys.tables where schema_id = schema_id('%v');
+EXEC sp_executesql @sql;
+EXEC sp_executesql N'drop schema %v';
 `
 	versionsTableSetupMSSQLDialectSQL = `
 if not exists (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
@@ -75,6 +100,42 @@ begin
   select @cn = name from sys.default_constraints where parent_object_id = object_id('[%v].%v') and name like '%%ver%%';
   EXEC ('alter table [%v].%v drop constraint ' + @cn);
 end
+`
+	lockMSSQLDialectSQL             = "declare @result int; exec @result = sp_getapplock @Resource = '%v', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0; select case when @result >= 0 then 1 else 0 end"
+	unlockMSSQLDialectSQL           = "exec sp_releaseapplock @Resource = '%v', @LockOwner = 'Session'"
+	insertLockHolderMSSQLDialectSQL = "insert into %v.%v (holder) values (@p1)"
+	insertJobMSSQLDialectSQL        = "insert into %v.%v (state, version_name) output inserted.id values (@p1, @p2)"
+	updateJobMSSQLDialectSQL        = "update %v.%v set state = @p1, migrations_total = @p2, migrations_applied = @p3, version_id = @p4, summary = @p5, error = @p6, updated = current_timestamp where id = @p7"
+	selectJobByIDMSSQLDialectSQL    = "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from %v.%v where id = @p1"
+	cancelJobMSSQLDialectSQL        = "update %v.%v set cancel_requested = 1, updated = current_timestamp where id = @p1 and state in (@p2, @p3)"
+	failStaleJobsMSSQLDialectSQL    = "update %v.%v set state = @p1, error = @p2, updated = current_timestamp where state in (@p3, @p4) and updated < dateadd(second, -@p5, current_timestamp)"
+	lockTimeoutMSSQLDialectSQL      = "set lock_timeout %d"
+	createJobsTableMSSQLDialectSQL  = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    id int identity (1,1) primary key,
+    state int not null,
+    version_name varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP,
+    updated datetime default CURRENT_TIMESTAMP,
+    migrations_total int not null default 0,
+    migrations_applied int not null default 0,
+    version_id int,
+    summary text,
+    error text,
+    cancel_requested int not null default 0
+  );
+END
+`
+	createLocksTableMSSQLDialectSQL = `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = '%v' and table_name = '%v')
+BEGIN
+  create table [%v].%v (
+    holder varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
 `
 )
 
@@ -83,11 +144,26 @@ func (md *msSQLDialect) LastInsertIDSupported() bool {
 	return false
 }
 
+// TransactionalDDLSupported instructs migrator if DDL statements can be rolled back, MS SQL runs DDL statements in transactions
+func (md *msSQLDialect) TransactionalDDLSupported() bool {
+	return true
+}
+
 // GetMigrationInsertSQL returns MS SQL-specific migration insert SQL statement
 func (md *msSQLDialect) GetMigrationInsertSQL() string {
 	return fmt.Sprintf(insertMigrationMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetMigrationUpdateSQL returns MS SQL-specific SQL statement which updates contents and checksum of applied migrations
+func (md *msSQLDialect) GetMigrationUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// SplitStatements splits MS SQL migration into batches separated by GO, statements within a batch are executed together
+func (md *msSQLDialect) SplitStatements(contents string) []statement {
+	return statementSplitter{batchSeparator: "GO", bracketQuotes: true}.split(contents)
+}
+
 // GetTenantInsertSQL returns MS SQL-specific migrator's default tenant insert SQL statement
 func (md *msSQLDialect) GetTenantInsertSQL() string {
 	return fmt.Sprintf(insertTenantMSSQLDialectSQL, migratorSchema, migratorTenantsTable)
@@ -99,6 +175,82 @@ func (md *msSQLDialect) GetCreateTenantsTableSQL() string {
 	return fmt.Sprintf(createTenantsTableMSSQLDialectSQL, migratorSchema, migratorTenantsTable, migratorSchema, migratorTenantsTable)
 }
 
+// GetCreateLocksTableSQL returns migrator's create locks table SQL statement.
+// This SQL is used by MS SQL.
+func (md *msSQLDialect) GetCreateLocksTableSQL() string {
+	return fmt.Sprintf(createLocksTableMSSQLDialectSQL, migratorSchema, migratorLocksTable, migratorSchema, migratorLocksTable)
+}
+
+// GetCreateJobsTableSQL returns migrator's create jobs table SQL statement.
+// This SQL is used by MS SQL.
+func (md *msSQLDialect) GetCreateJobsTableSQL() string {
+	return fmt.Sprintf(createJobsTableMSSQLDialectSQL, migratorSchema, migratorJobsTable, migratorSchema, migratorJobsTable)
+}
+
+// GetJobInsertSQL returns MS SQL-specific SQL statement which creates new job and returns its ID
+func (md *msSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MS SQL-specific SQL statement which updates state, progress, and results of job
+func (md *msSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns MS SQL-specific SQL statement which returns job by its ID
+func (md *msSQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobCancelSQL returns MS SQL-specific SQL statement which requests cancellation of queued or running job
+func (md *msSQLDialect) GetJobCancelSQL() string {
+	return fmt.Sprintf(cancelJobMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetStaleJobsFailSQL returns MS SQL-specific SQL statement which fails queued or running jobs not updated for given number of seconds
+// MS SQL has no interval type, staleness threshold is computed with dateadd
+func (md *msSQLDialect) GetStaleJobsFailSQL() string {
+	return fmt.Sprintf(failStaleJobsMSSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// deadlockMSSQLErrorNumber is the number of MS SQL error returned to transaction chosen as deadlock victim
+const deadlockMSSQLErrorNumber = 1205
+
+// IsTransientError returns true for MS SQL deadlocks and connection errors
+func (md *msSQLDialect) IsTransientError(err error) bool {
+	var msSQLErr mssql.Error
+	if errors.As(err, &msSQLErr) {
+		return msSQLErr.SQLErrorNumber() == deadlockMSSQLErrorNumber
+	}
+	return isConnectionError(err)
+}
+
+// GetStatementTimeoutSQL returns MS SQL-specific SQL statements which limit lock waits to timeout
+// MS SQL does not have server-side statement timeout, statements which run longer than timeout are cancelled by migrator
+func (md *msSQLDialect) GetStatementTimeoutSQL(timeout time.Duration) []string {
+	return []string{fmt.Sprintf(lockTimeoutMSSQLDialectSQL, timeout.Milliseconds())}
+}
+
+// GetResetStatementTimeoutSQL returns MS SQL-specific SQL statements which restore default (infinite) lock timeout
+func (md *msSQLDialect) GetResetStatementTimeoutSQL() []string {
+	return []string{"set lock_timeout -1"}
+}
+
+// GetLockSQL returns MS SQL-specific SQL which tries to acquire session-owned application lock, returns 1 when acquired
+func (md *msSQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockMSSQLDialectSQL, migrationLockName)
+}
+
+// GetUnlockSQL returns MS SQL-specific SQL which releases session-owned application lock
+func (md *msSQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockMSSQLDialectSQL, migrationLockName)
+}
+
+// GetLockHolderInsertSQL returns MS SQL-specific SQL statement which records holder of migration lock
+func (md *msSQLDialect) GetLockHolderInsertSQL() string {
+	return fmt.Sprintf(insertLockHolderMSSQLDialectSQL, migratorSchema, migratorLocksTable)
+}
+
 // GetCreateMigrationsTableSQL returns migrator's create migrations table SQL statement.
 // This SQL is used by MS SQL.
 func (md *msSQLDialect) GetCreateMigrationsTableSQL() string {
@@ -114,6 +266,30 @@ func (md *msSQLDialect) GetCreateSchemaSQL(schema string) string {
 	return fmt.Sprintf(createSchemaMSSQLDialectSQL, schema, schema)
 }
 
+// GetRenameSchemaSQL returns MS SQL-specific SQL which renames schema
+// MS SQL does not support renaming schemas, new schema is created and all objects are transferred to it
+func (md *msSQLDialect) GetRenameSchemaSQL(schema, newSchema string) []string {
+	if !isValidIdentifier(schema) || !isValidIdentifier(newSchema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v, %v", schema, newSchema))
+	}
+	return []string{fmt.Sprintf(renameSchemaMSSQLDialectSQL, newSchema, newSchema, schema, schema, schema)}
+}
+
+// GetDropSchemaSQL returns MS SQL-specific SQL which drops schema
+// MS SQL cannot drop schema which contains objects, foreign keys referencing schema's tables, views, and tables are dropped first
+func (md *msSQLDialect) GetDropSchemaSQL(schema string) []string {
+	if !isValidIdentifier(schema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v", schema))
+	}
+	return []string{fmt.Sprintf(dropSchemaMSSQLDialectSQL, schema, schema, schema, schema, schema, schema)}
+}
+
+// GetTenantDeleteSQL returns MS SQL-specific migrator's default tenant delete SQL statement
+// tenant name is bound using MS SQL's named @p1 parameter
+func (md *msSQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantMSSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
 func (md *msSQLDialect) GetVersionInsertSQL() string {
 	return fmt.Sprintf(insertVersionMSSQLSQLDialectSQL, migratorSchema, migratorVersionsTable)
 }
@@ -133,3 +309,8 @@ func (md *msSQLDialect) GetVersionByIDSQL() string {
 func (md *msSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMSSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetAddColumnSQL returns MS SQL-specific SQL which adds column to migrator's table if it does not exist
+func (md *msSQLDialect) GetAddColumnSQL(table, column, definition string) []string {
+	return []string{fmt.Sprintf(addColumnMSSQLDialectSQL, migratorSchema, table, column, migratorSchema, table, column, definition)}
+}
@@ -1,10 +1,14 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	mssql "github.com/microsoft/go-mssqldb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,6 +31,18 @@ func TestMSSQLLastInsertIdSupported(t *testing.T) {
 	assert.False(t, lastInsertIDSupported)
 }
 
+func TestMSSQLTransactionalDDLSupported(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	transactionalDDLSupported := dialect.TransactionalDDLSupported()
+
+	assert.True(t, transactionalDDLSupported)
+}
+
 func TestMSSQLGetMigrationInsertSQL(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-mssql.yaml")
 	assert.Nil(t, err)
@@ -37,7 +53,69 @@ func TestMSSQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)", insertMigrationSQL)
+}
+
+func TestMSSQLGetMigrationUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+
+	dialect := newDialect(config)
+
+	updateMigrationSQL := dialect.GetMigrationUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = @p1, checksum = @p2 where filename = @p3 and type in (@p4, @p5)", updateMigrationSQL)
+}
+
+func TestMSSQLGetTenantDeleteSQLDefault(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+
+	dialect := newDialect(config)
+
+	tenantDeleteSQL := dialect.GetTenantDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_tenants where name = @p1", tenantDeleteSQL)
+}
+
+func TestMSSQLGetRenameSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+
+	dialect := newDialect(config)
+
+	renameSchemaSQL := dialect.GetRenameSchemaSQL("abc", "abc_archived")
+
+	expected := `
+EXEC sp_executesql N'create schema abc_archived';
+declare @sql nvarchar(max) = N'';
+select @sql = @sql + N'alter schema [abc_archived] transfer [abc].' + quotename(name) + N';' from sys.objects where schema_id = schema_id('abc') and parent_object_id = 0;
+EXEC sp_executesql @sql;
+EXEC sp_executesql N'drop schema abc';
+`
+
+	assert.Equal(t, []string{expected}, renameSchemaSQL)
+}
+
+func TestMSSQLGetDropSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+
+	dialect := newDialect(config)
+
+	dropSchemaSQL := dialect.GetDropSchemaSQL("abc")
+
+	assert.Len(t, dropSchemaSQL, 1)
+	assert.Contains(t, dropSchemaSQL[0], "from sys.tables where schema_id = schema_id('abc')")
+	assert.Contains(t, dropSchemaSQL[0], "EXEC sp_executesql N'drop schema abc';")
 }
 
 func TestMSSQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -51,7 +129,7 @@ func TestMSSQLGetTenantInsertSQLDefault(t *testing.T) {
 
 	tenantInsertSQL := connector.getTenantInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_tenants (name) values (@p1)", tenantInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_tenants (name, metadata) values (@p1, @p2)", tenantInsertSQL)
 }
 
 func TestMSSQLDialectGetCreateTenantsTableSQL(t *testing.T) {
@@ -201,7 +279,7 @@ func TestMSSQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = @p1) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = @p1) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestMSSQLGetVersionByIDSQL(t *testing.T) {
@@ -213,7 +291,7 @@ func TestMSSQLGetVersionByIDSQL(t *testing.T) {
 
 	versionByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc", versionByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = @p1 order by mid asc", versionByID)
 }
 
 func TestMSSQLGetMigrationByIDSQL(t *testing.T) {
@@ -225,5 +303,111 @@ func TestMSSQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = @p1", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = @p1", migrationByID)
+}
+
+func TestMSSQLGetAddColumnSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mssql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	addColumnSQLs := dialect.GetAddColumnSQL("migrator_migrations", "down_contents", "text")
+
+	expected := `
+IF COL_LENGTH('migrator.migrator_migrations', 'down_contents') IS NULL
+BEGIN
+  alter table [migrator].migrator_migrations add down_contents text;
+END
+`
+
+	assert.Equal(t, []string{expected}, addColumnSQLs)
+}
+
+func TestMSSQLGetLockSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "declare @result int; exec @result = sp_getapplock @Resource = 'migrator', @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = 0; select case when @result >= 0 then 1 else 0 end", dialect.GetLockSQL())
+	assert.Equal(t, "exec sp_releaseapplock @Resource = 'migrator', @LockOwner = 'Session'", dialect.GetUnlockSQL())
+	assert.Equal(t, "insert into migrator.migrator_locks (holder) values (@p1)", dialect.GetLockHolderInsertSQL())
+}
+
+func TestMSSQLDialectGetCreateLocksTableSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	expected := `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = 'migrator' and table_name = 'migrator_locks')
+BEGIN
+  create table [migrator].migrator_locks (
+    holder varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP
+  );
+END
+`
+
+	assert.Equal(t, expected, dialect.GetCreateLocksTableSQL())
+}
+
+func TestMSSQLGetJobSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (state, version_name) output inserted.id values (@p1, @p2)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = @p1, migrations_total = @p2, migrations_applied = @p3, version_id = @p4, summary = @p5, error = @p6, updated = current_timestamp where id = @p7", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from migrator.migrator_jobs where id = @p1", dialect.GetJobByIDSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set cancel_requested = 1, updated = current_timestamp where id = @p1 and state in (@p2, @p3)", dialect.GetJobCancelSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = @p1, error = @p2, updated = current_timestamp where state in (@p3, @p4) and updated < dateadd(second, -@p5, current_timestamp)", dialect.GetStaleJobsFailSQL())
+}
+
+func TestMSSQLGetStatementTimeoutSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.Equal(t, []string{"set lock_timeout 90000"}, dialect.GetStatementTimeoutSQL(90*time.Second))
+	assert.Equal(t, []string{"set lock_timeout -1"}, dialect.GetResetStatementTimeoutSQL())
+}
+
+func TestMSSQLDialectGetCreateJobsTableSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	expected := `
+IF NOT EXISTS (select * from information_schema.tables where table_schema = 'migrator' and table_name = 'migrator_jobs')
+BEGIN
+  create table [migrator].migrator_jobs (
+    id int identity (1,1) primary key,
+    state int not null,
+    version_name varchar(200) not null,
+    created datetime default CURRENT_TIMESTAMP,
+    updated datetime default CURRENT_TIMESTAMP,
+    migrations_total int not null default 0,
+    migrations_applied int not null default 0,
+    version_id int,
+    summary text,
+    error text,
+    cancel_requested int not null default 0
+  );
+END
+`
+
+	assert.Equal(t, expected, dialect.GetCreateJobsTableSQL())
+}
+
+func TestMSSQLIsTransientError(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "sqlserver"
+	dialect := newDialect(config)
+
+	assert.True(t, dialect.IsTransientError(mssql.Error{Number: 1205}))
+	assert.True(t, dialect.IsTransientError(io.ErrUnexpectedEOF))
+	assert.False(t, dialect.IsTransientError(mssql.Error{Number: 208}))
+	assert.False(t, dialect.IsTransientError(errors.New("trouble maker")))
 }
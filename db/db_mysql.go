@@ -1,9 +1,11 @@
 package db
 
 import (
+	"errors"
 	"fmt"
-	// blank import for MySQL driver
-	_ "github.com/go-sql-driver/mysql"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type mySQLDialect struct {
@@ -11,12 +13,25 @@ type mySQLDialect struct {
 }
 
 const (
-	insertMigrationMySQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (?, ?, ?, ?, ?, ?, ?, ?)"
-	insertTenantMySQLDialectSQL                = "insert into %v.%v (name) values (?)"
+	insertMigrationMySQLDialectSQL             = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	insertTenantMySQLDialectSQL                = "insert into %v.%v (name, metadata) values (?, ?)"
+	deleteTenantMySQLDialectSQL                = "delete from %v.%v where name = ?"
+	dropSchemaMySQLDialectSQL                  = "drop schema %v"
+	updateMigrationMySQLDialectSQL             = "update %v.%v set contents = ?, checksum = ? where filename = ? and type in (?, ?)"
 	insertVersionMySQLDialectSQL               = "insert into %v.%v (name) values (?)"
-	selectVersionsByFileMySQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = ?) order by vid desc, mid asc"
-	selectVersionByIDMySQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
-	selectMigrationByIDMySQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = ?"
+	selectVersionsByFileMySQLDialectSQL        = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = ?) order by vid desc, mid asc"
+	selectVersionByIDMySQLDialectSQL           = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = ? order by mid asc"
+	selectMigrationByIDMySQLDialectSQL         = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = ?"
+	lockMySQLDialectSQL                        = "select coalesce(get_lock('%v', 0), 0)"
+	unlockMySQLDialectSQL                      = "select release_lock('%v')"
+	insertLockHolderMySQLDialectSQL            = "insert into %v.%v (holder) values (?)"
+	insertJobMySQLDialectSQL                   = "insert into %v.%v (state, version_name) values (?, ?)"
+	updateJobMySQLDialectSQL                   = "update %v.%v set state = ?, migrations_total = ?, migrations_applied = ?, version_id = ?, summary = ?, error = ?, updated = current_timestamp where id = ?"
+	selectJobByIDMySQLDialectSQL               = "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from %v.%v where id = ?"
+	cancelJobMySQLDialectSQL                   = "update %v.%v set cancel_requested = 1, updated = current_timestamp where id = ? and state in (?, ?)"
+	failStaleJobsMySQLDialectSQL               = "update %v.%v set state = ?, error = ?, updated = current_timestamp where state in (?, ?) and updated < current_timestamp - interval ? second"
+	lockWaitTimeoutMySQLDialectSQL             = "set session lock_wait_timeout = %d"
+	innodbLockWaitTimeoutMySQLDialectSQL       = "set session innodb_lock_wait_timeout = %d"
 	versionsTableSetupMySQLDropDialectSQL      = `drop procedure if exists migrator_create_versions`
 	versionsTableSetupMySQLCallDialectSQL      = `call migrator_create_versions()`
 	versionsTableSetupMySQLProcedureDialectSQL = `
@@ -41,6 +56,41 @@ if not exists (select * from information_schema.tables where table_schema = '%v'
     add constraint migrator_versions_version_id_fk foreign key (version_id) references %v.%v (id) on delete cascade;
 end if;
 end;
+`
+	addColumnMySQLDropDialectSQL      = `drop procedure if exists migrator_add_column`
+	addColumnMySQLCallDialectSQL      = `call migrator_add_column()`
+	addColumnMySQLProcedureDialectSQL = `
+create procedure migrator_add_column()
+begin
+if not exists (select * from information_schema.columns where table_schema = '%v' and table_name = '%v' and column_name = '%v') then
+  alter table %v.%v add column %v %v;
+end if;
+end;
+`
+	renameSchemaMySQLDropDialectSQL      = `drop procedure if exists migrator_rename_schema`
+	renameSchemaMySQLCallDialectSQL      = `call migrator_rename_schema()`
+	renameSchemaMySQLProcedureDialectSQL = `
+create procedure migrator_rename_schema()
+begin
+declare done int default false;
+declare t varchar(64);
+declare c cursor for select table_name from information_schema.tables where table_schema = '%v';
+declare continue handler for not found set done = true;
+create schema %v;
+open c;
+rename_loop: loop
+  fetch c into t;
+  if done then
+    leave rename_loop;
+  end if;
+  set @rename_sql = concat('rename table %v.', t, ' to %v.', t);
+  prepare stmt from @rename_sql;
+  execute stmt;
+  deallocate prepare stmt;
+end loop;
+close c;
+drop schema %v;
+end;
 `
 )
 
@@ -49,16 +99,125 @@ func (md *mySQLDialect) LastInsertIDSupported() bool {
 	return true
 }
 
+// TransactionalDDLSupported instructs migrator if DDL statements can be rolled back, MySQL commits DDL statements implicitly
+func (md *mySQLDialect) TransactionalDDLSupported() bool {
+	return false
+}
+
 // GetMigrationInsertSQL returns MySQL-specific migration insert SQL statement
 func (md *mySQLDialect) GetMigrationInsertSQL() string {
 	return fmt.Sprintf(insertMigrationMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetMigrationUpdateSQL returns MySQL-specific SQL statement which updates contents and checksum of applied migrations
+func (md *mySQLDialect) GetMigrationUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// SplitStatements splits MySQL migration into statements, DELIMITER command is supported
+func (md *mySQLDialect) SplitStatements(contents string) []statement {
+	return statementSplitter{delimiter: ";", delimiterCommand: true, backslashEscapes: true, hashComments: true, backtickQuotes: true}.split(contents)
+}
+
+// GetLockSQL returns MySQL-specific SQL which tries to acquire named lock, returns 1 when acquired
+func (md *mySQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockMySQLDialectSQL, migrationLockName)
+}
+
+// GetUnlockSQL returns MySQL-specific SQL which releases named lock
+func (md *mySQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockMySQLDialectSQL, migrationLockName)
+}
+
+// GetLockHolderInsertSQL returns MySQL-specific SQL statement which records holder of migration lock
+func (md *mySQLDialect) GetLockHolderInsertSQL() string {
+	return fmt.Sprintf(insertLockHolderMySQLDialectSQL, migratorSchema, migratorLocksTable)
+}
+
+// GetJobInsertSQL returns MySQL-specific SQL statement which creates new job
+func (md *mySQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns MySQL-specific SQL statement which updates state, progress, and results of job
+func (md *mySQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns MySQL-specific SQL statement which returns job by its ID
+func (md *mySQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobCancelSQL returns MySQL-specific SQL statement which requests cancellation of queued or running job
+func (md *mySQLDialect) GetJobCancelSQL() string {
+	return fmt.Sprintf(cancelJobMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetStaleJobsFailSQL returns MySQL-specific SQL statement which fails queued or running jobs not updated for given number of seconds
+// staleness threshold is computed with MySQL's interval ? second arithmetic
+func (md *mySQLDialect) GetStaleJobsFailSQL() string {
+	return fmt.Sprintf(failStaleJobsMySQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// deadlockMySQLErrorNumber is the number of MySQL error returned to transaction chosen as deadlock victim
+const deadlockMySQLErrorNumber = 1213
+
+// IsTransientError returns true for MySQL deadlocks and connection errors
+func (md *mySQLDialect) IsTransientError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == deadlockMySQLErrorNumber
+	}
+	return errors.Is(err, mysql.ErrInvalidConn) || isConnectionError(err)
+}
+
+// GetStatementTimeoutSQL returns MySQL-specific SQL statements which limit lock waits to timeout
+// MySQL cannot abort DDL and DML statements which run longer than timeout, such statements are cancelled by migrator
+func (md *mySQLDialect) GetStatementTimeoutSQL(timeout time.Duration) []string {
+	// MySQL lock timeouts are set in seconds
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+	return []string{fmt.Sprintf(lockWaitTimeoutMySQLDialectSQL, seconds), fmt.Sprintf(innodbLockWaitTimeoutMySQLDialectSQL, seconds)}
+}
+
+// GetResetStatementTimeoutSQL returns MySQL-specific SQL statements which restore default lock timeouts
+func (md *mySQLDialect) GetResetStatementTimeoutSQL() []string {
+	return []string{"set session lock_wait_timeout = default", "set session innodb_lock_wait_timeout = default"}
+}
+
 // GetTenantInsertSQL returns MySQL-specific migrator's default tenant insert SQL statement
 func (md *mySQLDialect) GetTenantInsertSQL() string {
 	return fmt.Sprintf(insertTenantMySQLDialectSQL, migratorSchema, migratorTenantsTable)
 }
 
+// GetTenantDeleteSQL returns MySQL-specific migrator's default tenant delete SQL statement
+// tenant name is bound using MySQL's positional ? placeholder
+func (md *mySQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantMySQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetRenameSchemaSQL returns MySQL-specific SQLs which rename schema (database)
+// MySQL does not support renaming databases, a procedure is used to create new database and move all tables to it
+func (md *mySQLDialect) GetRenameSchemaSQL(schema, newSchema string) []string {
+	if !isValidIdentifier(schema) || !isValidIdentifier(newSchema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v, %v", schema, newSchema))
+	}
+	return []string{
+		renameSchemaMySQLDropDialectSQL,
+		fmt.Sprintf(renameSchemaMySQLProcedureDialectSQL, schema, newSchema, schema, newSchema, schema),
+		renameSchemaMySQLCallDialectSQL,
+	}
+}
+
+// GetDropSchemaSQL returns MySQL-specific SQL which drops schema (database) together with all its tables
+// in MySQL schema is a synonym for database so plain drop schema also removes all views and routines, no cascade is needed
+func (md *mySQLDialect) GetDropSchemaSQL(schema string) []string {
+	if !isValidIdentifier(schema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v", schema))
+	}
+	return []string{fmt.Sprintf(dropSchemaMySQLDialectSQL, schema)}
+}
+
 func (md *mySQLDialect) GetVersionInsertSQL() string {
 	return fmt.Sprintf(insertVersionMySQLDialectSQL, migratorSchema, migratorVersionsTable)
 }
@@ -87,3 +246,13 @@ func (md *mySQLDialect) GetVersionByIDSQL() string {
 func (md *mySQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDMySQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetAddColumnSQL returns MySQL-specific SQLs which add column to migrator's table if it does not exist
+// MySQL does not support add column if not exists, similarly to GetCreateVersionsTableSQL a procedure is used
+func (md *mySQLDialect) GetAddColumnSQL(table, column, definition string) []string {
+	return []string{
+		addColumnMySQLDropDialectSQL,
+		fmt.Sprintf(addColumnMySQLProcedureDialectSQL, migratorSchema, table, column, migratorSchema, table, column, definition),
+		addColumnMySQLCallDialectSQL,
+	}
+}
@@ -1,8 +1,12 @@
 package db
 
 import (
+	"database/sql/driver"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,6 +29,17 @@ func TestMySQLLastInsertIdSupported(t *testing.T) {
 	assert.True(t, lastInsertIDSupported)
 }
 
+func TestMySQLTransactionalDDLSupported(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	transactionalDDLSupported := dialect.TransactionalDDLSupported()
+
+	assert.False(t, transactionalDDLSupported)
+}
+
 func TestMySQLGetMigrationInsertSQL(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-mysql.yaml")
 	assert.Nil(t, err)
@@ -35,7 +50,65 @@ func TestMySQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values (?, ?, ?, ?, ?, ?, ?, ?)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values (?, ?, ?, ?, ?, ?, ?, ?, ?)", insertMigrationSQL)
+}
+
+func TestMySQLGetMigrationUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+
+	dialect := newDialect(config)
+
+	updateMigrationSQL := dialect.GetMigrationUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = ?, checksum = ? where filename = ? and type in (?, ?)", updateMigrationSQL)
+}
+
+func TestMySQLGetTenantDeleteSQLDefault(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+
+	dialect := newDialect(config)
+
+	tenantDeleteSQL := dialect.GetTenantDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_tenants where name = ?", tenantDeleteSQL)
+}
+
+func TestMySQLGetRenameSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+
+	dialect := newDialect(config)
+
+	renameSchemaSQL := dialect.GetRenameSchemaSQL("abc", "abc_archived")
+
+	assert.Len(t, renameSchemaSQL, 3)
+	assert.Equal(t, "drop procedure if exists migrator_rename_schema", renameSchemaSQL[0])
+	assert.Contains(t, renameSchemaSQL[1], "where table_schema = 'abc'")
+	assert.Contains(t, renameSchemaSQL[1], "create schema abc_archived;")
+	assert.Contains(t, renameSchemaSQL[1], "concat('rename table abc.', t, ' to abc_archived.', t)")
+	assert.Contains(t, renameSchemaSQL[1], "drop schema abc;")
+	assert.Equal(t, "call migrator_rename_schema()", renameSchemaSQL[2])
+}
+
+func TestMySQLGetDropSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+
+	dialect := newDialect(config)
+
+	dropSchemaSQL := dialect.GetDropSchemaSQL("abc")
+
+	assert.Equal(t, []string{"drop schema abc"}, dropSchemaSQL)
 }
 
 func TestMySQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -49,7 +122,7 @@ func TestMySQLGetTenantInsertSQLDefault(t *testing.T) {
 
 	tenantInsertSQL := connector.getTenantInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_tenants (name) values (?)", tenantInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_tenants (name, metadata) values (?, ?)", tenantInsertSQL)
 }
 
 func TestMySQLGetVersionInsertSQL(t *testing.T) {
@@ -113,7 +186,7 @@ func TestMySQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = ?) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = ?) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestMySQLGetVersionByIDSQL(t *testing.T) {
@@ -125,7 +198,7 @@ func TestMySQLGetVersionByIDSQL(t *testing.T) {
 
 	versionsByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = ? order by mid asc", versionsByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = ? order by mid asc", versionsByID)
 }
 
 func TestMySQLGetMigrationByIDSQL(t *testing.T) {
@@ -137,5 +210,69 @@ func TestMySQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = ?", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = ?", migrationByID)
+}
+
+func TestMySQLGetAddColumnSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-mysql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	addColumnSQLs := dialect.GetAddColumnSQL("migrator_migrations", "down_contents", "text")
+
+	expected := `
+create procedure migrator_add_column()
+begin
+if not exists (select * from information_schema.columns where table_schema = 'migrator' and table_name = 'migrator_migrations' and column_name = 'down_contents') then
+  alter table migrator.migrator_migrations add column down_contents text;
+end if;
+end;
+`
+
+	assert.Equal(t, []string{"drop procedure if exists migrator_add_column", expected, "call migrator_add_column()"}, addColumnSQLs)
+}
+
+func TestMySQLGetLockSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select coalesce(get_lock('migrator', 0), 0)", dialect.GetLockSQL())
+	assert.Equal(t, "select release_lock('migrator')", dialect.GetUnlockSQL())
+	assert.Equal(t, "insert into migrator.migrator_locks (holder) values (?)", dialect.GetLockHolderInsertSQL())
+}
+
+func TestMySQLGetJobSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (state, version_name) values (?, ?)", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = ?, migrations_total = ?, migrations_applied = ?, version_id = ?, summary = ?, error = ?, updated = current_timestamp where id = ?", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from migrator.migrator_jobs where id = ?", dialect.GetJobByIDSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set cancel_requested = 1, updated = current_timestamp where id = ? and state in (?, ?)", dialect.GetJobCancelSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = ?, error = ?, updated = current_timestamp where state in (?, ?) and updated < current_timestamp - interval ? second", dialect.GetStaleJobsFailSQL())
+}
+
+func TestMySQLGetStatementTimeoutSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.Equal(t, []string{"set session lock_wait_timeout = 90", "set session innodb_lock_wait_timeout = 90"}, dialect.GetStatementTimeoutSQL(90*time.Second))
+	assert.Equal(t, []string{"set session lock_wait_timeout = default", "set session innodb_lock_wait_timeout = default"}, dialect.GetResetStatementTimeoutSQL())
+}
+
+func TestMySQLIsTransientError(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+
+	assert.True(t, dialect.IsTransientError(&mysql.MySQLError{Number: 1213}))
+	assert.True(t, dialect.IsTransientError(mysql.ErrInvalidConn))
+	assert.True(t, dialect.IsTransientError(driver.ErrBadConn))
+	assert.False(t, dialect.IsTransientError(&mysql.MySQLError{Number: 1146}))
+	assert.False(t, dialect.IsTransientError(errors.New("trouble maker")))
 }
@@ -1,7 +1,11 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 	// blank import for PostgreSQL driver
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -11,12 +15,27 @@ type postgreSQLDialect struct {
 }
 
 const (
-	insertMigrationPostgreSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)"
-	insertTenantPostgreSQLDialectSQL         = "insert into %v.%v (name) values ($1)"
+	insertMigrationPostgreSQLDialectSQL      = "insert into %v.%v (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	insertTenantPostgreSQLDialectSQL         = "insert into %v.%v (name, metadata) values ($1, $2)"
+	deleteTenantPostgreSQLDialectSQL         = "delete from %v.%v where name = $1"
+	renameSchemaPostgreSQLDialectSQL         = "alter schema %v rename to %v"
+	dropSchemaPostgreSQLDialectSQL           = "drop schema %v cascade"
+	updateMigrationPostgreSQLDialectSQL      = "update %v.%v set contents = $1, checksum = $2 where filename = $3 and type in ($4, $5)"
 	insertVersionPostgreSQLDialectSQL        = "insert into %v.%v (name) values ($1) returning id"
-	selectVersionsByFilePostgreSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
-	selectVersionByIDPostgreSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
-	selectMigrationByIDPostgreSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from %v.%v where id = $1"
+	selectVersionsByFilePostgreSQLDialectSQL = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id in (select version_id from %v.%v where filename = $1) order by vid desc, mid asc"
+	selectVersionByIDPostgreSQLDialectSQL    = "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from %v.%v mv left join %v.%v mm on mv.id = mm.version_id where mv.id = $1 order by mid asc"
+	selectMigrationByIDPostgreSQLDialectSQL  = "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from %v.%v where id = $1"
+	addColumnPostgreSQLDialectSQL            = "alter table %v.%v add column if not exists %v %v"
+	lockPostgreSQLDialectSQL                 = "select case when pg_try_advisory_lock(hashtext('%v')) then 1 else 0 end"
+	unlockPostgreSQLDialectSQL               = "select pg_advisory_unlock(hashtext('%v'))"
+	insertLockHolderPostgreSQLDialectSQL     = "insert into %v.%v (holder) values ($1)"
+	insertJobPostgreSQLDialectSQL            = "insert into %v.%v (state, version_name) values ($1, $2) returning id"
+	updateJobPostgreSQLDialectSQL            = "update %v.%v set state = $1, migrations_total = $2, migrations_applied = $3, version_id = $4, summary = $5, error = $6, updated = current_timestamp where id = $7"
+	selectJobByIDPostgreSQLDialectSQL        = "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from %v.%v where id = $1"
+	cancelJobPostgreSQLDialectSQL            = "update %v.%v set cancel_requested = 1, updated = current_timestamp where id = $1 and state in ($2, $3)"
+	failStaleJobsPostgreSQLDialectSQL        = "update %v.%v set state = $1, error = $2, updated = current_timestamp where state in ($3, $4) and updated < current_timestamp - make_interval(secs => $5)"
+	statementTimeoutPostgreSQLDialectSQL     = "set statement_timeout = %d"
+	lockTimeoutPostgreSQLDialectSQL          = "set lock_timeout = %d"
 	versionsTableSetupPostgreSQLDialectSQL   = `
 do $$
 begin
@@ -46,16 +65,122 @@ func (pd *postgreSQLDialect) LastInsertIDSupported() bool {
 	return false
 }
 
+// TransactionalDDLSupported instructs migrator if DDL statements can be rolled back, PostgreSQL runs DDL statements in transactions
+func (pd *postgreSQLDialect) TransactionalDDLSupported() bool {
+	return true
+}
+
 // GetMigrationInsertSQL returns PostgreSQL-specific migration insert SQL statement
 func (pd *postgreSQLDialect) GetMigrationInsertSQL() string {
 	return fmt.Sprintf(insertMigrationPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
 
+// GetMigrationUpdateSQL returns PostgreSQL-specific SQL statement which updates contents and checksum of applied migrations
+func (pd *postgreSQLDialect) GetMigrationUpdateSQL() string {
+	return fmt.Sprintf(updateMigrationPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
+}
+
+// SplitStatements splits PostgreSQL migration into statements, dollar-quoted strings and nested comments are supported
+func (pd *postgreSQLDialect) SplitStatements(contents string) []statement {
+	return statementSplitter{delimiter: ";", dollarQuoting: true, nestedComments: true}.split(contents)
+}
+
+// GetLockSQL returns PostgreSQL-specific SQL which tries to acquire session-level advisory lock, returns 1 when acquired
+func (pd *postgreSQLDialect) GetLockSQL() string {
+	return fmt.Sprintf(lockPostgreSQLDialectSQL, migrationLockName)
+}
+
+// GetUnlockSQL returns PostgreSQL-specific SQL which releases session-level advisory lock
+func (pd *postgreSQLDialect) GetUnlockSQL() string {
+	return fmt.Sprintf(unlockPostgreSQLDialectSQL, migrationLockName)
+}
+
+// GetLockHolderInsertSQL returns PostgreSQL-specific SQL statement which records holder of migration lock
+func (pd *postgreSQLDialect) GetLockHolderInsertSQL() string {
+	return fmt.Sprintf(insertLockHolderPostgreSQLDialectSQL, migratorSchema, migratorLocksTable)
+}
+
+// GetJobInsertSQL returns PostgreSQL-specific SQL statement which creates new job and returns its ID
+func (pd *postgreSQLDialect) GetJobInsertSQL() string {
+	return fmt.Sprintf(insertJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobUpdateSQL returns PostgreSQL-specific SQL statement which updates state, progress, and results of job
+func (pd *postgreSQLDialect) GetJobUpdateSQL() string {
+	return fmt.Sprintf(updateJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobByIDSQL returns PostgreSQL-specific SQL statement which returns job by its ID
+func (pd *postgreSQLDialect) GetJobByIDSQL() string {
+	return fmt.Sprintf(selectJobByIDPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetJobCancelSQL returns PostgreSQL-specific SQL statement which requests cancellation of queued or running job
+func (pd *postgreSQLDialect) GetJobCancelSQL() string {
+	return fmt.Sprintf(cancelJobPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+// GetStaleJobsFailSQL returns PostgreSQL-specific SQL statement which fails queued or running jobs not updated for given number of seconds
+// staleness threshold is computed with make_interval as PostgreSQL cannot bind a parameter inside an interval literal
+func (pd *postgreSQLDialect) GetStaleJobsFailSQL() string {
+	return fmt.Sprintf(failStaleJobsPostgreSQLDialectSQL, migratorSchema, migratorJobsTable)
+}
+
+const (
+	// SQLSTATE codes of PostgreSQL errors after which transaction can be run again
+	serializationFailurePostgreSQLCode = "40001"
+	deadlockDetectedPostgreSQLCode     = "40P01"
+)
+
+// IsTransientError returns true for PostgreSQL serialization failures, deadlocks, and connection errors
+func (pd *postgreSQLDialect) IsTransientError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailurePostgreSQLCode || pgErr.Code == deadlockDetectedPostgreSQLCode
+	}
+	return isConnectionError(err)
+}
+
+// GetStatementTimeoutSQL returns PostgreSQL-specific SQL statements which abort statements (and lock waits) running longer than timeout
+func (pd *postgreSQLDialect) GetStatementTimeoutSQL(timeout time.Duration) []string {
+	milliseconds := timeout.Milliseconds()
+	return []string{fmt.Sprintf(statementTimeoutPostgreSQLDialectSQL, milliseconds), fmt.Sprintf(lockTimeoutPostgreSQLDialectSQL, milliseconds)}
+}
+
+// GetResetStatementTimeoutSQL returns PostgreSQL-specific SQL statements which restore default statement and lock timeouts
+func (pd *postgreSQLDialect) GetResetStatementTimeoutSQL() []string {
+	return []string{"set statement_timeout to default", "set lock_timeout to default"}
+}
+
 // GetTenantInsertSQL returns PostgreSQL-specific migrator's default tenant insert SQL statement
 func (pd *postgreSQLDialect) GetTenantInsertSQL() string {
 	return fmt.Sprintf(insertTenantPostgreSQLDialectSQL, migratorSchema, migratorTenantsTable)
 }
 
+// GetTenantDeleteSQL returns PostgreSQL-specific migrator's default tenant delete SQL statement
+// tenant name is bound using PostgreSQL's numbered $1 placeholder
+func (pd *postgreSQLDialect) GetTenantDeleteSQL() string {
+	return fmt.Sprintf(deleteTenantPostgreSQLDialectSQL, migratorSchema, migratorTenantsTable)
+}
+
+// GetRenameSchemaSQL returns PostgreSQL-specific SQL which renames schema
+// PostgreSQL renames schema in place with alter schema, all objects stay in it and no data is moved
+func (pd *postgreSQLDialect) GetRenameSchemaSQL(schema, newSchema string) []string {
+	if !isValidIdentifier(schema) || !isValidIdentifier(newSchema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v, %v", schema, newSchema))
+	}
+	return []string{fmt.Sprintf(renameSchemaPostgreSQLDialectSQL, schema, newSchema)}
+}
+
+// GetDropSchemaSQL returns PostgreSQL-specific SQL which drops schema together with all its objects
+// cascade is used so that tables, views, functions, and objects in other schemas depending on them are dropped too
+func (pd *postgreSQLDialect) GetDropSchemaSQL(schema string) []string {
+	if !isValidIdentifier(schema) {
+		panic(fmt.Sprintf("Schema name contains invalid characters: %v", schema))
+	}
+	return []string{fmt.Sprintf(dropSchemaPostgreSQLDialectSQL, schema)}
+}
+
 func (pd *postgreSQLDialect) GetVersionInsertSQL() string {
 	return fmt.Sprintf(insertVersionPostgreSQLDialectSQL, migratorSchema, migratorVersionsTable)
 }
@@ -80,3 +205,8 @@ func (pd *postgreSQLDialect) GetVersionByIDSQL() string {
 func (pd *postgreSQLDialect) GetMigrationByIDSQL() string {
 	return fmt.Sprintf(selectMigrationByIDPostgreSQLDialectSQL, migratorSchema, migratorMigrationsTable)
 }
+
+// GetAddColumnSQL returns PostgreSQL-specific SQL which adds column to migrator's table if it does not exist
+func (pd *postgreSQLDialect) GetAddColumnSQL(table, column, definition string) []string {
+	return []string{fmt.Sprintf(addColumnPostgreSQLDialectSQL, migratorSchema, table, column, definition)}
+}
@@ -1,8 +1,13 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,6 +30,17 @@ func TestPostgreSQLLastInsertIdSupported(t *testing.T) {
 	assert.False(t, lastInsertIDSupported)
 }
 
+func TestPostgreSQLTransactionalDDLSupported(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	transactionalDDLSupported := dialect.TransactionalDDLSupported()
+
+	assert.True(t, transactionalDDLSupported)
+}
+
 func TestPostgreSQLGetMigrationInsertSQL(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-postgresql.yaml")
 	assert.Nil(t, err)
@@ -35,7 +51,63 @@ func TestPostgreSQLGetMigrationInsertSQL(t *testing.T) {
 
 	insertMigrationSQL := dialect.GetMigrationInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8)", insertMigrationSQL)
+	assert.Equal(t, "insert into migrator.migrator_migrations (name, source_dir, filename, type, db_schema, contents, checksum, down_contents, version_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)", insertMigrationSQL)
+}
+
+func TestPostgreSQLGetMigrationUpdateSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+
+	dialect := newDialect(config)
+
+	updateMigrationSQL := dialect.GetMigrationUpdateSQL()
+
+	assert.Equal(t, "update migrator.migrator_migrations set contents = $1, checksum = $2 where filename = $3 and type in ($4, $5)", updateMigrationSQL)
+}
+
+func TestPostgreSQLGetTenantDeleteSQLDefault(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+
+	dialect := newDialect(config)
+
+	tenantDeleteSQL := dialect.GetTenantDeleteSQL()
+
+	assert.Equal(t, "delete from migrator.migrator_tenants where name = $1", tenantDeleteSQL)
+}
+
+func TestPostgreSQLGetRenameSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+
+	dialect := newDialect(config)
+
+	renameSchemaSQL := dialect.GetRenameSchemaSQL("abc", "abc_archived")
+
+	assert.Equal(t, []string{"alter schema abc rename to abc_archived"}, renameSchemaSQL)
+
+	assert.PanicsWithValue(t, "Schema name contains invalid characters: abc, abc;drop", func() {
+		dialect.GetRenameSchemaSQL("abc", "abc;drop")
+	})
+}
+
+func TestPostgreSQLGetDropSchemaSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+
+	dialect := newDialect(config)
+
+	dropSchemaSQL := dialect.GetDropSchemaSQL("abc")
+
+	assert.Equal(t, []string{"drop schema abc cascade"}, dropSchemaSQL)
 }
 
 func TestPostgreSQLGetTenantInsertSQLDefault(t *testing.T) {
@@ -49,7 +121,7 @@ func TestPostgreSQLGetTenantInsertSQLDefault(t *testing.T) {
 
 	tenantInsertSQL := connector.getTenantInsertSQL()
 
-	assert.Equal(t, "insert into migrator.migrator_tenants (name) values ($1)", tenantInsertSQL)
+	assert.Equal(t, "insert into migrator.migrator_tenants (name, metadata) values ($1, $2)", tenantInsertSQL)
 }
 
 func TestPostgreSQLGetVersionInsertSQL(t *testing.T) {
@@ -109,7 +181,7 @@ func TestPostgreSQLGetVersionsByFileSQL(t *testing.T) {
 
 	versionsByFile := dialect.GetVersionsByFileSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = $1) order by vid desc, mid asc", versionsByFile)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id in (select version_id from migrator.migrator_migrations where filename = $1) order by vid desc, mid asc", versionsByFile)
 }
 
 func TestPostgreSQLGetVersionByIDSQL(t *testing.T) {
@@ -121,7 +193,7 @@ func TestPostgreSQLGetVersionByIDSQL(t *testing.T) {
 
 	versionsByID := dialect.GetVersionByIDSQL()
 
-	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = $1 order by mid asc", versionsByID)
+	assert.Equal(t, "select mv.id as vid, mv.name as vname, mv.created as vcreated, mm.id as mid, mm.name, mm.source_dir, mm.filename, mm.type, mm.db_schema, mm.created, mm.contents, mm.checksum, mm.down_contents from migrator.migrator_versions mv left join migrator.migrator_migrations mm on mv.id = mm.version_id where mv.id = $1 order by mid asc", versionsByID)
 }
 
 func TestPostgreSQLGetMigrationByIDSQL(t *testing.T) {
@@ -133,5 +205,60 @@ func TestPostgreSQLGetMigrationByIDSQL(t *testing.T) {
 
 	migrationByID := dialect.GetMigrationByIDSQL()
 
-	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum from migrator.migrator_migrations where id = $1", migrationByID)
+	assert.Equal(t, "select id, name, source_dir, filename, type, db_schema, created, contents, checksum, down_contents from migrator.migrator_migrations where id = $1", migrationByID)
+}
+
+func TestPostgreSQLGetAddColumnSQL(t *testing.T) {
+	config, err := config.FromFile("../test/migrator-postgresql.yaml")
+	assert.Nil(t, err)
+
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	addColumnSQLs := dialect.GetAddColumnSQL("migrator_migrations", "down_contents", "text")
+
+	assert.Equal(t, []string{"alter table migrator.migrator_migrations add column if not exists down_contents text"}, addColumnSQLs)
+}
+
+func TestPostgreSQLGetLockSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "select case when pg_try_advisory_lock(hashtext('migrator')) then 1 else 0 end", dialect.GetLockSQL())
+	assert.Equal(t, "select pg_advisory_unlock(hashtext('migrator'))", dialect.GetUnlockSQL())
+	assert.Equal(t, "insert into migrator.migrator_locks (holder) values ($1)", dialect.GetLockHolderInsertSQL())
+}
+
+func TestPostgreSQLGetJobSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, "insert into migrator.migrator_jobs (state, version_name) values ($1, $2) returning id", dialect.GetJobInsertSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = $1, migrations_total = $2, migrations_applied = $3, version_id = $4, summary = $5, error = $6, updated = current_timestamp where id = $7", dialect.GetJobUpdateSQL())
+	assert.Equal(t, "select id, state, version_name, created, updated, migrations_total, migrations_applied, version_id, summary, error, cancel_requested from migrator.migrator_jobs where id = $1", dialect.GetJobByIDSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set cancel_requested = 1, updated = current_timestamp where id = $1 and state in ($2, $3)", dialect.GetJobCancelSQL())
+	assert.Equal(t, "update migrator.migrator_jobs set state = $1, error = $2, updated = current_timestamp where state in ($3, $4) and updated < current_timestamp - make_interval(secs => $5)", dialect.GetStaleJobsFailSQL())
+}
+
+func TestPostgreSQLGetStatementTimeoutSQL(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.Equal(t, []string{"set statement_timeout = 90000", "set lock_timeout = 90000"}, dialect.GetStatementTimeoutSQL(90*time.Second))
+	assert.Equal(t, []string{"set statement_timeout to default", "set lock_timeout to default"}, dialect.GetResetStatementTimeoutSQL())
+}
+
+func TestPostgreSQLIsTransientError(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+
+	assert.True(t, dialect.IsTransientError(&pgconn.PgError{Code: "40001"}))
+	assert.True(t, dialect.IsTransientError(fmt.Errorf("apply: %w", &pgconn.PgError{Code: "40P01"})))
+	assert.True(t, dialect.IsTransientError(fmt.Errorf("read tcp: %w", syscall.ECONNRESET)))
+	assert.False(t, dialect.IsTransientError(&pgconn.PgError{Code: "42P01"}))
+	assert.False(t, dialect.IsTransientError(errors.New("trouble maker")))
 }
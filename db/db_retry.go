@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/common"
+)
+
+// transientError is a panic value used when operation failed because of transient DB error
+// (deadlock, serialization failure, connection reset), operations run in a rolled back transaction can be retried
+type transientError struct {
+	message string
+}
+
+func (e *transientError) Error() string {
+	return e.message
+}
+
+// panicOnError panics with passed message, when err is transient the message is wrapped in transientError
+func (bc *baseConnector) panicOnError(err error, message string) {
+	if bc.dialect.IsTransientError(err) {
+		panic(&transientError{message})
+	}
+	panic(message)
+}
+
+// retry runs f and runs it again when f panics with transientError, f is run at most retryMaxAttempts times
+// and the wait between attempts starts at retryBackoff and doubles with every retry, other panics are not recovered
+// f must be safe to run again, typically it runs a transaction which was rolled back
+func (bc *baseConnector) retry(description string, f func()) {
+	maxAttempts := bc.config.GetRetryMaxAttempts()
+	backoff := bc.config.GetRetryBackoff()
+	for attempt := 1; ; attempt++ {
+		err := bc.recoverTransient(f)
+		if err == nil {
+			return
+		}
+		if attempt >= maxAttempts {
+			common.LogError(bc.ctx, "%v failed after %d attempts: %v", description, attempt, err.Error())
+			panic(err)
+		}
+		common.LogWarn(bc.ctx, "%v failed with transient error (attempt %d of %d), retrying in %v: %v", description, attempt, maxAttempts, backoff, err.Error())
+		select {
+		case <-bc.ctx.Done():
+			panic(fmt.Sprintf("%v cancelled while waiting for retry: %v", description, bc.ctx.Err()))
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// recoverTransient runs f and returns transientError if f panicked with it, other panics are propagated
+func (bc *baseConnector) recoverTransient(f func()) (err *transientError) {
+	defer func() {
+		if r := recover(); r != nil {
+			transient, ok := r.(*transientError)
+			if !ok {
+				panic(r)
+			}
+			err = transient
+		}
+	}()
+	f()
+	return nil
+}
+
+// rollbackProgress is deferred by operations which are retried and which don't run concurrently with other operations,
+// when operation panics the progress is restored to passed number of applied migrations as their transaction was rolled back
+func (bc *baseConnector) rollbackProgress(applied int32) {
+	if r := recover(); r != nil {
+		progress := common.GetProgress(bc.ctx)
+		progress.AddApplied(applied - progress.Applied())
+		panic(r)
+	}
+}
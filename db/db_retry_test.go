@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lukaszbudnik/migrator/common"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateVersionRetryTransientError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.RetryBackoff = 1
+	dialect := newDialect(config)
+	progress := &common.Progress{}
+	ctx := context.WithValue(newTestContext(), common.ProgressKey{}, progress)
+	connector := baseConnector{ctx, config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table public.orders (id int)"}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn+1), MigrationType: types.MigrationTypeSingleMigration, Contents: "update public.orders set id = 1"}
+	migrationsToApply := []types.Migration{m1, m2}
+
+	// first attempt is chosen as deadlock victim
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update public.orders").WillReturnError(&pgconn.PgError{Severity: "ERROR", Code: "40P01", Message: "deadlock detected"})
+	mock.ExpectRollback()
+	// second attempt succeeds
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("update public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "public", time.Now(), m1.Contents, m1.CheckSum, m1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, map[string][]types.Migration{}, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+	// migration applied in rolled back transaction is not counted twice
+	assert.Equal(t, int32(2), progress.Applied())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionRetryMaxAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.RetryMaxAttempts = 2
+	config.RetryBackoff = 1
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "update public.orders set id = 1"}
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectPrepare("insert into migrator.migrator_versions")
+		mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+		mock.ExpectPrepare("insert into migrator.migrator_migrations")
+		mock.ExpectExec("update public.orders").WillReturnError(&pgconn.PgError{Severity: "ERROR", Code: "40001", Message: "could not serialize access"})
+		mock.ExpectRollback()
+	}
+
+	assert.PanicsWithError(t, fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: ERROR: could not serialize access (SQLSTATE 40001)", m.File), func() {
+		connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m}, map[string][]types.Migration{}, false)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNoRetryOfOtherErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "update public.orders set id = 1"}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("update public.orders").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+
+	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: trouble maker", m.File), func() {
+		connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m}, map[string][]types.Migration{}, false)
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionRetryTenantTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.FailurePolicy = "continue"
+	config.RetryBackoff = 1
+	dialect := newDialect(config)
+	progress := &common.Progress{}
+	ctx := context.WithValue(newTestContext(), common.ProgressKey{}, progress)
+	connector := baseConnector{ctx, config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m},
+	}
+
+	// version
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectCommit()
+	// commit of tenant abc fails because connection was reset
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("write tcp: %w", syscall.ECONNRESET))
+	// tenant abc is retried
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "abc", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m}, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.TenantsSucceeded)
+	assert.Equal(t, int32(0), results.TenantsFailed)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+	assert.Equal(t, int32(1), progress.Applied())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+)
+
+// statement is a single SQL statement of a migration
+type statement struct {
+	sql string
+	// line (starting from 1) of migration contents on which statement's code starts
+	line int
+}
+
+// statementSplitter splits migration contents into statements, it understands
+// comments, string literals, quoted identifiers, and dialect-specific syntax described by its fields
+type statementSplitter struct {
+	// statements delimiter, empty delimiter means that statements are split only by batchSeparator
+	delimiter string
+	// batch separator which must be placed on its own line, for example MS SQL GO
+	batchSeparator string
+	// PostgreSQL dollar-quoted strings: $$...$$ and $tag$...$tag$
+	dollarQuoting bool
+	// PostgreSQL nested block comments: /* /* */ */
+	nestedComments bool
+	// MySQL DELIMITER command which changes delimiter
+	delimiterCommand bool
+	// MySQL backslash escapes in string literals
+	backslashEscapes bool
+	// MySQL # comments
+	hashComments bool
+	// MySQL `quoted` identifiers
+	backtickQuotes bool
+	// MS SQL [quoted] identifiers
+	bracketQuotes bool
+}
+
+var dollarQuoteTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// split returns statements of passed contents, statements which contain only whitespace and comments are skipped
+func (ss statementSplitter) split(contents string) []statement {
+	var statements []statement
+
+	delimiter := ss.delimiter
+	start := 0
+	codeLine := 0
+	line := 1
+	lineCounted := 0
+
+	currentLine := func(i int) int {
+		line += strings.Count(contents[lineCounted:i], "\n")
+		lineCounted = i
+		return line
+	}
+	markCode := func(i int) {
+		if codeLine == 0 {
+			codeLine = currentLine(i)
+		}
+	}
+	flush := func(end, next int) {
+		if codeLine > 0 {
+			statements = append(statements, statement{sql: strings.TrimSpace(contents[start:end]), line: codeLine})
+		}
+		start = next
+		codeLine = 0
+	}
+
+	i := 0
+	for i < len(contents) {
+		if i == 0 || contents[i-1] == '\n' {
+			end := strings.IndexByte(contents[i:], '\n')
+			if end == -1 {
+				end = len(contents)
+			} else {
+				end += i
+			}
+			trimmed := strings.TrimSpace(contents[i:end])
+			if ss.batchSeparator != "" && strings.EqualFold(trimmed, ss.batchSeparator) {
+				flush(i, end)
+				i = end
+				continue
+			}
+			if ss.delimiterCommand && len(trimmed) > len("delimiter ") && strings.EqualFold(trimmed[:len("delimiter ")], "delimiter ") {
+				flush(i, end)
+				delimiter = strings.TrimSpace(trimmed[len("delimiter "):])
+				i = end
+				continue
+			}
+		}
+
+		rest := contents[i:]
+		switch {
+		case strings.HasPrefix(rest, "--") || (ss.hashComments && rest[0] == '#'):
+			i = skipPast(contents, i, "\n")
+		case strings.HasPrefix(rest, "/*"):
+			i = ss.skipBlockComment(contents, i)
+		case rest[0] == '\'' || rest[0] == '"' || (ss.backtickQuotes && rest[0] == '`'):
+			markCode(i)
+			i = ss.skipQuoted(contents, i, rest[0])
+		case ss.bracketQuotes && rest[0] == '[':
+			markCode(i)
+			i = ss.skipQuoted(contents, i, ']')
+		case ss.dollarQuoting && rest[0] == '$' && (i == 0 || !isIdentifierChar(contents[i-1])) && dollarQuoteTag.MatchString(rest):
+			markCode(i)
+			tag := dollarQuoteTag.FindString(rest)
+			i = skipPast(contents, i+len(tag), tag)
+		case delimiter != "" && strings.HasPrefix(rest, delimiter):
+			flush(i, i+len(delimiter))
+			i += len(delimiter)
+		default:
+			if !isWhitespace(rest[0]) {
+				markCode(i)
+			}
+			i++
+		}
+	}
+	flush(len(contents), len(contents))
+
+	return statements
+}
+
+// skipBlockComment returns index just after block comment starting at i
+func (ss statementSplitter) skipBlockComment(contents string, i int) int {
+	depth := 0
+	for i < len(contents) {
+		switch {
+		case strings.HasPrefix(contents[i:], "/*"):
+			if depth == 0 || ss.nestedComments {
+				depth++
+			}
+			i += 2
+		case strings.HasPrefix(contents[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// skipQuoted returns index just after quoted string or identifier starting at i
+// closing quote can be escaped by doubling it or (when enabled) with backslash
+func (ss statementSplitter) skipQuoted(contents string, i int, closing byte) int {
+	i++
+	for i < len(contents) {
+		switch {
+		case ss.backslashEscapes && closing != '`' && contents[i] == '\\':
+			i += 2
+		case contents[i] == closing:
+			if i+1 < len(contents) && contents[i+1] == closing {
+				i += 2
+				continue
+			}
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(contents)
+}
+
+// skipPast returns index just after the first occurrence of terminator found at or after i
+func skipPast(contents string, i int, terminator string) int {
+	end := strings.Index(contents[i:], terminator)
+	if end == -1 {
+		return len(contents)
+	}
+	return i + end + len(terminator)
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
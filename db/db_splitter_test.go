@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatementsPostgreSQL(t *testing.T) {
+	config := &config.Config{Driver: "postgres"}
+	dialect := newDialect(config)
+
+	contents := `-- migrator:depends-on: ref/201602160001.sql
+create table {schema}.abc (id int, name text default 'a;b');
+/* block /* nested; */ comment; */
+create function {schema}.f() returns int as $body$
+begin
+  return 1;
+end;
+$body$ language plpgsql;
+
+do $$ begin perform 1; end $$;
+insert into {schema}.abc values ($1, 'it''s; fine');
+-- trailing comment;
+`
+	statements := dialect.SplitStatements(contents)
+
+	assert.Len(t, statements, 4)
+	assert.Equal(t, statement{sql: "-- migrator:depends-on: ref/201602160001.sql\ncreate table {schema}.abc (id int, name text default 'a;b')", line: 2}, statements[0])
+	assert.Equal(t, "/* block /* nested; */ comment; */\ncreate function {schema}.f() returns int as $body$\nbegin\n  return 1;\nend;\n$body$ language plpgsql", statements[1].sql)
+	assert.Equal(t, 4, statements[1].line)
+	assert.Equal(t, statement{sql: "do $$ begin perform 1; end $$", line: 10}, statements[2])
+	assert.Equal(t, statement{sql: "insert into {schema}.abc values ($1, 'it''s; fine')", line: 11}, statements[3])
+}
+
+func TestSplitStatementsMySQL(t *testing.T) {
+	config := &config.Config{Driver: "mysql"}
+	dialect := newDialect(config)
+
+	contents := `# comment; with semicolon
+create table abc (id int, ` + "`weird;name`" + ` text);
+insert into abc values (1, 'escaped \' quote; here');
+DELIMITER $$
+create procedure p()
+begin
+  select 1;
+  select 2;
+end$$
+DELIMITER ;
+call p();`
+	statements := dialect.SplitStatements(contents)
+
+	assert.Len(t, statements, 4)
+	assert.Equal(t, statement{sql: "# comment; with semicolon\ncreate table abc (id int, `weird;name` text)", line: 2}, statements[0])
+	assert.Equal(t, statement{sql: "insert into abc values (1, 'escaped \\' quote; here')", line: 3}, statements[1])
+	assert.Equal(t, statement{sql: "create procedure p()\nbegin\n  select 1;\n  select 2;\nend", line: 5}, statements[2])
+	assert.Equal(t, statement{sql: "call p()", line: 11}, statements[3])
+}
+
+func TestSplitStatementsMSSQL(t *testing.T) {
+	config := &config.Config{Driver: "sqlserver"}
+	dialect := newDialect(config)
+
+	contents := `create table [{schema}].[go] (id int);
+insert into [{schema}].[go] values (1);
+GO
+-- GO in a comment
+create procedure [{schema}].p as
+begin
+  select 'GO
+';
+end
+  go
+
+`
+	statements := dialect.SplitStatements(contents)
+
+	assert.Len(t, statements, 2)
+	assert.Equal(t, statement{sql: "create table [{schema}].[go] (id int);\ninsert into [{schema}].[go] values (1);", line: 1}, statements[0])
+	assert.Equal(t, statement{sql: "-- GO in a comment\ncreate procedure [{schema}].p as\nbegin\n  select 'GO\n';\nend", line: 5}, statements[1])
+}
+
+func TestSplitStatementsCommentsOnly(t *testing.T) {
+	config := &config.Config{Driver: "postgres"}
+	dialect := newDialect(config)
+
+	statements := dialect.SplitStatements("-- nothing to do;\n/* really; */\n\n")
+
+	assert.Len(t, statements, 0)
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+)
+
+// templateData is passed to migrations rendered as Go text/template
+type templateData struct {
+	// Schema is the schema (database for MongoDB) in which migration is applied
+	Schema string
+	// Tenant is the name of the tenant, empty for single migrations and scripts
+	Tenant string
+	// Metadata is the metadata of the tenant, empty for single migrations and scripts
+	Metadata types.TenantMetadata
+	// Vars are variables from migrator.yaml
+	Vars map[string]string
+	// Env are environment variables of migrator process whose names start with templateEnvPrefix from migrator.yaml
+	Env map[string]string
+}
+
+// renderMigration renders passed contents of migration m as Go text/template when templates are enabled,
+// migration entries store raw contents and checksums are calculated from raw contents too
+func renderMigration(config *config.Config, m types.Migration, contents, schema string, metadata types.TenantMetadata) string {
+	if !config.Templates {
+		return contents
+	}
+
+	data := templateData{Schema: schema, Metadata: types.TenantMetadata{}, Vars: config.Variables, Env: environ(config.TemplateEnvPrefix)}
+	if isTenantMigration(m) || isTenantCallback(m) {
+		data.Tenant = schema
+		if metadata != nil {
+			data.Metadata = metadata
+		}
+	}
+
+	tmpl, err := template.New(m.File).Option("missingkey=error").Parse(contents)
+	if err != nil {
+		panic(fmt.Sprintf("Could not render template of migration %v: %v", m.File, err))
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		panic(fmt.Sprintf("Could not render template of migration %v: %v", m.File, err))
+	}
+	return rendered.String()
+}
+
+// usesTenantMetadata returns true when tenant migration or script is rendered as template which references tenant metadata,
+// metadata of tenants is loaded only for such migrations
+func usesTenantMetadata(config *config.Config, m types.Migration, contents string) bool {
+	return config.Templates && (isTenantMigration(m) || isTenantCallback(m)) && strings.Contains(contents, ".Metadata")
+}
+
+// tenantsMetadata returns metadata of passed tenants by tenant name
+func tenantsMetadata(tenants []types.Tenant) map[string]types.TenantMetadata {
+	metadata := map[string]types.TenantMetadata{}
+	for _, t := range tenants {
+		metadata[t.Name] = t.Metadata
+	}
+	return metadata
+}
+
+func isTenantMigration(m types.Migration) bool {
+	return m.MigrationType == types.MigrationTypeTenantMigration || m.MigrationType == types.MigrationTypeTenantScript || m.MigrationType == types.MigrationTypeTenantRepeatable
+}
+
+// environ returns env variables whose names start with prefix, env of migrator process contains credentials
+// (for example DB passwords or cloud keys) and it is not exposed to templates unless explicitly allowed
+func environ(prefix string) map[string]string {
+	env := map[string]string{}
+	if prefix == "" {
+		return env
+	}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, prefix) {
+			env[k] = v
+		}
+	}
+	return env
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMigrationTemplatesDisabled(t *testing.T) {
+	config := &config.Config{Variables: map[string]string{"owner": "app"}}
+	m := types.Migration{File: "ref/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+
+	contents := "grant select on {schema}.orders to {{.Vars.owner}}"
+	assert.Equal(t, contents, renderMigration(config, m, contents, "ref", nil))
+}
+
+func TestRenderMigration(t *testing.T) {
+	os.Setenv("MIGRATOR_TEST_REGION", "eu-central-1")
+	config := &config.Config{Templates: true, Variables: map[string]string{"owner": "app"}, TemplateEnvPrefix: "MIGRATOR_TEST_"}
+	m := types.Migration{File: "tenants/201602220000.sql", MigrationType: types.MigrationTypeTenantMigration}
+
+	contents := "grant select on {schema}.orders to {{.Vars.owner}}; -- {{.Tenant}} {{.Schema}} {{.Env.MIGRATOR_TEST_REGION}}"
+	assert.Equal(t, "grant select on {schema}.orders to app; -- abc abc eu-central-1", renderMigration(config, m, contents, "abc", nil))
+
+	m = types.Migration{File: "ref/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	assert.Equal(t, "grant select on {schema}.orders to app; --  ref eu-central-1", renderMigration(config, m, contents, "ref", nil))
+}
+
+func TestRenderMigrationEnvPrefix(t *testing.T) {
+	os.Setenv("MIGRATOR_TEST_REGION", "eu-central-1")
+	os.Setenv("MIGRATOR_SECRET_PASSWORD", "secret")
+	m := types.Migration{File: "ref/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+
+	// env variables without prefix are not available
+	config := &config.Config{Templates: true, TemplateEnvPrefix: "MIGRATOR_TEST_"}
+	assert.Equal(t, "eu-central-1", renderMigration(config, m, "{{.Env.MIGRATOR_TEST_REGION}}", "ref", nil))
+	assert.Panics(t, func() {
+		renderMigration(config, m, "{{.Env.MIGRATOR_SECRET_PASSWORD}}", "ref", nil)
+	})
+
+	// no env variables are available by default
+	config.TemplateEnvPrefix = ""
+	assert.Panics(t, func() {
+		renderMigration(config, m, "{{.Env.MIGRATOR_TEST_REGION}}", "ref", nil)
+	})
+}
+
+func TestRenderMigrationTenantMetadata(t *testing.T) {
+	config := &config.Config{Templates: true}
+	m := types.Migration{File: "tenants/201602220000.sql", MigrationType: types.MigrationTypeTenantMigration}
+
+	contents := "{{if eq .Metadata.tier \"enterprise\"}}create table {schema}.audit (id int){{end}}"
+	assert.Equal(t, "create table {schema}.audit (id int)", renderMigration(config, m, contents, "abc", types.TenantMetadata{"tier": "enterprise"}))
+	assert.True(t, usesTenantMetadata(config, m, contents))
+
+	// metadata of tenant without given key cannot be referenced
+	assert.Panics(t, func() {
+		renderMigration(config, m, contents, "abc", nil)
+	})
+
+	// single migrations don't have tenant metadata
+	m = types.Migration{File: "ref/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+	assert.False(t, usesTenantMetadata(config, m, contents))
+}
+
+func TestRenderMigrationErrors(t *testing.T) {
+	config := &config.Config{Templates: true}
+	m := types.Migration{File: "ref/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration}
+
+	assert.PanicsWithValue(t, `Could not render template of migration ref/201602220000.sql: template: ref/201602220000.sql:1: bad character U+007D '}'`, func() {
+		renderMigration(config, m, "select {{.Schema}", "ref", nil)
+	})
+	assert.Panics(t, func() {
+		renderMigration(config, m, "select {{.Vars.missing}}", "ref", nil)
+	})
+}
+
+func TestCreateVersionRendersTemplates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.Templates = true
+	config.Variables = map[string]string{"owner": "app"}
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "grant select on {schema}.orders to {{.Vars.owner}}", CheckSum: "sha256"}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	// rendered contents are executed
+	mock.ExpectExec("grant select on public.orders to app").WillReturnResult(sqlmock.NewResult(0, 0))
+	// raw template and its checksum are stored
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, "public", m.Contents, m.CheckSum, m.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "public", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	_, version := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m}, map[string][]types.Migration{}, false)
+	assert.NotNil(t, version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateTenantRendersTenantMetadata(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.Templates = true
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (region varchar(20) default '{{.Metadata.region}}')"}
+	tenant := types.Tenant{Name: "abc", Metadata: types.TenantMetadata{"region": "eu"}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_tenants")
+	mock.ExpectPrepare("insert into migrator.migrator_tenants").ExpectExec().WithArgs("abc", `{"region":"eu"}`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	// new tenant is read in the same transaction
+	tenants := sqlmock.NewRows([]string{"name", "metadata"}).AddRow("abc", `{"region":"eu"}`)
+	mock.ExpectQuery("select name, metadata from migrator.migrator_tenants").WillReturnRows(tenants)
+	mock.ExpectExec("create table abc.orders \\(region varchar\\(20\\) default 'eu'\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, "abc", time.Now(), m.Contents, m.CheckSum, m.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	_, version := connector.CreateTenant(tenant, "commit-sha", types.ActionApply, []types.Migration{m}, false)
+	assert.NotNil(t, version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
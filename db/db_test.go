@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -77,15 +78,15 @@ func TestCreateVersionDryRunMode(t *testing.T) {
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, true)
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, nil, true)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -118,14 +119,14 @@ func TestCreateVersionSyncMode(t *testing.T) {
 	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit()
 
 	// sync the results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateVersion("commit-sha", types.ActionSync, migrationsToApply, false)
+	results, version := connector.CreateVersion("commit-sha", types.ActionSync, migrationsToApply, nil, false)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -136,6 +137,334 @@ func TestCreateVersionSyncMode(t *testing.T) {
 	}
 }
 
+func TestCreateVersionTenantMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (456, '456') "}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+1), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.settings values (789, '789') "}
+	migrationsToApply := []types.Migration{m1, m2}
+	// m1 was already applied in tenant abc
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m2},
+		"def": {m1, m2},
+	}
+
+	// tenants are not fetched from DB
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	// migrations
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("insert into def.settings values \\(456").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "def", m1.Contents, m1.CheckSum, m1.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into abc.settings values \\(789").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, "abc", m2.Contents, m2.CheckSum, m2.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into def.settings values \\(789").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, "def", m2.Contents, m2.CheckSum, m2.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "def", time.Now(), m1.Contents, m1.CheckSum, m1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(2), results.Tenants)
+	assert.Equal(t, int32(2), results.TenantMigrations)
+	assert.Equal(t, int32(3), results.TenantMigrationsTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNonTransactionalMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+1), MigrationType: types.MigrationTypeTenantMigration, Contents: "create index concurrently orders_idx on {schema}.orders (id)", NoTransaction: true}
+	m3 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+2), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+2), MigrationType: types.MigrationTypeTenantMigration, Contents: "insert into {schema}.orders values (1)"}
+	migrationsToApply := []types.Migration{m1, m2, m3}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m1, m2, m3},
+	}
+
+	// version is created and committed in its own transaction
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectCommit()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	// first transactional segment
+	mock.ExpectBegin()
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "abc", m1.Contents, m1.CheckSum, m1.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// non-transactional migration is applied on a dedicated connection
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create index concurrently orders_idx on abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, "abc", m2.Contents, m2.CheckSum, m2.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// second transactional segment
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m3.Name, m3.SourceDir, m3.File, m3.MigrationType, "abc", m3.Contents, m3.CheckSum, m3.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "abc", time.Now(), m1.Contents, m1.CheckSum, m1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(3), results.TenantMigrationsTotal)
+	assert.Equal(t, []string{m2.File}, results.NonTransactionalMigrations)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionNonTransactionalFailurePolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.TenantConcurrency = 2
+	config.FailurePolicy = "continue"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m1 := types.Migration{Name: "201602220001.sql", SourceDir: "tenants", File: "tenants/201602220001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create index concurrently orders_idx on {schema}.orders (id)", NoTransaction: true}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m1},
+		"def": {m1},
+	}
+
+	// version is rejected before anything is applied, also in dry-run mode
+	for _, dryRun := range []bool{false, true} {
+		assert.PanicsWithValue(t, "Version commit-sha contains non-transactional migrations which cannot be applied with failurePolicy continue", func() {
+			connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m1}, tenantMigrations, dryRun)
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionTenantConcurrency(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	// tenants are migrated in parallel
+	mock.MatchExpectationsInOrder(false)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.TenantConcurrency = 2
+	config.FailurePolicy = "continue"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table public.orders (id int)"}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn+1), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	migrationsToApply := []types.Migration{m1, m2}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m2},
+		"def": {m2},
+	}
+
+	// version and single migrations
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "public", m1.Contents, m1.CheckSum, m1.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// tenant abc succeeds
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table abc.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, "abc", m2.Contents, m2.CheckSum, m2.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// tenant def fails
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table def.orders").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+	// failure of tenant def is recorded
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, types.MigrationTypeTenantFailure, "def", fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: trouble maker", m2.File), "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "public", time.Now(), m1.Contents, m1.CheckSum, m1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, tenantMigrations, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.SingleMigrations)
+	assert.Equal(t, int32(1), results.TenantMigrations)
+	assert.Equal(t, int32(1), results.TenantMigrationsTotal)
+	assert.Equal(t, int32(1), results.TenantsSucceeded)
+	assert.Equal(t, int32(1), results.TenantsFailed)
+	assert.Equal(t, []types.TenantFailure{{Tenant: "def", Error: fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: trouble maker", m2.File)}}, results.TenantFailures)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionFailurePolicyStopAfterN(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.FailurePolicy = "stopAfterN"
+	config.MaxTenantFailures = 1
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.orders (id int)"}
+	migrationsToApply := []types.Migration{m1}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {m1},
+		"def": {m1},
+	}
+
+	// version
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectCommit()
+	// tenant abc fails
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create table abc.orders").WillReturnError(errors.New("trouble maker"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m1.Name, m1.SourceDir, m1.File, types.MigrationTypeTenantFailure, "abc", sqlmock.AnyArg(), "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// tenant def is skipped and recorded as failed
+	mock.ExpectBegin()
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m1.Name, m1.SourceDir, m1.File, types.MigrationTypeTenantFailure, "def", "tenant skipped, 1 tenants already failed", "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, types.MigrationTypeTenantFailure, "abc", time.Now(), "trouble maker", "", "")
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, tenantMigrations, false)
+	assert.True(t, version.Partial)
+	assert.Equal(t, int32(0), results.TenantsSucceeded)
+	assert.Equal(t, int32(2), results.TenantsFailed)
+	assert.Equal(t, int32(0), results.TenantMigrationsTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionStatementTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.StatementTimeout = 60
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	// m1 uses global statement timeout, m2 overrides it
+	m1 := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table public.orders (id int)"}
+	m2 := types.Migration{Name: fmt.Sprintf("%v.sql", tn+1), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn+1), MigrationType: types.MigrationTypeSingleMigration, Contents: "alter table public.orders add column name text", Timeout: 2 * time.Second}
+	migrationsToApply := []types.Migration{m1, m2}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set statement_timeout = 60000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout = 60000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set statement_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "public", m1.Contents, m1.CheckSum, m1.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set statement_timeout = 2000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout = 2000").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("alter table public.orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set statement_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout to default").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(m2.Name, m2.SourceDir, m2.File, m2.MigrationType, "public", m2.Contents, m2.CheckSum, m2.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m1.Name, m1.SourceDir, m1.File, m1.MigrationType, "public", time.Now(), m1.Contents, m1.CheckSum, m1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, migrationsToApply, map[string][]types.Migration{}, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(2), results.MigrationsGrandTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateVersionStatementTimeoutExceeded(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table public.orders (id int)", Timeout: 10 * time.Millisecond}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("set statement_timeout = 10").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("set lock_timeout = 10").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table public.orders").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	assert.PanicsWithValue(t, fmt.Sprintf("SQL migration %v failed at statement 1 (line 1) with error: statement timeout of 10ms exceeded: canceling query due to user request", m.File), func() {
+		connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{m}, map[string][]types.Migration{}, false)
+	})
+}
+
+func TestSplitIntoSegments(t *testing.T) {
+	m1 := types.Migration{File: "a"}
+	m2 := types.Migration{File: "b", NoTransaction: true}
+	m3 := types.Migration{File: "c", NoTransaction: true}
+	m4 := types.Migration{File: "d"}
+	m5 := types.Migration{File: "e"}
+
+	segments := splitIntoSegments([]types.Migration{m1, m2, m3, m4, m5})
+
+	assert.Equal(t, [][]types.Migration{{m1}, {m2}, {m3}, {m4, m5}}, segments)
+}
+
 func TestGetTenantsSQLOverride(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-overrides.yaml")
 	assert.Nil(t, err)
@@ -149,6 +478,76 @@ func TestGetTenantsSQLOverride(t *testing.T) {
 	assert.Equal(t, "select somename from someschema.sometable", tenantSelectSQL)
 }
 
+func TestGetTenantsMetadata(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	rows := sqlmock.NewRows([]string{"name", "metadata"}).AddRow("abc", `{"tier": "enterprise", "region": "eu"}`).AddRow("def", nil)
+	mock.ExpectQuery("select name, metadata from migrator.migrator_tenants").WillReturnRows(rows)
+
+	tenants := connector.GetTenants()
+
+	assert.Equal(t, []types.Tenant{{Name: "abc", Metadata: types.TenantMetadata{"tier": "enterprise", "region": "eu"}}, {Name: "def", Metadata: types.TenantMetadata{}}}, tenants)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetTenantsMetadataColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.TenantSelect = "select name, region, shard from public.tenants"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	rows := sqlmock.NewRows([]string{"name", "region", "shard"}).AddRow("abc", "eu", 3).AddRow("def", nil, 1)
+	mock.ExpectQuery("select name, region, shard from public.tenants").WillReturnRows(rows)
+
+	tenants := connector.GetTenants()
+
+	assert.Equal(t, []types.Tenant{{Name: "abc", Metadata: types.TenantMetadata{"region": "eu", "shard": "3"}}, {Name: "def", Metadata: types.TenantMetadata{"shard": "1"}}}, tenants)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestTenantInsertArgs(t *testing.T) {
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, nil, true}
+
+	tenant := types.Tenant{Name: "abc", Metadata: types.TenantMetadata{"tier": "enterprise"}}
+	assert.Equal(t, []interface{}{"abc", sql.NullString{String: `{"tier":"enterprise"}`, Valid: true}}, connector.tenantInsertArgs(tenant))
+	assert.Equal(t, []interface{}{"abc", sql.NullString{}}, connector.tenantInsertArgs(types.Tenant{Name: "abc"}))
+
+	// custom tenant insert takes metadata only when it is passed
+	config.TenantInsert = "insert into public.tenants (name) values ($1)"
+	assert.Equal(t, []interface{}{"abc"}, connector.tenantInsertArgs(types.Tenant{Name: "abc"}))
+	assert.Equal(t, []interface{}{"abc", sql.NullString{String: `{"tier":"enterprise"}`, Valid: true}}, connector.tenantInsertArgs(tenant))
+}
+
+func TestAllTenantsMigrationsTenantSelectors(t *testing.T) {
+	m1 := types.Migration{Name: "001.sql", SourceDir: "tenants", File: "tenants/001.sql", MigrationType: types.MigrationTypeTenantMigration}
+	m2 := types.Migration{Name: "002.sql", SourceDir: "tenants", File: "tenants/002.sql", MigrationType: types.MigrationTypeTenantMigration, TenantSelector: "tier=enterprise"}
+	tenants := []types.Tenant{{Name: "abc", Metadata: types.TenantMetadata{"tier": "enterprise"}}, {Name: "def"}}
+
+	tenantMigrations := allTenantsMigrations(tenants, []types.Migration{m1, m2})
+
+	assert.Equal(t, []types.Migration{m1, m2}, tenantMigrations["abc"])
+	assert.Equal(t, []types.Migration{m1}, tenantMigrations["def"])
+}
+
 func TestGetSchemaPlaceHolderDefault(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-postgresql.yaml")
 	assert.Nil(t, err)
@@ -194,22 +593,22 @@ func TestCreateTenantDryRunMode(t *testing.T) {
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant, nil).WillReturnResult(sqlmock.NewResult(1, 1))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
 	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
 	mock.ExpectExec("insert into").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	// dry-run mode calls rollback instead of commit
 	mock.ExpectRollback()
 
 	// however the results contain correct dry-run data like number of applied migrations/scripts
-	results, version := connector.CreateTenant(tenant, "commit-sha", types.ActionApply, migrationsToApply, true)
+	results, version := connector.CreateTenant(types.Tenant{Name: tenant}, "commit-sha", types.ActionApply, migrationsToApply, true)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -220,6 +619,119 @@ func TestCreateTenantDryRunMode(t *testing.T) {
 	}
 }
 
+func TestDeleteTenantDropMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tenant := "tenantname"
+	contents := "drop schema tenantname cascade\ndelete from migrator.migrator_tenants where name = $1"
+
+	mock.ExpectBegin()
+	mock.ExpectExec("drop schema tenantname cascade").WillReturnResult(sqlmock.NewResult(0, 0))
+	// tenant
+	mock.ExpectPrepare("delete from migrator.migrator_tenants")
+	mock.ExpectPrepare("delete from migrator.migrator_tenants").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 1))
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("delete-tenant")
+	// tenant deletion entry
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs("Drop", "", "", types.MigrationTypeTenantDeletion, tenant, contents, "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "delete-tenant", time.Now(), "456", "Drop", "", "", types.MigrationTypeTenantDeletion, tenant, time.Now(), contents, "", nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.DeleteTenant(tenant, "delete-tenant", types.DeleteTenantModeDrop, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(123), version.ID)
+	assert.Equal(t, types.MigrationTypeTenantDeletion, version.DBMigrations[0].MigrationType)
+	assert.Equal(t, int32(1), results.TenantsDeleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteTenantDropModeDryRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tenant := "tenantname"
+	contents := "drop schema tenantname cascade\ndelete from migrator.migrator_tenants where name = $1"
+
+	mock.ExpectBegin()
+	// no drop schema in dry-run mode, statements are only reported in tenant deletion entry
+	// tenant
+	mock.ExpectPrepare("delete from migrator.migrator_tenants")
+	mock.ExpectPrepare("delete from migrator.migrator_tenants").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 1))
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("delete-tenant")
+	// tenant deletion entry
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs("Drop", "", "", types.MigrationTypeTenantDeletion, tenant, contents, "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "delete-tenant", time.Now(), "456", "Drop", "", "", types.MigrationTypeTenantDeletion, tenant, time.Now(), contents, "", nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	results, version := connector.DeleteTenant(tenant, "delete-tenant", types.DeleteTenantModeDrop, true)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.TenantsDeleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteTenantUnregisterModeCustomTenantDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.TenantDelete = "update public.tenants set active = false where name = $1"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tenant := "tenantname"
+
+	mock.ExpectBegin()
+	// tenant, no schema statements in unregister mode
+	mock.ExpectPrepare("update public.tenants")
+	mock.ExpectPrepare("update public.tenants").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 1))
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("delete-tenant")
+	// tenant deletion entry
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs("Unregister", "", "", types.MigrationTypeTenantDeletion, tenant, config.TenantDelete, "", "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "delete-tenant", time.Now(), "456", "Unregister", "", "", types.MigrationTypeTenantDeletion, tenant, time.Now(), config.TenantDelete, "", nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	// dry-run mode calls rollback instead of commit
+	mock.ExpectRollback()
+
+	results, version := connector.DeleteTenant(tenant, "delete-tenant", types.DeleteTenantModeUnregister, true)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.TenantsDeleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestCreateTenantSyncMode(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
@@ -238,20 +750,20 @@ func TestCreateTenantSyncMode(t *testing.T) {
 	mock.ExpectExec("create schema").WillReturnResult(sqlmock.NewResult(0, 0))
 	// tenant
 	mock.ExpectPrepare("insert into")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(tenant, nil).WillReturnResult(sqlmock.NewResult(0, 0))
 	// version
 	mock.ExpectPrepare("insert into migrator.migrator_versions")
 	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
 	// migration
 	mock.ExpectPrepare("insert into migrator.migrator_migrations")
-	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, m.MigrationType, tenant, m.Contents, m.CheckSum, m.DownContents, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	// get version
-	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum)
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", m.Name, m.SourceDir, m.File, m.MigrationType, tenant, time.Now(), m.Contents, m.CheckSum, m.DownContents)
 	mock.ExpectQuery("select").WillReturnRows(rows)
 	mock.ExpectCommit()
 
 	// sync results contain correct data like number of applied migrations/scripts
-	results, version := connector.CreateTenant(tenant, "commit-sha", types.ActionSync, migrationsToApply, false)
+	results, version := connector.CreateTenant(types.Tenant{Name: tenant}, "commit-sha", types.ActionSync, migrationsToApply, false)
 	assert.NotNil(t, version)
 	assert.True(t, version.ID > 0)
 	assert.Equal(t, results.MigrationsGrandTotal+results.ScriptsGrandTotal, int32(len(version.DBMigrations)))
@@ -262,6 +774,187 @@ func TestCreateTenantSyncMode(t *testing.T) {
 	}
 }
 
+func TestRollbackVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.abc (id int)", DownContents: "drop table {schema}.abc", CheckSum: "sha256"}
+	tenant := "tenantname"
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: tenant}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Rollback of version 1")
+	// migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("drop table tenantname.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, tenant, m.DownContents, m.CheckSum, "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version, down_contents of rollback entry is NULL
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Rollback of version 1", time.Now(), "456", m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, tenant, time.Now(), m.DownContents, m.CheckSum, nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.RollbackVersion("Rollback of version 1", migrationsToRollback, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(123), version.ID)
+	assert.Equal(t, types.MigrationTypeRollback, version.DBMigrations[0].MigrationType)
+	assert.Equal(t, "", version.DBMigrations[0].DownContents)
+	assert.Equal(t, int32(1), results.MigrationsRolledBack)
+	assert.Equal(t, int32(1), results.Tenants)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "tenants", File: fmt.Sprintf("tenants/%v.sql", tn), MigrationType: types.MigrationTypeTenantMigration, Contents: "-- fixed comment\ncreate table {schema}.abc (id int)", CheckSum: "sha256-new"}
+	mismatches := []types.CheckSumMismatch{{SourceMigration: m, AppliedCheckSum: "sha256-old", AppliedContents: "-- comment\ncreate table {schema}.abc (id int)"}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Repair")
+	// migration
+	mock.ExpectPrepare("update migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("update migrator.migrator_migrations").ExpectExec().WithArgs(m.Contents, m.CheckSum, m.File, types.MigrationTypeSingleMigration, types.MigrationTypeTenantMigration).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, types.MigrationTypeRepair, "migrator", mismatches[0].AppliedContents, mismatches[0].AppliedCheckSum, "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Repair", time.Now(), "456", m.Name, m.SourceDir, m.File, types.MigrationTypeRepair, "migrator", time.Now(), mismatches[0].AppliedContents, mismatches[0].AppliedCheckSum, nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	results, version := connector.RepairMigrations("Repair", mismatches, false)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(123), version.ID)
+	assert.Equal(t, types.MigrationTypeRepair, version.DBMigrations[0].MigrationType)
+	assert.Equal(t, "sha256-old", version.DBMigrations[0].CheckSum)
+	assert.Equal(t, int32(1), results.MigrationsRepaired)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRepairMigrationsDryRunMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	m := types.Migration{Name: "201602220000.sql", SourceDir: "public", File: "public/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc (id int)", CheckSum: "sha256-new"}
+	mismatches := []types.CheckSumMismatch{{SourceMigration: m, AppliedCheckSum: "sha256-old", AppliedContents: "create table abc (id int) "}}
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Repair")
+	mock.ExpectPrepare("update migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("update migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Repair", time.Now(), "456", m.Name, m.SourceDir, m.File, types.MigrationTypeRepair, "migrator", time.Now(), "", "", nil)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	results, _ := connector.RepairMigrations("Repair", mismatches, true)
+	assert.Equal(t, int32(1), results.MigrationsRepaired)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRollbackVersionDryRunMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.abc (id int)", DownContents: "drop table {schema}.abc"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: "public"}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("Rollback of version 1")
+	// migration
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("drop table public.abc").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, "public", m.DownContents, m.CheckSum, "", 0).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Rollback of version 1", time.Now(), "456", m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, "public", time.Now(), m.DownContents, m.CheckSum, "")
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	// dry-run mode calls rollback instead of commit
+	mock.ExpectRollback()
+
+	results, version := connector.RollbackVersion("Rollback of version 1", migrationsToRollback, true)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsRolledBack)
+	assert.Equal(t, int32(0), results.Tenants)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRollbackVersionDryRunModeMySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "mysql"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	tn := time.Now().UnixNano()
+	m := types.Migration{Name: fmt.Sprintf("%v.sql", tn), SourceDir: "public", File: fmt.Sprintf("public/%v.sql", tn), MigrationType: types.MigrationTypeSingleMigration, Contents: "create table {schema}.abc (id int)", DownContents: "drop table {schema}.abc"}
+	migrationsToRollback := []types.DBMigration{{Migration: m, ID: 1, Schema: "public"}}
+
+	mock.ExpectBegin()
+	// version
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectExec().WithArgs("Rollback of version 1").WillReturnResult(sqlmock.NewResult(123, 1))
+	// migration, MySQL commits DDL implicitly and down migration is not executed in dry-run mode
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations").ExpectExec().WithArgs(m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, "public", m.DownContents, m.CheckSum, "", 123).WillReturnResult(sqlmock.NewResult(0, 0))
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "Rollback of version 1", time.Now(), "456", m.Name, m.SourceDir, m.File, types.MigrationTypeRollback, "public", time.Now(), m.DownContents, m.CheckSum, "")
+	mock.ExpectQuery("select").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	results, version := connector.RollbackVersion("Rollback of version 1", migrationsToRollback, true)
+	assert.NotNil(t, version)
+	assert.Equal(t, int32(1), results.MigrationsRolledBack)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestGetTenantInsertSQLOverride(t *testing.T) {
 	config, err := config.FromFile("../test/migrator-overrides.yaml")
 	assert.Nil(t, err)
@@ -295,3 +988,50 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestCreateVersionRepeatables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+
+	config := &config.Config{}
+	config.Driver = "postgres"
+	config.FailurePolicy = "continue"
+	dialect := newDialect(config)
+	connector := baseConnector{newTestContext(), config, dialect, db, true}
+
+	r1 := types.Migration{Name: "orders_view.sql", SourceDir: "views", File: "views/orders_view.sql", MigrationType: types.MigrationTypeSingleRepeatable, Contents: "create or replace view views.orders_view as select 1"}
+	r2 := types.Migration{Name: "recalculate.sql", SourceDir: "procedures", File: "procedures/recalculate.sql", MigrationType: types.MigrationTypeTenantRepeatable, Contents: "create or replace procedure {schema}.recalculate()"}
+	tenantMigrations := map[string][]types.Migration{
+		"abc": {r2},
+	}
+
+	// version and single repeatable applied in its source dir schema
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_versions")
+	mock.ExpectPrepare("insert into migrator.migrator_versions").ExpectQuery().WithArgs("commit-sha")
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create or replace view views.orders_view").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(r1.Name, r1.SourceDir, r1.File, types.MigrationTypeSingleRepeatable, "views", r1.Contents, r1.CheckSum, r1.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// tenant repeatable applied in tenant schema
+	mock.ExpectBegin()
+	mock.ExpectPrepare("insert into migrator.migrator_migrations")
+	mock.ExpectExec("create or replace procedure abc.recalculate").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into migrator.migrator_migrations").WithArgs(r2.Name, r2.SourceDir, r2.File, types.MigrationTypeTenantRepeatable, "abc", r2.Contents, r2.CheckSum, r2.DownContents, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	// get version
+	rows := sqlmock.NewRows([]string{"vid", "vname", "vcreated", "mid", "name", "source_dir", "filename", "type", "db_schema", "created", "contents", "checksum", "down_contents"}).AddRow("123", "vname", time.Now(), "456", r1.Name, r1.SourceDir, r1.File, r1.MigrationType, "views", time.Now(), r1.Contents, r1.CheckSum, r1.DownContents)
+	mock.ExpectQuery("select").WillReturnRows(rows)
+
+	results, version := connector.CreateVersion("commit-sha", types.ActionApply, []types.Migration{r1, r2}, tenantMigrations, false)
+	assert.NotNil(t, version)
+	// repeatables are counted as scripts
+	assert.Equal(t, int32(0), results.MigrationsGrandTotal)
+	assert.Equal(t, int32(1), results.SingleScripts)
+	assert.Equal(t, int32(1), results.TenantScriptsTotal)
+	assert.Equal(t, int32(2), results.ScriptsGrandTotal)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -97,18 +97,45 @@ func (abl *azureBlobLoader) doGetSourceMigrations(client AzureBlobClient, contai
 	tenantMigrationsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantMigrations)
 	singleScriptsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleScripts)
 	tenantScriptsObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantScripts)
+	singleRepeatablesObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.SingleRepeatables)
+	tenantRepeatablesObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.TenantRepeatables)
+	callbacksObjects := abl.getObjectList(client, containerName, optionalPrefixes, abl.config.Callbacks)
+
+	resolve := func(dependency string) string {
+		return fmt.Sprintf("%s/%s", abl.config.BaseLocation, dependency)
+	}
 
 	migrationsMap := make(map[string][]types.Migration)
 	abl.getObjects(client, containerName, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
 	abl.getObjects(client, containerName, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
+	abl.attachDownMigrations(migrationsMap)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
 	abl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	abl.getObjects(client, containerName, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
 	abl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	abl.getObjects(client, containerName, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
+	abl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	abl.getObjects(client, containerName, migrationsMap, singleRepeatablesObjects, types.MigrationTypeSingleRepeatable)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
+	abl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	abl.getObjects(client, containerName, migrationsMap, tenantRepeatablesObjects, types.MigrationTypeTenantRepeatable)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
+	abl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	abl.getObjects(client, containerName, migrationsMap, callbacksObjects, types.MigrationTypeCallback)
+	abl.validateCallbacks(migrationsMap)
+	abl.attachHeaderDirectives(migrationsMap, resolve)
 	abl.sortMigrations(migrationsMap, &migrations)
 
 	return migrations
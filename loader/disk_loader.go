@@ -29,18 +29,45 @@ func (dl *diskLoader) GetSourceMigrations() []types.Migration {
 	tenantMigrationsDirs := dl.getDirs(absBaseDir, dl.config.TenantMigrations)
 	singleScriptsDirs := dl.getDirs(absBaseDir, dl.config.SingleScripts)
 	tenantScriptsDirs := dl.getDirs(absBaseDir, dl.config.TenantScripts)
+	singleRepeatablesDirs := dl.getDirs(absBaseDir, dl.config.SingleRepeatables)
+	tenantRepeatablesDirs := dl.getDirs(absBaseDir, dl.config.TenantRepeatables)
+	callbacksDirs := dl.getDirs(absBaseDir, dl.config.Callbacks)
+
+	resolve := func(dependency string) string {
+		return filepath.Join(absBaseDir, dependency)
+	}
 
 	migrationsMap := make(map[string][]types.Migration)
 	dl.readFromDirs(migrationsMap, singleMigrationsDirs, types.MigrationTypeSingleMigration)
 	dl.readFromDirs(migrationsMap, tenantMigrationsDirs, types.MigrationTypeTenantMigration)
+	dl.attachDownMigrations(migrationsMap)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
 	dl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	dl.readFromDirs(migrationsMap, singleScriptsDirs, types.MigrationTypeSingleScript)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
 	dl.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	dl.readFromDirs(migrationsMap, tenantScriptsDirs, types.MigrationTypeTenantScript)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
+	dl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	dl.readFromDirs(migrationsMap, singleRepeatablesDirs, types.MigrationTypeSingleRepeatable)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
+	dl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	dl.readFromDirs(migrationsMap, tenantRepeatablesDirs, types.MigrationTypeTenantRepeatable)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
+	dl.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	dl.readFromDirs(migrationsMap, callbacksDirs, types.MigrationTypeCallback)
+	dl.validateCallbacks(migrationsMap)
+	dl.attachHeaderDirectives(migrationsMap, resolve)
 	dl.sortMigrations(migrationsMap, &migrations)
 
 	return migrations
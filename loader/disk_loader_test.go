@@ -2,9 +2,13 @@ package loader
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -85,6 +89,171 @@ func TestDiskGetDiskMigrations(t *testing.T) {
 	assert.Contains(t, migrations[11].File, "test/migrations/tenants-scripts/b.sql")
 }
 
+func TestDiskGetDiskMigrationsWithDownMigrations(t *testing.T) {
+	baseDir := t.TempDir()
+	tenantsDir := filepath.Join(baseDir, "tenants")
+	assert.Nil(t, os.Mkdir(tenantsDir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160001.sql"), []byte("create table {schema}.abc (id int)"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160001.down.sql"), []byte("drop table {schema}.abc"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(tenantsDir, "201602160002.sql"), []byte("create table {schema}.def (id int)"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.TenantMigrations = []string{"tenants"}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "201602160001.sql", migrations[0].Name)
+	assert.Equal(t, "drop table {schema}.abc", migrations[0].DownContents)
+	assert.Equal(t, "201602160002.sql", migrations[1].Name)
+	assert.Equal(t, "", migrations[1].DownContents)
+}
+
+func TestDiskGetDiskMigrationsRepeatables(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, dir := range []string{"config", "scripts", "views", "procedures"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(baseDir, dir), 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "config", "201602160001.sql"), []byte("create table config.abc (id int)"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "scripts", "refresh.sql"), []byte("select 1"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "views", "abc_view.sql"), []byte("create or replace view config.abc_view as select * from config.abc"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "procedures", "abc_proc.sql"), []byte("create or replace procedure {schema}.abc_proc() language sql as 'select 1'"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.SingleMigrations = []string{"config"}
+	config.SingleScripts = []string{"scripts"}
+	config.SingleRepeatables = []string{"views"}
+	config.TenantRepeatables = []string{"procedures"}
+	config.StatementTimeouts = map[string]int{"views": 120}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 4)
+	assert.Equal(t, types.MigrationTypeSingleMigration, migrations[0].MigrationType)
+	assert.Equal(t, types.MigrationTypeSingleScript, migrations[1].MigrationType)
+	// repeatables are run after scripts
+	assert.Equal(t, filepath.Join(baseDir, "views", "abc_view.sql"), migrations[2].File)
+	assert.Equal(t, types.MigrationTypeSingleRepeatable, migrations[2].MigrationType)
+	assert.Equal(t, 2*time.Minute, migrations[2].Timeout)
+	assert.Equal(t, filepath.Join(baseDir, "procedures", "abc_proc.sql"), migrations[3].File)
+	assert.Equal(t, types.MigrationTypeTenantRepeatable, migrations[3].MigrationType)
+	assert.NotEmpty(t, migrations[3].CheckSum)
+}
+
+func TestDiskGetDiskMigrationsTimeoutsOfScripts(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, dir := range []string{"scripts", "reports"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(baseDir, dir), 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "scripts", "refresh.sql"), []byte("-- migrator:timeout=30m\nrefresh materialized view config.abc_view"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "reports", "refresh-reports.sql"), []byte("refresh materialized view config.reports"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.SingleScripts = []string{"scripts", "reports"}
+	config.StatementTimeouts = map[string]int{"reports": 120}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, 2*time.Minute, migrations[0].Timeout)
+	assert.Equal(t, 30*time.Minute, migrations[1].Timeout)
+}
+
+func TestDiskGetDiskMigrationsTenantScriptsTenantSelectors(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, dir := range []string{"tenants-scripts", "enterprise-scripts"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(baseDir, dir), 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "tenants-scripts", "recreate-indexes.sql"), []byte("-- migrator:tenants: region=eu\nreindex schema {schema}"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "enterprise-scripts", "refresh-reports.sql"), []byte("refresh materialized view {schema}.reports"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.TenantScripts = []string{"tenants-scripts", "enterprise-scripts"}
+	config.TenantSelectors = map[string]string{"enterprise-scripts": "tier=enterprise"}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, "region=eu", migrations[0].TenantSelector)
+	assert.Equal(t, "tier=enterprise", migrations[1].TenantSelector)
+	assert.False(t, migrations[0].MatchesTenant(types.Tenant{Name: "abc", Metadata: types.TenantMetadata{"region": "us"}}))
+}
+
+func TestDiskGetDiskMigrationsCallbacks(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, dir := range []string{"config", "callbacks"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(baseDir, dir), 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "config", "201602160001.sql"), []byte("create table config.abc (id int)"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "callbacks", "afterVersion_refresh_views.sql"), []byte("-- migrator:timeout=600\nrefresh materialized view config.abc_view"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "callbacks", "beforeEachTenant.sql"), []byte("set search_path to {schema}"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.SingleMigrations = []string{"config"}
+	config.Callbacks = []string{"callbacks"}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 3)
+	assert.Equal(t, types.MigrationTypeSingleMigration, migrations[0].MigrationType)
+	// callbacks are last
+	assert.Equal(t, types.MigrationTypeCallback, migrations[1].MigrationType)
+	assert.Equal(t, types.CallbackAfterVersion, migrations[1].CallbackEvent())
+	assert.Equal(t, 10*time.Minute, migrations[1].Timeout)
+	assert.Equal(t, types.MigrationTypeCallback, migrations[2].MigrationType)
+	assert.Equal(t, types.CallbackBeforeEachTenant, migrations[2].CallbackEvent())
+}
+
+func TestDiskGetDiskMigrationsUnknownCallbackEvent(t *testing.T) {
+	baseDir := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(baseDir, "callbacks"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "callbacks", "afterMigrate.sql"), []byte("select 1"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.Callbacks = []string{"callbacks"}
+
+	loader := New(context.TODO(), &config)
+
+	assert.PanicsWithValue(t, "Unknown callback event in callback "+filepath.Join(baseDir, "callbacks", "afterMigrate.sql"), func() {
+		loader.GetSourceMigrations()
+	})
+}
+
+func TestDiskGetDiskMigrationsLabelsOfScripts(t *testing.T) {
+	baseDir := t.TempDir()
+	for _, dir := range []string{"scripts", "seeds-scripts"} {
+		assert.Nil(t, os.Mkdir(filepath.Join(baseDir, dir), 0755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "scripts", "grants.sql"), []byte("-- migrator:labels: prod\ngrant select on all tables in schema config to reporting"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(baseDir, "seeds-scripts", "users.sql"), []byte("insert into config.users values (1, 'test')"), 0644))
+
+	var config config.Config
+	config.BaseLocation = baseDir
+	config.SingleScripts = []string{"scripts", "seeds-scripts"}
+	config.Labels = map[string][]string{"seeds-scripts": {"test-data"}}
+
+	loader := New(context.TODO(), &config)
+	migrations := loader.GetSourceMigrations()
+
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, []string{"prod"}, migrations[0].Labels)
+	assert.Equal(t, []string{"test-data"}, migrations[1].Labels)
+	// labelled script is excluded in other contexts
+	assert.False(t, migrations[0].MatchesContexts([]string{"test", "test-data"}))
+	assert.True(t, migrations[1].MatchesContexts([]string{"test", "test-data"}))
+}
+
 func TestDiskHealthCheck(t *testing.T) {
 	config := &config.Config{
 		BaseLocation: "/path/to/baseDir",
@@ -2,9 +2,13 @@ package loader
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/types"
@@ -43,15 +47,185 @@ type baseLoader struct {
 	config *config.Config
 }
 
+// sortMigrations appends migrations sorted by their names using configured version ordering strategy
 func (bl *baseLoader) sortMigrations(migrationsMap map[string][]types.Migration, migrations *[]types.Migration) {
 	keys := make([]string, 0, len(migrationsMap))
 	for key := range migrationsMap {
 		keys = append(keys, key)
 	}
-	sort.Strings(keys)
+	ordering := bl.config.GetVersionOrdering()
+	sort.Slice(keys, func(i, j int) bool {
+		return CompareNames(ordering, keys[i], keys[j]) < 0
+	})
+	checkDuplicateVersions(ordering, keys, func(name string) string {
+		return migrationsMap[name][0].File
+	})
 
 	for _, key := range keys {
 		ms := migrationsMap[key]
 		*migrations = append(*migrations, ms...)
 	}
 }
+
+// attachDownMigrations finds down migrations (for example 201602160003.down.sql) and attaches their contents
+// to matching up migrations (201602160003.sql) from the same source dir, down migrations are then removed from the map
+func (bl *baseLoader) attachDownMigrations(migrationsMap map[string][]types.Migration) {
+	for name, downMigrations := range migrationsMap {
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if !strings.HasSuffix(base, ".down") {
+			continue
+		}
+		upMigrations := migrationsMap[strings.TrimSuffix(base, ".down")+ext]
+		for _, down := range downMigrations {
+			found := false
+			for i := range upMigrations {
+				if upMigrations[i].SourceDir == down.SourceDir {
+					upMigrations[i].DownContents = down.Contents
+					found = true
+				}
+			}
+			if !found {
+				panic(fmt.Sprintf("Could not find up migration for down migration %v", down.File))
+			}
+		}
+		delete(migrationsMap, name)
+	}
+}
+
+// validateCallbacks checks that names of all callbacks start with known callback event
+func (bl *baseLoader) validateCallbacks(migrationsMap map[string][]types.Migration) {
+	for _, callbacks := range migrationsMap {
+		for _, callback := range callbacks {
+			if callback.CallbackEvent() == "" {
+				panic(fmt.Sprintf("Unknown callback event in callback %v", callback.File))
+			}
+		}
+	}
+}
+
+const (
+	// dependsOnDirective is the header directive used by migrations to declare dependencies on other migrations,
+	// for example: -- migrator:depends-on: ref/201602160003.sql, tenants/201602160004.sql
+	dependsOnDirective = "migrator:depends-on:"
+	// noTransactionDirective is the header directive used by migrations which must run outside of version transaction,
+	// for example: -- migrator:no-transaction
+	noTransactionDirective = "migrator:no-transaction"
+	// timeoutDirective is the header directive used by migrations to override statement timeout,
+	// the value is either a duration or a number of seconds, for example: -- migrator:timeout=30m
+	timeoutDirective = "migrator:timeout="
+	// tenantsDirective is the header directive used by tenant migrations and scripts to declare tenant selector,
+	// for example: -- migrator:tenants: tier=enterprise, region!=eu
+	tenantsDirective = "migrator:tenants:"
+	// labelsDirective is the header directive used by migrations to declare labels, migration is applied only
+	// in contexts matching one of its labels, for example: -- migrator:labels: test-data, seed
+	labelsDirective = "migrator:labels:"
+)
+
+// attachHeaderDirectives parses header directives of all migrations and stores them in DependsOn, NoTransaction, and Timeout fields,
+// migrations from source dirs listed in noTransactionMigrations config are always marked as non-transactional,
+// migrations from source dirs listed in statementTimeouts config get their timeouts unless overridden by timeout directive,
+// similarly migrations from source dirs listed in tenantSelectors config get their tenant selectors unless overridden by tenants directive,
+// and migrations from source dirs listed in labels config get their labels unless overridden by labels directive,
+// dependencies and source dirs are relative to base location and resolve func is used to convert them to full paths
+func (bl *baseLoader) attachHeaderDirectives(migrationsMap map[string][]types.Migration, resolve func(string) string) {
+	noTransactionDirs := map[string]bool{}
+	for _, dir := range bl.config.NoTransactionMigrations {
+		noTransactionDirs[resolve(dir)] = true
+	}
+	timeoutDirs := map[string]time.Duration{}
+	for dir, timeout := range bl.config.StatementTimeouts {
+		timeoutDirs[resolve(dir)] = time.Duration(timeout) * time.Second
+	}
+	selectorDirs := map[string]string{}
+	for dir, selector := range bl.config.TenantSelectors {
+		selectorDirs[resolve(dir)] = selector
+	}
+	labelDirs := map[string][]string{}
+	for dir, labels := range bl.config.Labels {
+		labelDirs[resolve(dir)] = labels
+	}
+	for _, migrations := range migrationsMap {
+		for i := range migrations {
+			migrations[i].Labels = labelDirs[migrations[i].SourceDir]
+			migrations[i].NoTransaction = noTransactionDirs[migrations[i].SourceDir]
+			migrations[i].Timeout = timeoutDirs[migrations[i].SourceDir]
+			migrations[i].TenantSelector = selectorDirs[migrations[i].SourceDir]
+			for _, directive := range bl.parseHeaderDirectives(migrations[i].Contents) {
+				if directive == noTransactionDirective {
+					migrations[i].NoTransaction = true
+				}
+				if strings.HasPrefix(directive, timeoutDirective) {
+					migrations[i].Timeout = parseTimeout(migrations[i].File, strings.TrimPrefix(directive, timeoutDirective))
+				}
+				if strings.HasPrefix(directive, tenantsDirective) {
+					migrations[i].TenantSelector = strings.TrimSpace(strings.TrimPrefix(directive, tenantsDirective))
+				}
+				if strings.HasPrefix(directive, labelsDirective) {
+					migrations[i].Labels = parseLabels(strings.TrimPrefix(directive, labelsDirective))
+				}
+				if !strings.HasPrefix(directive, dependsOnDirective) {
+					continue
+				}
+				for _, dependency := range strings.Split(strings.TrimPrefix(directive, dependsOnDirective), ",") {
+					if dependency = strings.TrimSpace(dependency); dependency != "" {
+						migrations[i].DependsOn = append(migrations[i].DependsOn, resolve(dependency))
+					}
+				}
+			}
+			if migrations[i].TenantSelector != "" {
+				if err := types.ValidateTenantSelector(migrations[i].TenantSelector); err != nil {
+					panic(fmt.Sprintf("Invalid tenant selector in migration %v: %v", migrations[i].File, err))
+				}
+			}
+		}
+	}
+}
+
+// parseLabels parses comma-separated labels
+func parseLabels(value string) []string {
+	labels := []string{}
+	for _, label := range strings.Split(value, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// parseTimeout parses value of timeout directive which is either a duration (30s, 5m) or a number of seconds
+func parseTimeout(file, value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		panic(fmt.Sprintf("Invalid timeout directive in migration %v: %v", file, value))
+	}
+	return timeout
+}
+
+// parseHeaderDirectives returns directives declared in migration's header, the header is made of leading
+// comment lines (starting with -- or //) and blank lines, parsing stops at the first statement
+func (bl *baseLoader) parseHeaderDirectives(contents string) []string {
+	var directives []string
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var comment string
+		if strings.HasPrefix(line, "--") {
+			comment = strings.TrimPrefix(line, "--")
+		} else if strings.HasPrefix(line, "//") {
+			comment = strings.TrimPrefix(line, "//")
+		} else {
+			break
+		}
+		if comment = strings.TrimSpace(comment); strings.HasPrefix(comment, "migrator:") {
+			directives = append(directives, comment)
+		}
+	}
+	return directives
+}
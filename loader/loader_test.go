@@ -3,8 +3,10 @@ package loader
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/lukaszbudnik/migrator/config"
+	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,3 +33,235 @@ func TestNewS3Loader(t *testing.T) {
 	loader := New(context.TODO(), config)
 	assert.IsType(t, &s3Loader{}, loader)
 }
+
+func TestAttachDownMigrations(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "public", File: "public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m1Down := types.Migration{Name: "201602160001.down.sql", SourceDir: "public", File: "public/201602160001.down.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "drop table abc"}
+	m2 := types.Migration{Name: "201602160001.sql", SourceDir: "tenants", File: "tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.def"}
+	m3 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.ghi"}
+	m3Down := types.Migration{Name: "201602160002.down.sql", SourceDir: "tenants", File: "tenants/201602160002.down.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "drop table {schema}.ghi"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name:     {m1, m2},
+		m1Down.Name: {m1Down},
+		m3.Name:     {m3},
+		m3Down.Name: {m3Down},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{}}
+	bl.attachDownMigrations(migrationsMap)
+
+	assert.Len(t, migrationsMap, 2)
+	assert.Equal(t, "drop table abc", migrationsMap[m1.Name][0].DownContents)
+	// down migration is paired only with up migration from the same source dir
+	assert.Equal(t, "", migrationsMap[m1.Name][1].DownContents)
+	assert.Equal(t, "drop table {schema}.ghi", migrationsMap[m3.Name][0].DownContents)
+}
+
+func TestAttachDownMigrationsMissingUpMigration(t *testing.T) {
+	m1Down := types.Migration{Name: "201602160001.down.sql", SourceDir: "public", File: "public/201602160001.down.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "drop table abc"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1Down.Name: {m1Down},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{}}
+	assert.PanicsWithValue(t, "Could not find up migration for down migration public/201602160001.down.sql", func() {
+		bl.attachDownMigrations(migrationsMap)
+	})
+}
+
+func TestAttachDependencies(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "public", File: "public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "tenants", File: "tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- add ghi table\n-- migrator:depends-on: public/201602160001.sql\n\n// migrator:depends-on: tenants/201602160000.sql, ref/201602160001.sql\ncreate table {schema}.ghi\n-- migrator:depends-on: ignored/201602160001.sql"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+		m2.Name: {m2},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{}}
+	bl.attachHeaderDirectives(migrationsMap, func(dependency string) string {
+		return "base/" + dependency
+	})
+
+	assert.Nil(t, migrationsMap[m1.Name][0].DependsOn)
+	assert.Equal(t, []string{"base/public/201602160001.sql", "base/tenants/201602160000.sql", "base/ref/201602160001.sql"}, migrationsMap[m2.Name][0].DependsOn)
+}
+
+func TestAttachHeaderDirectivesTimeout(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/public", File: "base/public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "base/tenants", File: "base/tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "alter table {schema}.ghi add column jkl int"}
+	m3 := types.Migration{Name: "201602160003.sql", SourceDir: "base/tenants", File: "base/tenants/201602160003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator:timeout=30m\nupdate {schema}.ghi set jkl = 1"}
+	m4 := types.Migration{Name: "201602160004.sql", SourceDir: "base/public", File: "base/public/201602160004.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "// migrator:timeout=45\nupdate abc set def = 1"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+		m2.Name: {m2},
+		m3.Name: {m3},
+		m4.Name: {m4},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{StatementTimeouts: map[string]int{"tenants": 600}}}
+	bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+		return "base/" + path
+	})
+
+	assert.Equal(t, time.Duration(0), migrationsMap[m1.Name][0].Timeout)
+	assert.Equal(t, 10*time.Minute, migrationsMap[m2.Name][0].Timeout)
+	assert.Equal(t, 30*time.Minute, migrationsMap[m3.Name][0].Timeout)
+	assert.Equal(t, 45*time.Second, migrationsMap[m4.Name][0].Timeout)
+}
+
+func TestAttachHeaderDirectivesInvalidTimeout(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/public", File: "base/public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "-- migrator:timeout=forever\ncreate table abc"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{}}
+	assert.PanicsWithValue(t, "Invalid timeout directive in migration base/public/201602160001.sql: forever", func() {
+		bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+			return "base/" + path
+		})
+	})
+}
+
+func TestAttachHeaderDirectivesTenants(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/tenants", File: "base/tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.abc"}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "base/tenants-enterprise", File: "base/tenants-enterprise/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "create table {schema}.audit"}
+	m3 := types.Migration{Name: "201602160003.sql", SourceDir: "base/tenants-enterprise", File: "base/tenants-enterprise/201602160003.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator:tenants: tier=enterprise, region!=eu\ncreate table {schema}.archive"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+		m2.Name: {m2},
+		m3.Name: {m3},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{TenantSelectors: map[string]string{"tenants-enterprise": "tier=enterprise"}}}
+	bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+		return "base/" + path
+	})
+
+	assert.Equal(t, "", migrationsMap[m1.Name][0].TenantSelector)
+	assert.Equal(t, "tier=enterprise", migrationsMap[m2.Name][0].TenantSelector)
+	assert.Equal(t, "tier=enterprise, region!=eu", migrationsMap[m3.Name][0].TenantSelector)
+}
+
+func TestAttachHeaderDirectivesInvalidTenants(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/tenants", File: "base/tenants/201602160001.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator:tenants: enterprise\ncreate table {schema}.abc"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{}}
+	assert.PanicsWithValue(t, "Invalid tenant selector in migration base/tenants/201602160001.sql: invalid tenant selector requirement: enterprise", func() {
+		bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+			return "base/" + path
+		})
+	})
+}
+
+func TestAttachHeaderDirectivesLabels(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/public", File: "base/public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "base/seeds", File: "base/seeds/201602160002.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "insert into abc values (1)"}
+	m3 := types.Migration{Name: "201602160003.sql", SourceDir: "base/public", File: "base/public/201602160003.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "-- migrator:labels: prod, staging\ngrant select on abc to reporting"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+		m2.Name: {m2},
+		m3.Name: {m3},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{Labels: map[string][]string{"seeds": {"test-data"}}}}
+	bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+		return "base/" + path
+	})
+
+	assert.Nil(t, migrationsMap[m1.Name][0].Labels)
+	assert.Equal(t, []string{"test-data"}, migrationsMap[m2.Name][0].Labels)
+	assert.Equal(t, []string{"prod", "staging"}, migrationsMap[m3.Name][0].Labels)
+}
+
+func TestAttachHeaderDirectivesNoTransaction(t *testing.T) {
+	m1 := types.Migration{Name: "201602160001.sql", SourceDir: "base/public", File: "base/public/201602160001.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create table abc"}
+	m2 := types.Migration{Name: "201602160002.sql", SourceDir: "base/tenants", File: "base/tenants/201602160002.sql", MigrationType: types.MigrationTypeTenantMigration, Contents: "-- migrator:no-transaction\ncreate index concurrently ghi_idx on {schema}.ghi (id)"}
+	m3 := types.Migration{Name: "201602160003.sql", SourceDir: "base/concurrently", File: "base/concurrently/201602160003.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "create index concurrently abc_idx on abc (id)"}
+
+	migrationsMap := map[string][]types.Migration{
+		m1.Name: {m1},
+		m2.Name: {m2},
+		m3.Name: {m3},
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{NoTransactionMigrations: []string{"concurrently"}}}
+	bl.attachHeaderDirectives(migrationsMap, func(path string) string {
+		return "base/" + path
+	})
+
+	assert.False(t, migrationsMap[m1.Name][0].NoTransaction)
+	assert.True(t, migrationsMap[m2.Name][0].NoTransaction)
+	assert.True(t, migrationsMap[m3.Name][0].NoTransaction)
+	assert.Nil(t, migrationsMap[m2.Name][0].DependsOn)
+}
+
+func TestSortMigrationsVersionOrdering(t *testing.T) {
+	names := []string{"V10__x.sql", "V2__y.sql", "V1_2_3__z.sql", "V1_10__w.sql", "refresh.sql"}
+	migrationsMap := map[string][]types.Migration{}
+	for _, name := range names {
+		migrationsMap[name] = []types.Migration{{Name: name, SourceDir: "public", File: "public/" + name}}
+	}
+
+	sorted := func(ordering string) []string {
+		bl := baseLoader{context.TODO(), &config.Config{VersionOrdering: ordering}}
+		var migrations []types.Migration
+		bl.sortMigrations(migrationsMap, &migrations)
+		var sortedNames []string
+		for _, m := range migrations {
+			sortedNames = append(sortedNames, m.Name)
+		}
+		return sortedNames
+	}
+
+	assert.Equal(t, []string{"V10__x.sql", "V1_10__w.sql", "V1_2_3__z.sql", "V2__y.sql", "refresh.sql"}, sorted(""))
+	// names without a version are sorted last
+	assert.Equal(t, []string{"V1_2_3__z.sql", "V1_10__w.sql", "V2__y.sql", "V10__x.sql", "refresh.sql"}, sorted(config.VersionOrderingSemver))
+}
+
+func TestSortMigrationsTimestampOrdering(t *testing.T) {
+	names := []string{"20160216_a.sql", "201602161200_b.sql", "20160215235959_c.sql", "2016_d.sql"}
+	migrationsMap := map[string][]types.Migration{}
+	for _, name := range names {
+		migrationsMap[name] = []types.Migration{{Name: name, SourceDir: "public", File: "public/" + name}}
+	}
+
+	bl := baseLoader{context.TODO(), &config.Config{VersionOrdering: config.VersionOrderingTimestamp}}
+	var migrations []types.Migration
+	bl.sortMigrations(migrationsMap, &migrations)
+
+	assert.Len(t, migrations, 4)
+	assert.Equal(t, "20160215235959_c.sql", migrations[0].Name)
+	assert.Equal(t, "20160216_a.sql", migrations[1].Name)
+	assert.Equal(t, "201602161200_b.sql", migrations[2].Name)
+	// 2016 is not a valid timestamp
+	assert.Equal(t, "2016_d.sql", migrations[3].Name)
+}
+
+func TestSortMigrationsDuplicateVersion(t *testing.T) {
+	m1 := types.Migration{Name: "V1__a.sql", SourceDir: "public", File: "public/V1__a.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m2 := types.Migration{Name: "V1.0__b.sql", SourceDir: "public", File: "public/V1.0__b.sql", MigrationType: types.MigrationTypeSingleMigration}
+	m3 := types.Migration{Name: "V1__a.sql", SourceDir: "tenants", File: "tenants/V1__a.sql", MigrationType: types.MigrationTypeTenantMigration}
+
+	bl := baseLoader{context.TODO(), &config.Config{VersionOrdering: config.VersionOrderingSemver}}
+
+	// the same name in multiple source dirs is not a duplicate
+	var migrations []types.Migration
+	bl.sortMigrations(map[string][]types.Migration{m1.Name: {m1, m3}}, &migrations)
+	assert.Len(t, migrations, 2)
+
+	assert.PanicsWithValue(t, "Duplicate version 1 in migrations public/V1.0__b.sql and public/V1__a.sql", func() {
+		bl.sortMigrations(map[string][]types.Migration{m1.Name: {m1, m3}, m2.Name: {m2}}, &migrations)
+	})
+}
@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lukaszbudnik/migrator/config"
+)
+
+// numericVersion matches optional letter prefix (for example Flyway's V) followed by numeric version parts separated by _ or .
+// for example V1_2_3__desc.sql, 1.2.3_desc.sql, 201602160001.sql
+var numericVersion = regexp.MustCompile(`^[A-Za-z]*([0-9]+(?:[._][0-9]+)*)`)
+
+// timestampLayouts maps length of timestamp prefix to its layout
+var timestampLayouts = map[int]string{
+	8:  "20060102",
+	12: "200601021504",
+	14: "20060102150405",
+}
+
+// ParseVersion returns numeric parts of version of migration name according to passed ordering strategy
+// leading zeros and trailing zero parts are removed so that for example V1.0 and V01 are the same version
+// ok is false for lexical ordering and for names which don't have a version
+func ParseVersion(ordering string, name string) (parts []string, ok bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	match := numericVersion.FindStringSubmatch(base)
+	if match == nil {
+		return nil, false
+	}
+	version := match[1]
+
+	switch ordering {
+	case config.VersionOrderingSemver:
+		parts = strings.FieldsFunc(version, func(r rune) bool { return r == '_' || r == '.' })
+	case config.VersionOrderingTimestamp:
+		digits := strings.FieldsFunc(version, func(r rune) bool { return r == '_' || r == '.' })[0]
+		layout, found := timestampLayouts[len(digits)]
+		if !found {
+			return nil, false
+		}
+		t, err := time.Parse(layout, digits)
+		if err != nil {
+			return nil, false
+		}
+		parts = []string{t.Format("20060102150405")}
+	default:
+		return nil, false
+	}
+
+	for i := range parts {
+		parts[i] = strings.TrimLeft(parts[i], "0")
+	}
+	for len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts, true
+}
+
+// compareVersions compares numeric version parts, parts can be of any length
+func compareVersions(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var pa, pb string
+		if i < len(a) {
+			pa = a[i]
+		}
+		if i < len(b) {
+			pb = b[i]
+		}
+		if len(pa) != len(pb) {
+			if len(pa) < len(pb) {
+				return -1
+			}
+			return 1
+		}
+		if c := strings.Compare(pa, pb); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// CompareNames compares migration names according to passed ordering strategy and returns -1, 0, or 1
+// names without a version sort after names with a version, names with the same version and names without a version are compared lexically
+func CompareNames(ordering string, a, b string) int {
+	va, okA := ParseVersion(ordering, a)
+	vb, okB := ParseVersion(ordering, b)
+	switch {
+	case okA && okB:
+		if c := compareVersions(va, vb); c != 0 {
+			return c
+		}
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// checkDuplicateVersions panics when two different names (sorted using CompareNames) have the same version
+func checkDuplicateVersions(ordering string, names []string, files func(name string) string) {
+	for i := 1; i < len(names); i++ {
+		previous, okPrevious := ParseVersion(ordering, names[i-1])
+		current, okCurrent := ParseVersion(ordering, names[i])
+		if okPrevious && okCurrent && compareVersions(previous, current) == 0 {
+			panic(fmt.Sprintf("Duplicate version %v in migrations %v and %v", strings.Join(current, "."), files(names[i-1]), files(names[i])))
+		}
+	}
+}
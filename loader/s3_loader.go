@@ -121,18 +121,45 @@ func (s3l *s3Loader) doGetSourceMigrations(client S3APIClient) []types.Migration
 	tenantMigrationsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantMigrations)
 	singleScriptsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleScripts)
 	tenantScriptsObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantScripts)
+	singleRepeatablesObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.SingleRepeatables)
+	tenantRepeatablesObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.TenantRepeatables)
+	callbacksObjects := s3l.getObjectList(client, bucket, optionalPrefixes, s3l.config.Callbacks)
+
+	resolve := func(dependency string) string {
+		return fmt.Sprintf("%s/%s", s3l.config.BaseLocation, dependency)
+	}
 
 	migrationsMap := make(map[string][]types.Migration)
 	s3l.getObjects(client, bucket, migrationsMap, singleMigrationsObjects, types.MigrationTypeSingleMigration)
 	s3l.getObjects(client, bucket, migrationsMap, tenantMigrationsObjects, types.MigrationTypeTenantMigration)
+	s3l.attachDownMigrations(migrationsMap)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	s3l.getObjects(client, bucket, migrationsMap, singleScriptsObjects, types.MigrationTypeSingleScript)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
 	migrationsMap = make(map[string][]types.Migration)
 	s3l.getObjects(client, bucket, migrationsMap, tenantScriptsObjects, types.MigrationTypeTenantScript)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
+	s3l.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	s3l.getObjects(client, bucket, migrationsMap, singleRepeatablesObjects, types.MigrationTypeSingleRepeatable)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
+	s3l.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	s3l.getObjects(client, bucket, migrationsMap, tenantRepeatablesObjects, types.MigrationTypeTenantRepeatable)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
+	s3l.sortMigrations(migrationsMap, &migrations)
+
+	migrationsMap = make(map[string][]types.Migration)
+	s3l.getObjects(client, bucket, migrationsMap, callbacksObjects, types.MigrationTypeCallback)
+	s3l.validateCallbacks(migrationsMap)
+	s3l.attachHeaderDirectives(migrationsMap, resolve)
 	s3l.sortMigrations(migrationsMap, &migrations)
 
 	return migrations
@@ -139,7 +139,8 @@ func serviceHandler(c *gin.Context, config *config.Config, metrics metrics.Metri
 	coordinator := newCoordinator(c.Request.Context(), config, metrics)
 	defer coordinator.Dispose()
 	opts := []graphql.SchemaOpt{graphql.UseFieldResolvers()}
-	schema := graphql.MustParseSchema(data.SchemaDefinition, &data.RootResolver{Coordinator: coordinator}, opts...)
+	jobs := &jobRunner{config: config, metrics: metrics, newCoordinator: newCoordinator}
+	schema := graphql.MustParseSchema(data.SchemaDefinition, &data.RootResolver{Coordinator: coordinator, Jobs: jobs}, opts...)
 
 	response := schema.Exec(c.Request.Context(), params.Query, params.OperationName, params.Variables)
 	if response.Errors == nil {
@@ -150,6 +151,36 @@ func serviceHandler(c *gin.Context, config *config.Config, metrics metrics.Metri
 
 }
 
+// jobRunner runs asynchronous createVersion jobs in background, jobs outlive the HTTP request which created them
+type jobRunner struct {
+	config         *config.Config
+	metrics        metrics.Metrics
+	newCoordinator coordinator.Factory
+}
+
+func (j *jobRunner) Submit(job *types.Job, input types.VersionInput) {
+	ctx := context.WithValue(context.Background(), common.RequestIDKey{}, fmt.Sprintf("job-%v", job.ID))
+	ctx = context.WithValue(ctx, common.LogLevelKey{}, j.config.LogLevel)
+	ctx = context.WithValue(ctx, common.ProgressKey{}, &common.Progress{})
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				common.LogPanic(ctx, "Job %v panic recovered: %v", job.ID, err)
+			}
+		}()
+		coordinator := j.newCoordinator(ctx, j.config, j.metrics)
+		defer coordinator.Dispose()
+		// job which panicked must not stay queued or running
+		defer func() {
+			if err := recover(); err != nil {
+				common.LogPanic(ctx, "Job %v panic recovered: %v", job.ID, err)
+				coordinator.FailJob(job, fmt.Sprintf("%v", err))
+			}
+		}()
+		coordinator.RunJob(job, input)
+	}()
+}
+
 func CreateRouterAndPrometheus(versionInfo *types.VersionInfo, config *config.Config, newCoordinator coordinator.Factory) *gin.Engine {
 	r := gin.New()
 
@@ -162,7 +193,11 @@ func CreateRouterAndPrometheus(versionInfo *types.VersionInfo, config *config.Co
 	p.AddCustomGauge("info", "Information about migrator app", []string{"version"})
 	p.AddCustomGauge("versions_created", "Number of versions created by migrator", []string{})
 	p.AddCustomGauge("tenants_created", "Number of migrations applied by migrator", []string{})
+	p.AddCustomGauge("tenants_deleted", "Number of tenants deleted by migrator", []string{})
+	p.AddCustomGauge("tenants_failed", "Number of tenants which failed to apply migrations", []string{})
 	p.AddCustomGauge("migrations_applied", "Number of migrations applied by migrator", []string{"type"})
+	p.AddCustomGauge("migrations_rolled_back", "Number of migrations rolled back by migrator", []string{})
+	p.AddCustomGauge("migrations_repaired", "Number of migrations repaired by migrator", []string{})
 
 	p.SetGaugeValue("info", []string{versionInfo.Release + " @ " + versionInfo.Sha}, 1)
 
@@ -32,12 +32,58 @@ func newMockedErrorCoordinator(errorThreshold int) func(context.Context, *config
 func (m *mockedCoordinator) Dispose() {
 }
 
-func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, string) *types.CreateResults {
-	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}
+func (m *mockedCoordinator) CreateTenant(string, types.Action, bool, types.Tenant) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
 }
 
-func (m *mockedCoordinator) CreateVersion(string, types.Action, bool) *types.CreateResults {
-	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}
+func (m *mockedCoordinator) DeleteTenant(types.DeleteTenantInput) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) CreateVersion(types.VersionInput) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) CreateJob(input types.VersionInput) (*types.Job, error) {
+	return &types.Job{ID: 1, State: types.JobStateQueued, VersionName: input.VersionName, Created: graphql.Time{Time: time.Now()}}, nil
+}
+
+func (m *mockedCoordinator) CancelJob(ID int32) (*types.Job, error) {
+	return &types.Job{ID: ID, State: types.JobStateRunning, VersionName: "a", Created: graphql.Time{Time: time.Now()}, CancelRequested: true}, nil
+}
+
+func (m *mockedCoordinator) RunJob(*types.Job, types.VersionInput) {
+}
+
+func (m *mockedCoordinator) FailJob(*types.Job, string) {
+}
+
+func (m *mockedCoordinator) GetJob(ID int32) (*types.Job, error) {
+	return &types.Job{ID: ID, State: types.JobStateSucceeded, VersionName: "a", Created: graphql.Time{Time: time.Now()}}, nil
+}
+
+func (m *mockedCoordinator) RollbackVersion(int32, bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) ResumeVersion(int32, bool) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) GetTenantStatus(name string) (*types.TenantStatus, error) {
+	return &types.TenantStatus{Name: name}, nil
+}
+
+func (m *mockedCoordinator) CatchUpTenants(types.CatchUpTenantsInput) (*types.CreateResults, error) {
+	return &types.CreateResults{Summary: &types.Summary{}, Version: &types.Version{}}, nil
+}
+
+func (m *mockedCoordinator) Repair(types.RepairInput) (*types.RepairResults, error) {
+	return &types.RepairResults{Summary: &types.Summary{}, Version: &types.Version{}, MissingSourceMigrations: []types.DBMigration{}}, nil
+}
+
+func (m *mockedCoordinator) ImportHistory(types.ImportHistoryInput) (*types.ImportHistoryResults, error) {
+	return &types.ImportHistoryResults{Summary: &types.Summary{}, Version: &types.Version{}, UnmatchedEntries: []types.LegacyHistoryEntry{}}, nil
 }
 
 func (m *mockedCoordinator) GetSourceMigrations(_ *coordinator.SourceMigrationFilters) []types.Migration {
@@ -100,6 +146,14 @@ func (m *mockedCoordinator) GetVersionByID(ID int32) (*types.Version, error) {
 	return nil, nil
 }
 
+func (m *mockedCoordinator) GetMissingSourceMigrations() []types.DBMigration {
+	return []types.DBMigration{}
+}
+
+func (m *mockedCoordinator) GetCheckSumMismatches() []types.CheckSumMismatch {
+	return []types.CheckSumMismatch{}
+}
+
 func (m *mockedCoordinator) VerifySourceMigrationsCheckSums() (bool, []types.Migration) {
 	if m.errorThreshold == m.counter {
 		m1 := types.Migration{Name: "201602220000.sql", SourceDir: "source", File: "source/201602220000.sql", MigrationType: types.MigrationTypeSingleMigration, Contents: "select abc", CheckSum: "123"}
@@ -131,6 +185,33 @@ func newMockedCoordinatorHealthCheckError(ctx context.Context, config *config.Co
 	return &mockedCoordinatorHealthCheckError{}
 }
 
+// mockedJobCoordinator signals when job was run
+type mockedJobCoordinator struct {
+	mockedCoordinator
+	ctx  context.Context
+	done chan *types.Job
+}
+
+func (m *mockedJobCoordinator) RunJob(job *types.Job, input types.VersionInput) {
+	m.done <- job
+}
+
+// mockedPanicJobCoordinator panics when job is run and signals when job was failed
+type mockedPanicJobCoordinator struct {
+	mockedCoordinator
+	failed chan *types.Job
+}
+
+func (m *mockedPanicJobCoordinator) RunJob(job *types.Job, input types.VersionInput) {
+	panic("trouble maker")
+}
+
+func (m *mockedPanicJobCoordinator) FailJob(job *types.Job, failure string) {
+	job.State = types.JobStateFailed
+	job.Error = &failure
+	m.failed <- job
+}
+
 func newNoopMetrics() metrics.Metrics {
 	return &noopMetrics{}
 }
@@ -1,16 +1,20 @@
 package server
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lukaszbudnik/migrator/common"
 	"github.com/lukaszbudnik/migrator/config"
 	"github.com/lukaszbudnik/migrator/coordinator"
 	"github.com/lukaszbudnik/migrator/data"
+	"github.com/lukaszbudnik/migrator/metrics"
 	"github.com/lukaszbudnik/migrator/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -330,3 +334,68 @@ func TestDeprecationHeadersWithBothFields(t *testing.T) {
 	assert.Empty(t, w.Header().Get("Sunset"))
 	assert.Empty(t, w.Header().Get("Warning"))
 }
+
+func TestGraphQLCreateVersionAsync(t *testing.T) {
+	config, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	router := testSetupRouter(config, newMockedCoordinator)
+
+	w := httptest.NewRecorder()
+	req, _ := newTestRequestV2("POST", "/service", strings.NewReader(`
+    {
+      "query": "mutation CreateVersion($input: VersionInput!) { createVersion(input: $input) { job { id, state, versionName } } }",
+      "operationName": "CreateVersion",
+      "variables": { "input": { "versionName": "commit-sha", "async": true } }
+    }
+  `))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"data":{"createVersion":{"job":{"id":1,"state":"Queued","versionName":"commit-sha"}}}}`, strings.TrimSpace(w.Body.String()))
+}
+
+func TestJobRunnerSubmit(t *testing.T) {
+	cfg, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	jobCoordinator := &mockedJobCoordinator{done: make(chan *types.Job)}
+	newCoordinator := func(ctx context.Context, _ *config.Config, _ metrics.Metrics) coordinator.Coordinator {
+		jobCoordinator.ctx = ctx
+		return jobCoordinator
+	}
+
+	jobs := &jobRunner{config: cfg, metrics: newNoopMetrics(), newCoordinator: newCoordinator}
+	jobs.Submit(&types.Job{ID: 123, State: types.JobStateQueued}, types.VersionInput{VersionName: "commit-sha", Async: true})
+
+	select {
+	case job := <-jobCoordinator.done:
+		assert.Equal(t, int32(123), job.ID)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "job was not run")
+	}
+	// job is run outside of HTTP request context
+	assert.Equal(t, "job-123", jobCoordinator.ctx.Value(common.RequestIDKey{}))
+	assert.NotNil(t, common.GetProgress(jobCoordinator.ctx))
+}
+
+func TestJobRunnerSubmitPanic(t *testing.T) {
+	cfg, err := config.FromFile(configFile)
+	assert.Nil(t, err)
+
+	jobCoordinator := &mockedPanicJobCoordinator{failed: make(chan *types.Job)}
+	newCoordinator := func(ctx context.Context, _ *config.Config, _ metrics.Metrics) coordinator.Coordinator {
+		return jobCoordinator
+	}
+
+	jobs := &jobRunner{config: cfg, metrics: newNoopMetrics(), newCoordinator: newCoordinator}
+	jobs.Submit(&types.Job{ID: 123, State: types.JobStateQueued}, types.VersionInput{VersionName: "commit-sha", Async: true})
+
+	select {
+	case job := <-jobCoordinator.failed:
+		assert.Equal(t, types.JobStateFailed, job.State)
+		assert.Equal(t, "trouble maker", *job.Error)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "job was not failed")
+	}
+}
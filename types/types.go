@@ -1,7 +1,10 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/graph-gophers/graphql-go"
 )
@@ -18,6 +21,20 @@ const (
 	MigrationTypeSingleScript MigrationType = 3
 	// MigrationTypeTenantScript is used to mark tenant SQL scripts which is executed always
 	MigrationTypeTenantScript MigrationType = 4
+	// MigrationTypeRollback is used to mark migrations which were rolled back using their down migrations
+	MigrationTypeRollback MigrationType = 5
+	// MigrationTypeRepair is used to mark audit entries of migrations whose contents and checksum were repaired
+	MigrationTypeRepair MigrationType = 6
+	// MigrationTypeTenantDeletion is used to mark audit entries of deleted tenants
+	MigrationTypeTenantDeletion MigrationType = 7
+	// MigrationTypeTenantFailure is used to mark audit entries of tenant migrations & scripts which failed to apply in a tenant
+	MigrationTypeTenantFailure MigrationType = 8
+	// MigrationTypeSingleRepeatable is used to mark single SQL script which is executed only when its checksum changed
+	MigrationTypeSingleRepeatable MigrationType = 9
+	// MigrationTypeTenantRepeatable is used to mark tenant SQL scripts which are executed only when their checksum changed
+	MigrationTypeTenantRepeatable MigrationType = 10
+	// MigrationTypeCallback is used to mark lifecycle callbacks which are executed at defined points of versions and tenants
+	MigrationTypeCallback MigrationType = 11
 )
 
 // ImplementsGraphQLType maps MigrationType Go type
@@ -37,6 +54,20 @@ func (t MigrationType) String() string {
 		return "SingleScript"
 	case MigrationTypeTenantScript:
 		return "TenantScript"
+	case MigrationTypeRollback:
+		return "Rollback"
+	case MigrationTypeRepair:
+		return "Repair"
+	case MigrationTypeTenantDeletion:
+		return "TenantDeletion"
+	case MigrationTypeTenantFailure:
+		return "TenantFailure"
+	case MigrationTypeSingleRepeatable:
+		return "SingleRepeatable"
+	case MigrationTypeTenantRepeatable:
+		return "TenantRepeatable"
+	case MigrationTypeCallback:
+		return "Callback"
 	default:
 		panic(fmt.Sprintf("Unknown MigrationType value: %v", uint32(t)))
 	}
@@ -54,6 +85,20 @@ func (t *MigrationType) UnmarshalGraphQL(input interface{}) error {
 			*t = MigrationTypeSingleScript
 		case "TenantScript":
 			*t = MigrationTypeTenantScript
+		case "Rollback":
+			*t = MigrationTypeRollback
+		case "Repair":
+			*t = MigrationTypeRepair
+		case "TenantDeletion":
+			*t = MigrationTypeTenantDeletion
+		case "TenantFailure":
+			*t = MigrationTypeTenantFailure
+		case "SingleRepeatable":
+			*t = MigrationTypeSingleRepeatable
+		case "TenantRepeatable":
+			*t = MigrationTypeTenantRepeatable
+		case "Callback":
+			*t = MigrationTypeCallback
 		default:
 			panic(fmt.Sprintf("Unknown MigrationType literal: %v", str))
 		}
@@ -65,6 +110,108 @@ func (t *MigrationType) UnmarshalGraphQL(input interface{}) error {
 // Tenant contains basic information about tenant
 type Tenant struct {
 	Name string `json:"name"`
+	// Metadata contains tenant attributes, for example region, tier, shard
+	Metadata TenantMetadata `json:"metadata,omitempty"`
+}
+
+// TenantMetadata stores tenant attributes as key-value pairs
+type TenantMetadata map[string]string
+
+// ImplementsGraphQLType maps TenantMetadata Go type
+// to the graphql scalar type in the schema
+func (TenantMetadata) ImplementsGraphQLType(name string) bool {
+	return name == "Metadata"
+}
+
+// MarshalJSON converts TenantMetadata Go type to JSON object, nil metadata is converted to empty object
+func (m TenantMetadata) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string(m))
+}
+
+// UnmarshalGraphQL converts JSON object to TenantMetadata Go type, values which are not strings are converted to strings
+func (m *TenantMetadata) UnmarshalGraphQL(input interface{}) error {
+	object, ok := input.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("wrong type for Metadata: %T", input)
+	}
+	metadata := TenantMetadata{}
+	for k, v := range object {
+		switch v := v.(type) {
+		case string:
+			metadata[k] = v
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("wrong type for Metadata value of key %v: %T", k, v)
+		default:
+			metadata[k] = fmt.Sprint(v)
+		}
+	}
+	*m = metadata
+	return nil
+}
+
+// tenantRequirement is a single key=value or key!=value requirement of tenant selector
+// values contains alternatives separated by |, for example: tier=enterprise|premium
+type tenantRequirement struct {
+	key     string
+	values  []string
+	negated bool
+}
+
+// parseTenantSelector parses tenant selector made of comma-separated requirements, for example: tier=enterprise, region!=eu
+func parseTenantSelector(selector string) ([]tenantRequirement, error) {
+	requirements := []tenantRequirement{}
+	for _, r := range strings.Split(selector, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		key, value, found := strings.Cut(r, "=")
+		negated := strings.HasSuffix(key, "!")
+		key = strings.TrimSpace(strings.TrimSuffix(key, "!"))
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid tenant selector requirement: %v", r)
+		}
+		values := []string{}
+		for _, v := range strings.Split(value, "|") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		requirements = append(requirements, tenantRequirement{key, values, negated})
+	}
+	if len(requirements) == 0 {
+		return nil, fmt.Errorf("empty tenant selector")
+	}
+	return requirements, nil
+}
+
+// ValidateTenantSelector returns error when tenant selector cannot be parsed
+func ValidateTenantSelector(selector string) error {
+	_, err := parseTenantSelector(selector)
+	return err
+}
+
+// MatchesTenant returns true when migration has no tenant selector or metadata of passed tenant meets all requirements of the selector
+// tenant without metadata key doesn't meet key=value requirement and meets key!=value requirement
+func (m Migration) MatchesTenant(tenant Tenant) bool {
+	if m.TenantSelector == "" {
+		return true
+	}
+	requirements, err := parseTenantSelector(m.TenantSelector)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid tenant selector in migration %v: %v", m.File, err))
+	}
+	for _, r := range requirements {
+		value, ok := tenant.Metadata[r.key]
+		matched := false
+		for _, v := range r.values {
+			matched = matched || (ok && value == v)
+		}
+		if matched == r.negated {
+			return false
+		}
+	}
+	return true
 }
 
 // Version contains information about migrator versions
@@ -73,6 +220,8 @@ type Version struct {
 	Name         string        `json:"name"`
 	Created      graphql.Time  `json:"created"`
 	DBMigrations []DBMigration `json:"dbMigrations"`
+	// true when migrations failed in some of the tenants
+	Partial bool `json:"partial"`
 }
 
 // Migration contains basic information about migration
@@ -83,6 +232,69 @@ type Migration struct {
 	MigrationType MigrationType `json:"migrationType"`
 	Contents      string        `json:"contents,omitempty"`
 	CheckSum      string        `json:"checkSum"`
+	DownContents  string        `json:"downContents,omitempty"`
+	DependsOn     []string      `json:"dependsOn,omitempty"`
+	NoTransaction bool          `json:"noTransaction,omitempty"`
+	// Timeout after which migration is cancelled, set using statementTimeouts config or timeout header directive
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// TenantSelector limits tenants to which tenant migration or script is applied, set using tenantSelectors config or tenants header directive
+	TenantSelector string `json:"tenantSelector,omitempty"`
+	// Labels limit contexts in which migration is applied, set using labels config or labels header directive
+	Labels []string `json:"labels,omitempty"`
+}
+
+// MatchesContexts returns true when migration has no labels or at least one of its labels is among passed contexts
+func (m Migration) MatchesContexts(contexts []string) bool {
+	if len(m.Labels) == 0 {
+		return true
+	}
+	for _, label := range m.Labels {
+		for _, context := range contexts {
+			if label == context {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CallbackEvent stores information about the point at which lifecycle callback is executed
+type CallbackEvent string
+
+const (
+	// CallbackBeforeVersion callbacks are executed once before migrations of a version are applied
+	CallbackBeforeVersion CallbackEvent = "beforeVersion"
+	// CallbackAfterVersion callbacks are executed once after migrations of a version were applied
+	CallbackAfterVersion CallbackEvent = "afterVersion"
+	// CallbackBeforeEachTenant callbacks are executed in every tenant before its migrations are applied
+	CallbackBeforeEachTenant CallbackEvent = "beforeEachTenant"
+	// CallbackAfterEachTenant callbacks are executed in every tenant after its migrations were applied
+	CallbackAfterEachTenant CallbackEvent = "afterEachTenant"
+	// CallbackAfterCreateTenant callbacks are executed in new tenant after it was created
+	CallbackAfterCreateTenant CallbackEvent = "afterCreateTenant"
+)
+
+// CallbackEvents contains all callback events in the order in which they are executed
+var CallbackEvents = []CallbackEvent{CallbackBeforeVersion, CallbackBeforeEachTenant, CallbackAfterEachTenant, CallbackAfterCreateTenant, CallbackAfterVersion}
+
+// IsTenant returns true for events whose callbacks are executed in tenant schemas
+func (e CallbackEvent) IsTenant() bool {
+	return e == CallbackBeforeEachTenant || e == CallbackAfterEachTenant || e == CallbackAfterCreateTenant
+}
+
+// CallbackEvent returns event of callback which is the prefix of its name followed by "." or "_",
+// for example afterVersion.sql or afterVersion_refresh_views.sql, empty event is returned for unknown prefixes
+func (m Migration) CallbackEvent() CallbackEvent {
+	prefix := m.Name
+	if i := strings.IndexAny(prefix, "._"); i >= 0 {
+		prefix = prefix[:i]
+	}
+	for _, event := range CallbackEvents {
+		if CallbackEvent(prefix) == event {
+			return event
+		}
+	}
+	return ""
 }
 
 // DBMigration embeds Migration and adds DB-specific fields
@@ -93,6 +305,13 @@ type DBMigration struct {
 	Created graphql.Time `json:"created"`
 }
 
+// CheckSumMismatch contains source migration which was modified after it had been applied and the CheckSum stored in DB
+type CheckSumMismatch struct {
+	SourceMigration Migration `json:"sourceMigration"`
+	AppliedCheckSum string    `json:"appliedCheckSum"`
+	AppliedContents string    `json:"appliedContents"`
+}
+
 // Summary contains summary information about executed migrations
 type Summary struct {
 	VersionID             int32        `json:"versionId"`
@@ -105,14 +324,62 @@ type Summary struct {
 	MigrationsGrandTotal  int32        `json:"migrationsGrandTotal"`  // total number of all migrations applied
 	SingleScripts         int32        `json:"singleScripts"`
 	TenantScripts         int32        `json:"tenantScripts"`
-	TenantScriptsTotal    int32        `json:"tenantScriptsTotal"` // tenant scripts for all tenants
-	ScriptsGrandTotal     int32        `json:"scriptsGrandTotal"`  // total number of all scripts applied
+	TenantScriptsTotal    int32        `json:"tenantScriptsTotal"`   // tenant scripts for all tenants
+	ScriptsGrandTotal     int32        `json:"scriptsGrandTotal"`    // total number of all scripts applied
+	MigrationsRolledBack  int32        `json:"migrationsRolledBack"` // total number of all migrations rolled back
+	OutOfOrderMigrations  []string     `json:"outOfOrderMigrations,omitempty"`
+	MigrationsRepaired    int32        `json:"migrationsRepaired"`
+	TenantsDeleted        int32        `json:"tenantsDeleted"`
+	// files of migrations which were run outside of version transaction
+	NonTransactionalMigrations []string `json:"nonTransactionalMigrations,omitempty"`
+	// number of tenants whose migrations were applied successfully
+	TenantsSucceeded int32 `json:"tenantsSucceeded"`
+	// number of tenants whose migrations failed, reported only when failure policy is continue or stopAfterN
+	TenantsFailed  int32           `json:"tenantsFailed"`
+	TenantFailures []TenantFailure `json:"tenantFailures,omitempty"`
+	// files of pending migrations which were not applied because their labels don't match contexts
+	SkippedMigrations []string `json:"skippedMigrations,omitempty"`
+}
+
+// TenantFailure contains error which caused migrations of a tenant to fail
+type TenantFailure struct {
+	Tenant string `json:"tenant"`
+	Error  string `json:"error"`
+}
+
+// TenantStatus contains information about tenant migrations of a tenant
+type TenantStatus struct {
+	Name string `json:"name"`
+	// number of tenant migrations applied in tenant
+	AppliedMigrations int32 `json:"appliedMigrations"`
+	// tenant migrations applied in other tenants but not in this tenant
+	MissingMigrations []Migration `json:"missingMigrations"`
+	// tenant migrations not applied in any tenant yet
+	PendingMigrations []Migration `json:"pendingMigrations"`
 }
 
 // CreateResults contains results of CreateVersion or CreateTenant
 type CreateResults struct {
 	Summary *Summary
 	Version *Version
+	// Job is set when version is created asynchronously
+	Job *Job
+}
+
+// RepairResults contains results of Repair
+type RepairResults struct {
+	Summary *Summary
+	Version *Version
+	// applied migrations whose source migration no longer exists
+	MissingSourceMigrations []DBMigration
+}
+
+// ImportHistoryResults contains results of ImportHistory
+type ImportHistoryResults struct {
+	Summary *Summary
+	Version *Version
+	// entries of legacy history table which were not imported (not matched to source migrations or failed)
+	UnmatchedEntries []LegacyHistoryEntry
 }
 
 // Action stores information about migrator action
@@ -159,11 +426,231 @@ func (a *Action) UnmarshalGraphQL(input interface{}) error {
 	return fmt.Errorf("wrong type for Action: %T", input)
 }
 
+// DeleteTenantMode stores information about how tenant is deleted
+type DeleteTenantMode int
+
+const (
+	// DeleteTenantModeUnregister (the default mode) tells migrator to only remove tenant entry, tenant schema is left untouched
+	DeleteTenantModeUnregister DeleteTenantMode = iota
+	// DeleteTenantModeArchive tells migrator to remove tenant entry and rename tenant schema
+	DeleteTenantModeArchive
+	// DeleteTenantModeDrop tells migrator to remove tenant entry and drop tenant schema
+	DeleteTenantModeDrop
+)
+
+// ImplementsGraphQLType maps DeleteTenantMode Go type
+// to the graphql scalar type in the schema
+func (DeleteTenantMode) ImplementsGraphQLType(name string) bool {
+	return name == "DeleteTenantMode"
+}
+
+// String converts DeleteTenantMode Go type to string literal
+func (d DeleteTenantMode) String() string {
+	switch d {
+	case DeleteTenantModeUnregister:
+		return "Unregister"
+	case DeleteTenantModeArchive:
+		return "Archive"
+	case DeleteTenantModeDrop:
+		return "Drop"
+	default:
+		panic(fmt.Sprintf("Unknown DeleteTenantMode value: %v", uint32(d)))
+	}
+}
+
+// UnmarshalGraphQL converts string literal to DeleteTenantMode Go type
+func (d *DeleteTenantMode) UnmarshalGraphQL(input interface{}) error {
+	if str, ok := input.(string); ok {
+		switch str {
+		case "Unregister":
+			*d = DeleteTenantModeUnregister
+		case "Archive":
+			*d = DeleteTenantModeArchive
+		case "Drop":
+			*d = DeleteTenantModeDrop
+		default:
+			return fmt.Errorf("unknown DeleteTenantMode literal: %v", str)
+		}
+		return nil
+	}
+	return fmt.Errorf("wrong type for DeleteTenantMode: %T", input)
+}
+
+// LegacyTool stores information about legacy migration tool whose history is imported
+type LegacyTool int
+
+const (
+	// LegacyToolFlyway reads Flyway's flyway_schema_history table
+	LegacyToolFlyway LegacyTool = iota
+	// LegacyToolLiquibase reads Liquibase's DATABASECHANGELOG table
+	LegacyToolLiquibase
+	// LegacyToolGolangMigrate reads golang-migrate's schema_migrations table
+	LegacyToolGolangMigrate
+)
+
+// ImplementsGraphQLType maps LegacyTool Go type
+// to the graphql scalar type in the schema
+func (LegacyTool) ImplementsGraphQLType(name string) bool {
+	return name == "LegacyTool"
+}
+
+// String converts LegacyTool Go type to string literal
+func (l LegacyTool) String() string {
+	switch l {
+	case LegacyToolFlyway:
+		return "Flyway"
+	case LegacyToolLiquibase:
+		return "Liquibase"
+	case LegacyToolGolangMigrate:
+		return "GolangMigrate"
+	default:
+		panic(fmt.Sprintf("Unknown LegacyTool value: %v", uint32(l)))
+	}
+}
+
+// UnmarshalGraphQL converts string literal to LegacyTool Go type
+func (l *LegacyTool) UnmarshalGraphQL(input interface{}) error {
+	if str, ok := input.(string); ok {
+		switch str {
+		case "Flyway":
+			*l = LegacyToolFlyway
+		case "Liquibase":
+			*l = LegacyToolLiquibase
+		case "GolangMigrate":
+			*l = LegacyToolGolangMigrate
+		default:
+			return fmt.Errorf("unknown LegacyTool literal: %v", str)
+		}
+		return nil
+	}
+	return fmt.Errorf("wrong type for LegacyTool: %T", input)
+}
+
+// HistoryTable returns default name of legacy tool's history table
+func (l LegacyTool) HistoryTable() string {
+	switch l {
+	case LegacyToolLiquibase:
+		return "DATABASECHANGELOG"
+	case LegacyToolGolangMigrate:
+		return "schema_migrations"
+	default:
+		return "flyway_schema_history"
+	}
+}
+
+// LegacyHistoryEntry is an entry of legacy migration tool's history table
+type LegacyHistoryEntry struct {
+	// Schema in which history table is stored
+	Schema string
+	// Version is Flyway version, Liquibase changeset id, or golang-migrate version
+	Version string
+	// Script is Flyway script or Liquibase changelog file
+	Script      string
+	Description string
+	// CheckSum is Flyway checksum or Liquibase MD5 sum
+	CheckSum string
+	// Success is false for failed Flyway migrations, failed Liquibase changesets, and dirty golang-migrate version
+	Success bool
+}
+
+// JobState stores state of asynchronous job
+type JobState uint32
+
+const (
+	// JobStateQueued is used to mark jobs which were created but have not been started yet
+	JobStateQueued JobState = 1
+	// JobStateRunning is used to mark jobs which are running
+	JobStateRunning JobState = 2
+	// JobStateSucceeded is used to mark jobs which finished successfully
+	JobStateSucceeded JobState = 3
+	// JobStateFailed is used to mark jobs which failed
+	JobStateFailed JobState = 4
+	// JobStateCancelled is used to mark jobs which were cancelled using cancelJob
+	JobStateCancelled JobState = 5
+)
+
+// ImplementsGraphQLType maps JobState Go type
+// to the graphql scalar type in the schema
+func (JobState) ImplementsGraphQLType(name string) bool {
+	return name == "JobState"
+}
+
+// String converts JobState Go type to string literal
+func (s JobState) String() string {
+	switch s {
+	case JobStateQueued:
+		return "Queued"
+	case JobStateRunning:
+		return "Running"
+	case JobStateSucceeded:
+		return "Succeeded"
+	case JobStateFailed:
+		return "Failed"
+	case JobStateCancelled:
+		return "Cancelled"
+	default:
+		panic(fmt.Sprintf("Unknown JobState value: %v", uint32(s)))
+	}
+}
+
+// UnmarshalGraphQL converts string literal to JobState Go type
+func (s *JobState) UnmarshalGraphQL(input interface{}) error {
+	if str, ok := input.(string); ok {
+		switch str {
+		case "Queued":
+			*s = JobStateQueued
+		case "Running":
+			*s = JobStateRunning
+		case "Succeeded":
+			*s = JobStateSucceeded
+		case "Failed":
+			*s = JobStateFailed
+		case "Cancelled":
+			*s = JobStateCancelled
+		default:
+			return fmt.Errorf("unknown JobState literal: %v", str)
+		}
+		return nil
+	}
+	return fmt.Errorf("wrong type for JobState: %T", input)
+}
+
+// Job contains information about asynchronous createVersion job
+type Job struct {
+	ID          int32
+	State       JobState
+	VersionName string
+	Created     graphql.Time
+	Updated     graphql.Time
+	// MigrationsTotal is the number of migrations (for all tenants) which job is going to apply
+	MigrationsTotal int32
+	// MigrationsApplied is the number of migrations (for all tenants) which job applied so far
+	MigrationsApplied int32
+	// Results are set when job succeeded
+	Results *CreateResults
+	// Error is set when job failed or was cancelled
+	Error *string
+	// CancelRequested is set by cancelJob, job which is running is cancelled by the migrator which runs it
+	CancelRequested bool
+}
+
 // VersionInput is used by GraphQL to create new version in DB
 type VersionInput struct {
 	VersionName string
 	Action      Action
 	DryRun      bool
+	// Target is optional name or file of the last source migration to apply
+	Target *string
+	// Tenants is optional list of tenants to which tenant migrations & scripts are applied
+	Tenants *[]string
+	// TenantPattern is optional pattern (path.Match syntax) of tenants to which tenant migrations & scripts are applied
+	TenantPattern *string
+	// VerifyChecksums is optional override of config's verifyChecksums
+	VerifyChecksums *bool
+	// Async tells migrator to create version in background job
+	Async bool
+	// Contexts is optional override of config's contexts, only migrations without labels or labelled with one of contexts are applied
+	Contexts *[]string
 }
 
 // TenantInput is used by GraphQL to create a new tenant in DB
@@ -172,6 +659,48 @@ type TenantInput struct {
 	Action      Action
 	DryRun      bool
 	TenantName  string
+	Metadata    *TenantMetadata
+}
+
+// CatchUpTenantsInput is used by GraphQL to apply missing tenant migrations to lagging tenants
+type CatchUpTenantsInput struct {
+	VersionName   string
+	Action        Action
+	DryRun        bool
+	Tenants       *[]string
+	TenantPattern *string
+}
+
+// DeleteTenantInput is used by GraphQL to delete tenant
+type DeleteTenantInput struct {
+	TenantName  string
+	VersionName string
+	Mode        DeleteTenantMode
+	// ConfirmationToken is required by DeleteTenantModeDrop and must be equal to TenantName
+	ConfirmationToken *string
+	DryRun            bool
+}
+
+// RepairInput is used by GraphQL to repair contents and checksums of applied migrations
+type RepairInput struct {
+	VersionName string
+	Files       []string
+	Confirm     bool
+}
+
+// ImportHistoryInput is used by GraphQL to import history of legacy migration tool as a Sync version
+type ImportHistoryInput struct {
+	VersionName string
+	Tool        LegacyTool
+	// Table is optional name of history table, defaults to the tool's default history table
+	Table *string
+	// Schema is optional schema of history table of single schema migrations, defaults to all single schemas
+	Schema *string
+	// Tenants is optional list of tenants whose history tables are imported
+	Tenants *[]string
+	// TenantPattern is optional pattern (path.Match syntax) of tenants whose history tables are imported
+	TenantPattern *string
+	DryRun        bool
 }
 
 // APIVersion represents migrator API versions